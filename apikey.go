@@ -0,0 +1,213 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// API keys look like "scd_<prefix>_<secret>". The prefix is public and
+// finds the stored key; the whole key is hashed and compared against it.
+const apiKeyTag = "scd"
+
+const maxAPIKeyNameLength = 100
+
+// newAPIKeySecret generates a key and returns it with its prefix and hash.
+func newAPIKeySecret() (key, prefix, hash string, err error) {
+	var b [8 + 32]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", "", "", err
+	}
+	prefix = hex.EncodeToString(b[:8])
+	key = apiKeyTag + "_" + prefix + "_" + base64.RawURLEncoding.EncodeToString(b[8:])
+	return key, prefix, hashAPIKey(key), nil
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// authenticateAPIKey checks a key sent as "Authorization: ApiKey <key>"
+// from the address ip.
+func (a *App) authenticateAPIKey(credentials, ip string) (*Principal, bool) {
+	parts := strings.SplitN(credentials, "_", 3)
+	if len(parts) != 3 || parts[0] != apiKeyTag {
+		return nil, false
+	}
+
+	key, err := a.Store.FindAPIKey(parts[1])
+	if err != nil || key.Revoked() {
+		return nil, false
+	}
+	if subtle.ConstantTimeCompare([]byte(hashAPIKey(credentials)), []byte(key.Hash)) != 1 {
+		return nil, false
+	}
+	if !ipAllowed(ip, key.AllowedIPs) {
+		return nil, false
+	}
+
+	subject := "apikey:" + strconv.FormatUint(key.KeyID, 10)
+	return &Principal{Subject: subject, KeyID: key.KeyID, Scopes: key.Scopes}, true
+}
+
+// ipAllowed reports whether ip is one of the addresses or inside one of
+// the CIDR ranges in allowed. An empty list allows every address.
+func ipAllowed(ip string, allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	for _, entry := range allowed {
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			if network.Contains(addr) {
+				return true
+			}
+		} else if allowedAddr := net.ParseIP(entry); allowedAddr != nil && allowedAddr.Equal(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func isValidIPOrCIDR(s string) bool {
+	if _, _, err := net.ParseCIDR(s); err == nil {
+		return true
+	}
+	return net.ParseIP(s) != nil
+}
+
+func isAPIKeyScope(scope string) bool {
+	for _, s := range APIKeyScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// apiKeyWithSecret is the response to creating or rotating a key, the only
+// time the key itself is returned.
+type apiKeyWithSecret struct {
+	*APIKey
+	Key string `json:"key"`
+}
+
+func (a *App) createAPIKey(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		Name       string   `json:"name"`
+		Scopes     []string `json:"scopes"`
+		AllowedIPs []string `json:"allowedips"`
+	}
+	if !decodeRequest(w, r, &payload) {
+		return
+	}
+
+	var v validator
+	payload.Name = strings.TrimSpace(payload.Name)
+	v.check(payload.Name != "", "name", FieldRequired, "is required")
+	v.check(len(payload.Name) <= maxAPIKeyNameLength, "name", FieldTooLong, "must be at most "+strconv.Itoa(maxAPIKeyNameLength)+" bytes")
+	v.check(len(payload.Scopes) > 0, "scopes", FieldRequired, "must list at least one scope")
+	for i, scope := range payload.Scopes {
+		v.check(isAPIKeyScope(scope), "scopes."+strconv.Itoa(i), FieldInvalid, "must be one of "+strings.Join(APIKeyScopes, ", "))
+	}
+	for i, ip := range payload.AllowedIPs {
+		v.check(isValidIPOrCIDR(ip), "allowedips."+strconv.Itoa(i), FieldInvalid, "must be an IP address or CIDR range")
+	}
+	if !v.valid(w) {
+		return
+	}
+
+	secret, prefix, hash, err := newAPIKeySecret()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	key := APIKey{
+		Name:       payload.Name,
+		Prefix:     prefix,
+		Hash:       hash,
+		Scopes:     payload.Scopes,
+		AllowedIPs: payload.AllowedIPs,
+		CreatedBy:  PrincipalFrom(r.Context()).Actor(),
+	}
+	if key.AllowedIPs == nil {
+		key.AllowedIPs = []string{}
+	}
+	if err := a.Store.CreateAPIKey(&key, newAuditEntry(r, AuditAPIKeyCreate)); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, apiKeyWithSecret{&key, secret})
+}
+
+func (a *App) getAPIKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := a.Store.GetAPIKeys()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, keys)
+}
+
+func (a *App) revokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	keyid, ok := pathID(w, r, "keyid", 64)
+	if !ok {
+		return
+	}
+
+	key := APIKey{KeyID: keyid}
+	if err := a.Store.RevokeAPIKey(&key, newAuditEntry(r, AuditAPIKeyRevoke)); err != nil {
+		if errors.Is(err, ErrAPIKeyNotFound) {
+			respondWithError(w, http.StatusNotFound, "API key not found")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, key)
+}
+
+// rotateAPIKey replaces a key's secret, keeping its ID, scopes and
+// allowlist. The old key stops working immediately.
+func (a *App) rotateAPIKey(w http.ResponseWriter, r *http.Request) {
+	keyid, ok := pathID(w, r, "keyid", 64)
+	if !ok {
+		return
+	}
+
+	secret, prefix, hash, err := newAPIKeySecret()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	key := APIKey{KeyID: keyid, Prefix: prefix, Hash: hash}
+	if err := a.Store.RotateAPIKey(&key, newAuditEntry(r, AuditAPIKeyRotate)); err != nil {
+		switch {
+		case errors.Is(err, ErrAPIKeyNotFound):
+			respondWithError(w, http.StatusNotFound, "API key not found")
+		case errors.Is(err, ErrAPIKeyRevoked):
+			respondWithError(w, http.StatusConflict, "API key revoked")
+		default:
+			respondWithError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, apiKeyWithSecret{&key, secret})
+}
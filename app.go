@@ -1,48 +1,106 @@
 package main
 
 import (
-	"database/sql"
+	"crypto/ed25519"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
-	"net/smtp"
 	"os"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
-	_ "github.com/go-sql-driver/mysql"
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
 )
 
 type App struct {
 	Router *mux.Router
-	DB     *sql.DB
+	Store  Store
+
+	// Notifier delivers queued notifications. Defaults to a LogNotifier.
+	Notifier Notifier
+
+	// IdempotencyRetention is how long Idempotency-Key responses are
+	// replayed. Defaults to DefaultIdempotencyRetention.
+	IdempotencyRetention time.Duration
+
+	// DepositPolicy limits deposits made through POST /transaction. The
+	// zero value has no limits.
+	DepositPolicy DepositPolicy
+
+	// Tokens verifies the bearer tokens every request must carry.
+	Tokens TokenVerifier
+
+	// LedgerKey signs checkpoints of the transaction log hash chain. No
+	// checkpoints are made without it.
+	LedgerKey ed25519.PrivateKey
+
+	// CheckpointInterval is how often Run signs a checkpoint. Defaults to
+	// DefaultCheckpointInterval.
+	CheckpointInterval time.Duration
+
+	// EmailVerification signs the links that verify customers' email
+	// addresses and decides what happens to their notifications until then.
+	EmailVerification EmailVerification
 }
 
+// Initialize connects to MySQL, brings its schema up to date and builds the
+// router on top of it.
 func (a *App) Initialize(user, password, dbname string) {
 	connectionString :=
 		fmt.Sprintf("%s:%s@/%s?parseTime=true", user, password, dbname)
 
-	var err error
-	a.DB, err = sql.Open("mysql", connectionString)
+	a.InitializeDriver("mysql", connectionString)
+}
+
+// InitializeDriver is like Initialize for any supported database: "mysql",
+// "sqlite" or "postgres", with a driver specific data source name.
+func (a *App) InitializeDriver(driver, dsn string) {
+	store, err := openSQLStore(driver, dsn)
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	a.InitializeWithStore(store)
+}
+
+// InitializeWithStore builds the router on top of an already opened store,
+// such as a MemoryStore in tests.
+func (a *App) InitializeWithStore(store Store) {
+	a.Store = store
+	if a.Notifier == nil {
+		a.Notifier = &LogNotifier{}
+	}
+	if a.IdempotencyRetention <= 0 {
+		a.IdempotencyRetention = DefaultIdempotencyRetention
+	}
+	a.EmailVerification.setDefaults()
+
 	a.Router = mux.NewRouter()
+	a.Router.Use(withRequestID)
 	a.initializeRoutes()
 }
 
 func (a *App) Run(addr string) {
+	go a.purgeIdempotencyKeys(time.Hour)
+	go a.runOutboxDispatcher(5 * time.Second)
+	if a.LedgerKey != nil {
+		if a.CheckpointInterval <= 0 {
+			a.CheckpointInterval = DefaultCheckpointInterval
+		}
+		go a.runCheckpoints(a.CheckpointInterval)
+	}
 
 	// CORS handler for development
 	if os.Getenv("APP_ENV") != "production" {
-		headersOK := handlers.AllowedHeaders([]string{"Accept", "Content-Type", "Content-Length", "Accept-Encoding", "X-CSRF-Token", "Authorization"})
+		headersOK := handlers.AllowedHeaders([]string{"Accept", "Content-Type", "Content-Length", "Accept-Encoding", "X-CSRF-Token", "Authorization", "Idempotency-Key", "X-Request-ID"})
 		originsOK := handlers.AllowedOrigins([]string{"*"})
-		methodsOK := handlers.AllowedMethods([]string{"POST", "GET", "OPTIONS", "PUT", "DELETE"})
+		methodsOK := handlers.AllowedMethods([]string{"POST", "GET", "OPTIONS", "PUT", "PATCH", "DELETE"})
 
 		log.Fatal(http.ListenAndServe(addr, handlers.CORS(originsOK, headersOK, methodsOK)(a.Router)))
 
@@ -53,33 +111,59 @@ func (a *App) Run(addr string) {
 }
 
 func (a *App) initializeRoutes() {
-	a.Router.HandleFunc("/account", a.getAccounts).Methods("GET")
-	a.Router.HandleFunc("/account/{accountid:[0-9]+}", a.getAccount).Methods("GET")
-	a.Router.HandleFunc("/account", a.createAccount).Methods("POST")
-
-	a.Router.HandleFunc("/transaction", a.getTransactions).Methods("GET")
-	a.Router.HandleFunc("/transaction", a.createTransaction).Methods("POST")
-	a.Router.HandleFunc("/account/{accountid:[0-9]+}/history", a.getHistory).Methods("GET")
+	// Each route requires one scope; see auth.go for what roles grant.
+	a.Router.HandleFunc("/account", a.authorize(a.getAccounts, ScopeAccountsList)).Methods("GET")
+	a.Router.HandleFunc("/account/{accountid:[0-9]+}", a.authorize(a.getAccount, ScopeAccountRead)).Methods("GET")
+	a.Router.HandleFunc("/account", a.authorize(a.createAccount, ScopeAccountCreate)).Methods("POST")
+	// The token in the link a customer is emailed authorizes this one.
+	a.Router.HandleFunc("/account/verify-email", a.verifyEmail).Methods("GET")
+
+	a.Router.HandleFunc("/transaction", a.authorize(a.getTransactions, ScopeTransactionsRead)).Methods("GET")
+	a.Router.HandleFunc("/transaction", a.authorize(a.idempotent(a.createTransaction), ScopeDepositCreate)).Methods("POST")
+	a.Router.HandleFunc("/transfer", a.authorize(a.idempotent(a.createTransfer), ScopeTransferCreate)).Methods("POST")
+	a.Router.HandleFunc("/transaction/{transid:[0-9]+}/postings", a.authorize(a.getPostings, ScopeTransactionsRead)).Methods("GET")
+	a.Router.HandleFunc("/transaction/{transid:[0-9]+}/reversal", a.authorize(a.idempotent(a.reverseTransaction), ScopeReversalCreate)).Methods("POST")
+	a.Router.HandleFunc("/account/{accountid:[0-9]+}/history", a.authorize(a.getHistory, ScopeAccountRead)).Methods("GET")
+	a.Router.HandleFunc("/account/{accountid:[0-9]+}/withdrawal", a.authorize(a.idempotent(a.createWithdrawal), ScopeWithdrawalCreate)).Methods("POST")
+
+	a.Router.HandleFunc("/account/{accountid:[0-9]+}", a.authorize(a.updateAccount, ScopeAccountUpdate)).Methods("PATCH")
+	a.Router.HandleFunc("/account/{accountid:[0-9]+}/freeze", a.authorize(a.changeAccountStatus(AccountFrozen, AuditAccountFreeze), ScopeAccountUpdate)).Methods("POST")
+	a.Router.HandleFunc("/account/{accountid:[0-9]+}/unfreeze", a.authorize(a.changeAccountStatus(AccountActive, AuditAccountUnfreeze), ScopeAccountUpdate)).Methods("POST")
+	a.Router.HandleFunc("/account/{accountid:[0-9]+}/close", a.authorize(a.changeAccountStatus(AccountClosed, AuditAccountClose), ScopeAccountUpdate)).Methods("POST")
+	a.Router.HandleFunc("/account/{accountid:[0-9]+}/status-history", a.authorize(a.getStatusHistory, ScopeAccountRead)).Methods("GET")
+	a.Router.HandleFunc("/account/{accountid:[0-9]+}/notifications", a.authorize(a.getNotificationPreferences, ScopeAccountRead)).Methods("GET")
+	a.Router.HandleFunc("/account/{accountid:[0-9]+}/notifications", a.authorize(a.updateNotificationPreferences, ScopeNotificationsUpdate)).Methods("PATCH")
+
+	a.Router.HandleFunc("/customer", a.authorize(a.createCustomer, ScopeCustomerCreate)).Methods("POST")
+	a.Router.HandleFunc("/customer/{customerid:[0-9]+}", a.authorize(a.getCustomer, ScopeCustomerRead)).Methods("GET")
+	a.Router.HandleFunc("/customer/{customerid:[0-9]+}/account", a.authorize(a.getCustomerAccounts, ScopeCustomerRead)).Methods("GET")
+	a.Router.HandleFunc("/customer/{customerid:[0-9]+}/verification-email", a.authorize(a.idempotent(a.resendVerificationEmail), ScopeCustomerCreate)).Methods("POST")
+
+	a.Router.HandleFunc("/apikey", a.authorize(a.getAPIKeys, ScopeAPIKeysManage)).Methods("GET")
+	a.Router.HandleFunc("/apikey", a.authorize(a.createAPIKey, ScopeAPIKeysManage)).Methods("POST")
+	a.Router.HandleFunc("/apikey/{keyid:[0-9]+}", a.authorize(a.revokeAPIKey, ScopeAPIKeysManage)).Methods("DELETE")
+	a.Router.HandleFunc("/apikey/{keyid:[0-9]+}/rotation", a.authorize(a.rotateAPIKey, ScopeAPIKeysManage)).Methods("POST")
+
+	a.Router.HandleFunc("/audit", a.authorize(a.getAuditEntries, ScopeAuditRead)).Methods("GET")
+	a.Router.HandleFunc("/ledger/verification", a.authorize(a.verifyLedger, ScopeAuditRead)).Methods("GET")
+	a.Router.HandleFunc("/ledger/checkpoints", a.authorize(a.getCheckpoints, ScopeAuditRead)).Methods("GET")
 }
 
 func (a *App) getAccount(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	accountid, err := strconv.Atoi(vars["accountid"])
-	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid account ID")
+	accountid, ok := pathID(w, r, "accountid", 32)
+	if !ok {
 		return
 	}
 
 	acc := Account{AccountID: uint32(accountid)}
 
-	err = acc.getAccount(a.DB)
+	err := a.Store.GetAccount(&acc)
 	if err != nil {
-		switch err {
-		case sql.ErrNoRows:
+		if errors.Is(err, ErrAccountNotFound) {
 			respondWithError(w, http.StatusNotFound, "Account not found")
-		default:
-			respondWithError(w, http.StatusInternalServerError, err.Error())
+			return
 		}
+		respondWithError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
@@ -87,167 +171,595 @@ func (a *App) getAccount(w http.ResponseWriter, r *http.Request) {
 }
 
 func (a *App) getAccounts(w http.ResponseWriter, r *http.Request) {
-	acc := Account{}
+	var v validator
+	f := parseAccountFilter(r, &v)
+	if !v.valid(w) {
+		return
+	}
+
+	// Fetch one extra row to learn whether there is a next page.
+	limit := f.Limit
+	f.Limit++
 
-	accounts, err := acc.getAccounts(a.DB)
+	accounts, total, err := a.Store.GetAccounts(f)
 	if err != nil {
-		switch err {
-		case sql.ErrNoRows:
-			respondWithError(w, http.StatusNotFound, "Account not found")
-		default:
-			respondWithError(w, http.StatusInternalServerError, err.Error())
-		}
+		respondWithError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, accounts)
+	page := AccountPage{Accounts: accounts, Total: total}
+	if len(accounts) > limit {
+		page.Accounts = accounts[:limit]
+		page.NextCursor = accountCursor(f.Sort, accounts[limit-1])
+	}
+
+	respondWithJSON(w, http.StatusOK, page)
+}
+
+// accountCursor encodes the sort key of acc for the next page.
+func accountCursor(sort string, acc Account) string {
+	var key string
+	switch sort {
+	case AccountSortName:
+		key = acc.Name
+	case AccountSortBalance:
+		key = strconv.FormatInt(int64(acc.Balance), 10)
+	default:
+		key = acc.Registered.UTC().Format(time.RFC3339Nano)
+	}
+	return encodeCursor(sort, key, strconv.FormatUint(uint64(acc.AccountID), 10))
+}
+
+// parseAccountFilter reads the GET /account query parameters, recording
+// every invalid one in v.
+func parseAccountFilter(r *http.Request, v *validator) AccountFilter {
+	var f AccountFilter
+	q := r.URL.Query()
+
+	f.Limit = pageSize(r, v)
+
+	switch f.Sort = q.Get("sort"); f.Sort {
+	case "":
+		f.Sort = AccountSortRegistered
+	case AccountSortName, AccountSortRegistered, AccountSortBalance:
+	default:
+		v.add("sort", FieldInvalid, "must be name, registered or balance")
+	}
+
+	switch q.Get("order") {
+	case "", "asc":
+	case "desc":
+		f.Desc = true
+	default:
+		v.add("order", FieldInvalid, "must be asc or desc")
+	}
+
+	if c := q.Get("cursor"); c != "" {
+		values, err := decodeCursor(c, 3)
+		if err == nil && values[0] != f.Sort {
+			err = errInvalidCursor
+		}
+
+		after := Account{}
+		if err == nil {
+			switch f.Sort {
+			case AccountSortName:
+				after.Name = values[1]
+			case AccountSortBalance:
+				var units int64
+				units, err = strconv.ParseInt(values[1], 10, 64)
+				after.Balance = Money(units)
+			default:
+				after.Registered, err = time.Parse(time.RFC3339Nano, values[1])
+			}
+		}
+		if err == nil {
+			var id uint64
+			id, err = strconv.ParseUint(values[2], 10, 32)
+			after.AccountID = uint32(id)
+		}
+		if err != nil {
+			v.add("cursor", FieldInvalid, "is not a cursor for this sort")
+		} else {
+			f.After = &after
+		}
+	}
+
+	f.NamePrefix = q.Get("name")
+	f.Email = q.Get("email")
+	f.IDCard = q.Get("idcardno")
+
+	v.timeParam(q, "registered_from", &f.RegisteredFrom)
+	v.timeParam(q, "registered_to", &f.RegisteredTo)
+
+	return f
 }
 
 func (a *App) getHistory(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
+	accountid, ok := pathID(w, r, "accountid", 32)
+	if !ok {
+		return
+	}
 
-	accountid, err := strconv.Atoi(vars["accountid"])
+	trans, err := a.Store.GetHistory(uint32(accountid))
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid account ID")
+		respondWithError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	t := Transaction{DepositDest: uint32(accountid)}
+	respondWithJSON(w, http.StatusOK, trans)
 
-	trans, err := t.getHistory(a.DB)
-	if err != nil {
-		switch err {
-		case sql.ErrNoRows:
-			respondWithError(w, http.StatusNotFound, "No transaction history found")
-		default:
-			respondWithError(w, http.StatusInternalServerError, err.Error())
-		}
+}
+
+func (a *App) getPostings(w http.ResponseWriter, r *http.Request) {
+	transid, ok := pathID(w, r, "transid", 64)
+	if !ok {
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, trans)
+	postings, err := a.Store.GetPostings(transid)
+	if errors.Is(err, ErrTransactionNotFound) {
+		respondWithError(w, http.StatusNotFound, "Transaction not found")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
 
+	respondWithJSON(w, http.StatusOK, postings)
 }
 
 func (a *App) getTransactions(w http.ResponseWriter, r *http.Request) {
-	t := Transaction{}
+	var v validator
+	f := parseTransactionFilter(r, &v)
+	if !v.valid(w) {
+		return
+	}
 
-	trans, err := t.getTransactions(a.DB)
+	// Fetch one extra row to learn whether there is a next page.
+	limit := f.Limit
+	f.Limit++
+
+	trans, err := a.Store.GetTransactions(f)
 	if err != nil {
-		switch err {
-		case sql.ErrNoRows:
-			respondWithError(w, http.StatusNotFound, "No transaction history found")
-		default:
-			respondWithError(w, http.StatusInternalServerError, err.Error())
-		}
+		respondWithError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, trans)
+	page := TransactionPage{Transactions: trans}
+	if len(trans) > limit {
+		page.Transactions = trans[:limit]
+		last := trans[limit-1]
+		page.NextCursor = encodeCursor(last.TransactionTime.UTC().Format(time.RFC3339Nano), strconv.FormatUint(last.TransactionID, 10))
+	}
+
+	respondWithJSON(w, http.StatusOK, page)
+
+}
+
+// parseTransactionFilter reads the GET /transaction query parameters,
+// recording every invalid one in v.
+func parseTransactionFilter(r *http.Request, v *validator) TransactionFilter {
+	var f TransactionFilter
+	q := r.URL.Query()
 
+	f.Limit = pageSize(r, v)
+
+	if c := q.Get("cursor"); c != "" {
+		values, err := decodeCursor(c, 2)
+		if err == nil {
+			f.BeforeTime, err = time.Parse(time.RFC3339Nano, values[0])
+		}
+		if err == nil {
+			f.BeforeID, err = strconv.ParseUint(values[1], 10, 64)
+		}
+		v.check(err == nil, "cursor", FieldInvalid, "is not a cursor from this endpoint")
+	}
+
+	v.timeParam(q, "from", &f.From)
+	v.timeParam(q, "to", &f.To)
+
+	amounts := []struct {
+		param string
+		dst   **Money
+	}{{"min_amount", &f.MinAmount}, {"max_amount", &f.MaxAmount}}
+	for _, a := range amounts {
+		if s := q.Get(a.param); s != "" {
+			amount, err := ParseMoney(s)
+			if err != nil {
+				v.add(a.param, FieldInvalid, "must be an amount")
+				continue
+			}
+			*a.dst = &amount
+		}
+	}
+
+	switch f.Source = q.Get("source"); f.Source {
+	case "", SourceInternal, SourceExternal:
+	default:
+		v.add("source", FieldInvalid, "must be internal or external")
+	}
+
+	if s := q.Get("destination"); s != "" {
+		dest, err := strconv.ParseUint(s, 10, 32)
+		v.check(err == nil, "destination", FieldInvalid, "must be an account number")
+		f.Destination = uint32(dest)
+	}
+
+	return f
 }
 
 func (a *App) createAccount(w http.ResponseWriter, r *http.Request) {
-	var acc Account
-	decoder := json.NewDecoder(r.Body)
+	var payload struct {
+		CustomerID     uint32   `json:"customerid"`
+		IDCard         string   `json:"idcardno"`
+		Name           string   `json:"name"`
+		Email          string   `json:"email"`
+		OverdraftLimit Money    `json:"overdraftlimit"`
+		ProductType    string   `json:"producttype"`
+		JointHolders   []uint32 `json:"jointholders"`
+	}
+	if !decodeRequest(w, r, &payload) {
+		return
+	}
+
+	acc := Account{
+		CustomerID:     payload.CustomerID,
+		IDCard:         payload.IDCard,
+		Name:           NormalizeName(payload.Name),
+		Email:          payload.Email,
+		OverdraftLimit: payload.OverdraftLimit,
+		ProductType:    payload.ProductType,
+		JointHolders:   payload.JointHolders,
+	}
+	if acc.ProductType == "" {
+		acc.ProductType = ProductSavings
+	}
 
-	err := decoder.Decode(&acc)
+	var v validator
+	// Without a customerid the account's owner is registered from the
+	// identity in the request.
+	if acc.CustomerID == 0 {
+		v.idCard(acc.IDCard, "idcardno")
+		v.required(acc.Name, "name", isValidName, nameRule)
+		v.required(acc.Email, "email", isValidEmail, "must be an email address")
+	}
+	v.check(acc.OverdraftLimit >= 0, "overdraftlimit", FieldInvalid, "must not be negative")
+	v.check(isValidProductType(acc.ProductType), "producttype", FieldInvalid, "must be savings or current")
+	v.jointHolders(acc)
+	if !v.valid(w) {
+		return
+	}
+
+	err := a.Store.CreateAccount(&acc, a.verificationEmail, newAuditEntry(r, AuditAccountCreate))
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		if errors.Is(err, ErrDuplicateAccount) {
+			respondWithProblem(w, http.StatusBadRequest, []FieldError{{"idcardno", FieldDuplicate, "is already registered"}})
+			return
+		}
+		if errors.Is(err, ErrCustomerNotFound) {
+			respondWithError(w, http.StatusNotFound, "Customer not found")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	defer r.Body.Close()
+	respondWithJSON(w, http.StatusCreated, acc)
+}
 
-	if !isValidIDCard(acc.IDCard) {
-		respondWithError(w, http.StatusBadRequest, "Invalid ID Card")
+// updateAccount changes the name and email of an account. Fields left out
+// of the request keep their value.
+func (a *App) updateAccount(w http.ResponseWriter, r *http.Request) {
+	accountid, ok := pathID(w, r, "accountid", 32)
+	if !ok {
 		return
 	}
 
-	if !isValidName(acc.Name) {
-		respondWithError(w, http.StatusBadRequest, "Invalid Name")
+	var payload struct {
+		Name  *string `json:"name"`
+		Email *string `json:"email"`
+	}
+	if !decodeRequest(w, r, &payload) {
 		return
 	}
 
-	if !isValidEmail(acc.Email) {
-		respondWithError(w, http.StatusBadRequest, "Invalid Email Address")
+	var v validator
+	if payload.Name != nil {
+		*payload.Name = NormalizeName(*payload.Name)
+		v.required(*payload.Name, "name", isValidName, nameRule)
+	}
+	if payload.Email != nil {
+		v.required(*payload.Email, "email", isValidEmail, "must be an email address")
+	}
+	if !v.valid(w) {
 		return
 	}
 
-	err = acc.createAccount(a.DB)
+	acc := Account{AccountID: uint32(accountid)}
+	err := a.Store.GetAccount(&acc)
+	if err == nil {
+		if payload.Name != nil {
+			acc.Name = *payload.Name
+		}
+		if payload.Email != nil {
+			acc.Email = *payload.Email
+		}
+		// A changed address has to be verified again.
+		err = a.Store.UpdateAccount(&acc, a.verificationEmail, newAuditEntry(r, AuditAccountUpdate))
+	}
 	if err != nil {
-		if strings.Contains(err.Error(), "Duplicate entry") {
-			respondWithError(w, http.StatusBadRequest, "Account exists!")
+		if errors.Is(err, ErrAccountNotFound) {
+			respondWithError(w, http.StatusNotFound, "Account not found")
+			return
+		}
+		if respondWithAccountError(w, err) {
 			return
 		}
 		respondWithError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	respondWithJSON(w, http.StatusCreated, acc)
+	respondWithJSON(w, http.StatusOK, acc)
 }
 
-func (a *App) createTransaction(w http.ResponseWriter, r *http.Request) {
-	var trans Transaction
-	decoder := json.NewDecoder(r.Body)
+// changeAccountStatus returns a handler that moves an account to status,
+// recording the optional reason from the request body.
+func (a *App) changeAccountStatus(status, action string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		accountid, ok := pathID(w, r, "accountid", 32)
+		if !ok {
+			return
+		}
+
+		var payload struct {
+			Reason string `json:"reason"`
+		}
+		// The body, and with it the reason, is optional.
+		if r.Body != nil {
+			defer r.Body.Close()
+			if err := decodeJSON(r.Body, &payload); err != nil && err != io.EOF {
+				respondWithProblem(w, http.StatusBadRequest, []FieldError{decodeError(err, &payload)})
+				return
+			}
+		}
+
+		var v validator
+		v.check(len(payload.Reason) <= maxStatusReasonLength, "reason", FieldTooLong, "must be at most "+strconv.Itoa(maxStatusReasonLength)+" bytes")
+		if !v.valid(w) {
+			return
+		}
+
+		change := AccountStatusChange{
+			AccountID: uint32(accountid),
+			Status:    status,
+			Reason:    payload.Reason,
+			ChangedBy: PrincipalFrom(r.Context()).Actor(),
+		}
+		var acc Account
+		err := a.Store.ChangeAccountStatus(&change, &acc, newAuditEntry(r, action))
+		if err != nil {
+			switch {
+			case errors.Is(err, ErrAccountNotFound):
+				respondWithError(w, http.StatusNotFound, "Account not found")
+			case errors.Is(err, ErrInvalidStatusChange) && status == AccountActive:
+				respondWithErrorCode(w, http.StatusConflict, "Account is not frozen", "invalid_status_change")
+			case errors.Is(err, ErrInvalidStatusChange):
+				respondWithErrorCode(w, http.StatusConflict, "Account is already "+status, "invalid_status_change")
+			case errors.Is(err, ErrBalanceNotZero):
+				respondWithErrorCode(w, http.StatusUnprocessableEntity, "Account balance must be zero to close it", "balance_not_zero")
+			case respondWithAccountError(w, err):
+			default:
+				respondWithError(w, http.StatusInternalServerError, err.Error())
+			}
+			return
+		}
 
-	err := decoder.Decode(&trans)
+		respondWithJSON(w, http.StatusOK, acc)
+	}
+}
+
+func (a *App) getStatusHistory(w http.ResponseWriter, r *http.Request) {
+	accountid, ok := pathID(w, r, "accountid", 32)
+	if !ok {
+		return
+	}
+
+	history, err := a.Store.GetAccountStatusHistory(uint32(accountid))
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		if errors.Is(err, ErrAccountNotFound) {
+			respondWithError(w, http.StatusNotFound, "Account not found")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	defer r.Body.Close()
+	respondWithJSON(w, http.StatusOK, history)
+}
 
-	if trans.ExternalSource != "" && !isValidEmail(trans.ExternalSource) {
-		respondWithError(w, http.StatusBadRequest, "Invalid Email Address")
+func (a *App) createTransaction(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		DepositDest    uint32 `json:"depositdest"`
+		ExternalSource string `json:"externalsource"`
+		InternalSource uint32 `json:"internalsource"`
+		Amount         Money  `json:"amount"`
+	}
+	if !decodeRequest(w, r, &payload) {
 		return
 	}
 
-	err = trans.createTransaction(a.DB)
+	var v validator
+	v.check(payload.Amount > 0, "amount", FieldInvalid, "must be greater than zero")
+	// A deposit comes from exactly one depositor, whose limits it counts
+	// towards.
+	switch {
+	case payload.ExternalSource == "" && payload.InternalSource == 0:
+		v.add("externalsource", FieldRequired, "is required unless internalsource is given")
+		v.add("internalsource", FieldRequired, "is required unless externalsource is given")
+	case payload.ExternalSource != "" && payload.InternalSource != 0:
+		v.add("internalsource", FieldInvalid, "must not be given with externalsource")
+	}
+	v.check(payload.ExternalSource == "" || isValidEmail(payload.ExternalSource), "externalsource", FieldInvalid, "must be an email address")
+	if !v.valid(w) {
+		return
+	}
+
+	trans := Transaction{
+		DepositDest:    payload.DepositDest,
+		ExternalSource: payload.ExternalSource,
+		InternalSource: payload.InternalSource,
+		Amount:         payload.Amount,
+		CreatedBy:      PrincipalFrom(r.Context()).Actor(),
+	}
+	err := a.Store.CreateTransaction(&trans, &a.DepositPolicy, a.notify(depositNotifications), newAuditEntry(r, AuditDepositCreate))
 	if err != nil {
-		if strings.Contains(err.Error(), "a foreign key constraint fails") {
+		if errors.Is(err, ErrUnknownAccount) {
 			respondWithError(w, http.StatusNotFound, "Invalid Account ID")
 			return
 		}
 
+		if respondWithAccountError(w, err) {
+			return
+		}
+
+		var violation *PolicyViolation
+		if errors.As(err, &violation) {
+			respondWithJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{
+				"error": violation.Message,
+				"rule":  violation.Rule,
+				"limit": violation.Limit,
+				"used":  violation.Used,
+			})
+			return
+		}
+
 		respondWithError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	err = sendDepositNotificationEmail(trans)
+	respondWithJSON(w, http.StatusCreated, trans)
+}
+
+func (a *App) createTransfer(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		InternalSource uint32 `json:"internalsource"`
+		DepositDest    uint32 `json:"depositdest"`
+		Amount         Money  `json:"amount"`
+	}
+	if !decodeRequest(w, r, &payload) {
+		return
+	}
+
+	var v validator
+	v.check(payload.Amount > 0, "amount", FieldInvalid, "must be greater than zero")
+	v.check(payload.InternalSource != 0, "internalsource", FieldRequired, "is required")
+	if !v.valid(w) {
+		return
+	}
+
+	trans := Transaction{InternalSource: payload.InternalSource, DepositDest: payload.DepositDest, Amount: payload.Amount}
+	if p := PrincipalFrom(r.Context()); p != nil && p.Role == RoleCustomer && p.AccountID != trans.InternalSource {
+		respondWithError(w, http.StatusForbidden, "Forbidden")
+		return
+	}
+
+	trans.CreatedBy = PrincipalFrom(r.Context()).Actor()
+	err := a.Store.CreateTransfer(&trans, a.notify(transferNotifications), newAuditEntry(r, AuditTransferCreate))
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
+		switch {
+		case errors.Is(err, ErrSameAccount):
+			respondWithError(w, http.StatusBadRequest, "Source and destination must be different accounts")
+		case errors.Is(err, ErrUnknownAccount):
+			respondWithError(w, http.StatusNotFound, "Invalid Account ID")
+		case errors.Is(err, ErrInsufficientFunds):
+			respondWithError(w, http.StatusUnprocessableEntity, "Insufficient funds")
+		case respondWithAccountError(w, err):
+		default:
+			respondWithError(w, http.StatusInternalServerError, err.Error())
+		}
 		return
 	}
 
 	respondWithJSON(w, http.StatusCreated, trans)
 }
 
-func sendDepositNotificationEmail(trans Transaction) error {
-	smtpserver := os.Getenv("SMTP_SERVER")
-	smtpport := os.Getenv("SMTP_PORT")
+func (a *App) createWithdrawal(w http.ResponseWriter, r *http.Request) {
+	accountid, ok := pathID(w, r, "accountid", 32)
+	if !ok {
+		return
+	}
 
-	from := os.Getenv("SMTP_USER")
-	pass := os.Getenv("SMTP_PASS")
+	var payload struct {
+		Amount Money `json:"amount"`
+	}
+	if !decodeRequest(w, r, &payload) {
+		return
+	}
 
-	var to string
-	if trans.InternalSourceEmail == "" {
-		to = trans.ExternalSource
-	} else {
-		to = trans.InternalSourceEmail
+	var v validator
+	v.check(payload.Amount > 0, "amount", FieldInvalid, "must be greater than zero")
+	if !v.valid(w) {
+		return
+	}
+
+	trans := Transaction{DepositDest: uint32(accountid), Amount: payload.Amount, CreatedBy: PrincipalFrom(r.Context()).Actor()}
+	err := a.Store.CreateWithdrawal(&trans, a.notify(withdrawalNotifications), newAuditEntry(r, AuditWithdrawalCreate))
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrUnknownAccount):
+			respondWithError(w, http.StatusNotFound, "Invalid Account ID")
+		case errors.Is(err, ErrInsufficientFunds):
+			respondWithError(w, http.StatusUnprocessableEntity, "Insufficient funds")
+		case respondWithAccountError(w, err):
+		default:
+			respondWithError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, trans)
+}
+
+func (a *App) reverseTransaction(w http.ResponseWriter, r *http.Request) {
+	transid, ok := pathID(w, r, "transid", 64)
+	if !ok {
+		return
 	}
 
-	msg := "From: " + from + "\n" +
-		"To: " + to + "\n" +
-		"Subject: Cash Deposit Notification\n\n" +
-		"You have successfully deposited " + strconv.FormatFloat(trans.Amount, 'f', 2, 64) + " to account number " + strconv.Itoa(int(trans.DepositDest)) + ". Ref No. #" + strconv.Itoa(int(trans.TransactionID))
+	var payload struct {
+		ReasonCode string `json:"reasoncode"`
+	}
+	if !decodeRequest(w, r, &payload) {
+		return
+	}
 
-	err := smtp.SendMail(smtpserver+":"+smtpport, smtp.PlainAuth("", from, pass, smtpserver), from, []string{to}, []byte(msg))
+	var v validator
+	v.required(payload.ReasonCode, "reasoncode", isValidReasonCode, "must be one of "+strings.Join(ReasonCodes, ", "))
+	if !v.valid(w) {
+		return
+	}
+
+	// The operator is whoever authenticated the request.
+	p := PrincipalFrom(r.Context())
+	trans := Transaction{ReversalOf: transid, ReasonCode: payload.ReasonCode, Operator: p.Subject, CreatedBy: p.Actor()}
+	err := a.Store.ReverseTransaction(&trans, newAuditEntry(r, AuditTransactionReverse))
 	if err != nil {
-		return err
+		switch {
+		case errors.Is(err, ErrTransactionNotFound):
+			respondWithError(w, http.StatusNotFound, "Transaction not found")
+		case errors.Is(err, ErrAlreadyReversed):
+			respondWithError(w, http.StatusConflict, "Transaction already reversed")
+		case errors.Is(err, ErrNotReversible):
+			respondWithError(w, http.StatusUnprocessableEntity, "A reversal cannot be reversed")
+		default:
+			respondWithError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
 	}
-	return nil
+
+	respondWithJSON(w, http.StatusCreated, trans)
 }
 
 func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
@@ -262,6 +774,25 @@ func respondWithError(w http.ResponseWriter, code int, message string) {
 	respondWithJSON(w, code, map[string]string{"error": message})
 }
 
-var isValidName = regexp.MustCompile(`^[a-zA-Z\s]{3,100}$`).MatchString
-var isValidIDCard = regexp.MustCompile(`^[0-9]{16}$`).MatchString
+// respondWithErrorCode adds a machine readable code to the error body.
+func respondWithErrorCode(w http.ResponseWriter, code int, message, errorCode string) {
+	respondWithJSON(w, code, map[string]string{"error": message, "code": errorCode})
+}
+
+// respondWithAccountError responds to ErrAccountFrozen and ErrAccountClosed
+// and reports whether err was one of them.
+func respondWithAccountError(w http.ResponseWriter, err error) bool {
+	switch {
+	case errors.Is(err, ErrAccountFrozen):
+		respondWithErrorCode(w, http.StatusUnprocessableEntity, "Account is frozen", "account_frozen")
+	case errors.Is(err, ErrAccountClosed):
+		respondWithErrorCode(w, http.StatusUnprocessableEntity, "Account is closed", "account_closed")
+	default:
+		return false
+	}
+	return true
+}
+
+const maxStatusReasonLength = 255
+
 var isValidEmail = regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$").MatchString
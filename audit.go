@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+// RequestIDFrom returns the ID withRequestID gave the request.
+func RequestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// withRequestID gives every request an ID, taken from its X-Request-ID
+// header or generated, and echoes it in the response so clients and logs
+// can be matched with the audit log.
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if id == "" || len(id) > maxRequestIDLength || !isPrintableASCII(id) {
+			var b [16]byte
+			rand.Read(b[:])
+			id = hex.EncodeToString(b[:])
+		}
+		w.Header().Set("X-Request-ID", id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+func isPrintableASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < 0x20 || s[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// newAuditEntry starts the audit entry for an authorized request. The
+// store completes it when it makes the change.
+func newAuditEntry(r *http.Request, action string) *AuditEntry {
+	return &AuditEntry{
+		Actor:     PrincipalFrom(r.Context()).Actor(),
+		Action:    action,
+		RequestID: RequestIDFrom(r.Context()),
+		ClientIP:  clientIP(r),
+	}
+}
+
+// actorOf returns the actor of e, or "" for a nil entry.
+func actorOf(e *AuditEntry) string {
+	if e == nil {
+		return ""
+	}
+	return e.Actor
+}
+
+// record sets the time, target and snapshots of e. A nil before or after
+// is stored as null.
+func (e *AuditEntry) record(target string, before, after interface{}) error {
+	e.Time = time.Now().UTC().Truncate(time.Second)
+	e.Target = target
+	e.Before, e.After = nil, nil
+
+	var err error
+	if before != nil {
+		if e.Before, err = json.Marshal(before); err != nil {
+			return err
+		}
+	}
+	if after != nil {
+		if e.After, err = json.Marshal(after); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func accountTarget(id uint32) string {
+	return "account:" + strconv.FormatUint(uint64(id), 10)
+}
+
+func customerTarget(id uint32) string {
+	return "customer:" + strconv.FormatUint(uint64(id), 10)
+}
+
+func transactionTarget(id uint64) string {
+	return "transaction:" + strconv.FormatUint(id, 10)
+}
+
+func apiKeyTarget(id uint64) string {
+	return "apikey:" + strconv.FormatUint(id, 10)
+}
+
+func (a *App) getAuditEntries(w http.ResponseWriter, r *http.Request) {
+	var v validator
+	f := parseAuditFilter(r, &v)
+	if !v.valid(w) {
+		return
+	}
+
+	// Fetch one extra row to learn whether there is a next page.
+	limit := f.Limit
+	f.Limit++
+
+	entries, err := a.Store.GetAuditEntries(f)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	page := AuditPage{Entries: entries}
+	if len(entries) > limit {
+		page.Entries = entries[:limit]
+		page.NextCursor = encodeCursor(strconv.FormatUint(entries[limit-1].AuditID, 10))
+	}
+
+	respondWithJSON(w, http.StatusOK, page)
+}
+
+// parseAuditFilter reads the GET /audit query parameters, recording every
+// invalid one in v.
+func parseAuditFilter(r *http.Request, v *validator) AuditFilter {
+	var f AuditFilter
+	q := r.URL.Query()
+
+	f.Limit = pageSize(r, v)
+
+	if c := q.Get("cursor"); c != "" {
+		values, err := decodeCursor(c, 1)
+		if err == nil {
+			f.BeforeID, err = strconv.ParseUint(values[0], 10, 64)
+		}
+		v.check(err == nil, "cursor", FieldInvalid, "is not a cursor from this endpoint")
+	}
+
+	f.Actor = q.Get("actor")
+	f.Action = q.Get("action")
+	f.Target = q.Get("target")
+	f.RequestID = q.Get("request_id")
+
+	v.timeParam(q, "from", &f.From)
+	v.timeParam(q, "to", &f.To)
+
+	return f
+}
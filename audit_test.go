@@ -0,0 +1,144 @@
+package main_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	. "github.com/mikeadityas/simple-cash-deposit-be"
+)
+
+func getAuditPage(t *testing.T, query string) AuditPage {
+	req, _ := http.NewRequest("GET", "/audit"+query, nil)
+	req.Header.Set("Authorization", "Bearer "+mintToken(RoleAuditor, "audrey", 0))
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+
+	var page AuditPage
+	json.Unmarshal(response.Body.Bytes(), &page)
+	return page
+}
+
+func TestAuditLog(t *testing.T) {
+	clearTable()
+
+	req, _ := http.NewRequest("POST", "/account", bytes.NewBufferString(`{"idcardno":"3171093101900001","name":"Michael","email":"michaeladityas@live.com"}`))
+	req.Header.Set("X-Request-ID", "req-1")
+	req.RemoteAddr = "203.0.113.9:5000"
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusCreated, response.Code)
+	if id := response.Header().Get("X-Request-ID"); id != "req-1" {
+		t.Errorf("Expected the request ID to be echoed. Got '%v'", id)
+	}
+
+	req, _ = http.NewRequest("POST", "/transaction", bytes.NewBufferString(`{"depositdest":1,"externalsource":"michaeladityas@live.com","amount":10}`))
+	req.Header.Set("Authorization", "Bearer "+mintToken(RoleTeller, "tina", 0))
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusCreated, response.Code)
+	generatedID := response.Header().Get("X-Request-ID")
+	if generatedID == "" {
+		t.Errorf("Expected a generated request ID")
+	}
+
+	page := getAuditPage(t, "")
+	if len(page.Entries) != 2 {
+		t.Fatalf("Expected 2 audit entries. Got %d", len(page.Entries))
+	}
+
+	deposit, account := page.Entries[0], page.Entries[1]
+	if account.Actor != "user:admin" || account.Action != AuditAccountCreate || account.Target != "account:1" ||
+		account.RequestID != "req-1" || account.ClientIP != "203.0.113.9" {
+		t.Errorf("Unexpected account audit entry %+v", account)
+	}
+	if string(account.Before) != "null" {
+		t.Errorf("Expected no before snapshot for a new account. Got %s", account.Before)
+	}
+	var after Account
+	json.Unmarshal(account.After, &after)
+	if after.Name != "Michael" || after.AccountID != 1 {
+		t.Errorf("Expected the new account as the after snapshot. Got %s", account.After)
+	}
+
+	if deposit.Actor != "user:tina" || deposit.Action != AuditDepositCreate || deposit.Target != "transaction:1" || deposit.RequestID != generatedID {
+		t.Errorf("Unexpected deposit audit entry %+v", deposit)
+	}
+}
+
+func TestAuditLogSkipsFailedChanges(t *testing.T) {
+	clearTable()
+
+	req, _ := http.NewRequest("POST", "/transaction", bytes.NewBufferString(`{"depositdest":9,"externalsource":"michaeladityas@live.com","amount":10}`))
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusNotFound, response.Code)
+
+	if page := getAuditPage(t, ""); len(page.Entries) != 0 {
+		t.Errorf("Expected no audit entries. Got %v", page.Entries)
+	}
+}
+
+func TestAuditLogSnapshots(t *testing.T) {
+	clearTable()
+
+	createAPIKey(t, `{"name":"kiosk","scopes":["account:read"]}`)
+	req, _ := http.NewRequest("DELETE", "/apikey/1", nil)
+	checkResponseCode(t, http.StatusOK, executeRequest(req).Code)
+
+	page := getAuditPage(t, "?action="+AuditAPIKeyRevoke)
+	if len(page.Entries) != 1 || page.Entries[0].Target != "apikey:1" {
+		t.Fatalf("Expected one revocation of apikey:1. Got %v", page.Entries)
+	}
+
+	var before, after map[string]interface{}
+	json.Unmarshal(page.Entries[0].Before, &before)
+	json.Unmarshal(page.Entries[0].After, &after)
+	if before["revoked"] != nil || after["revoked"] == nil {
+		t.Errorf("Expected snapshots before and after revocation. Got %v and %v", before, after)
+	}
+	if bytes.Contains(page.Entries[0].After, []byte("hash")) {
+		t.Errorf("Expected snapshots to leave out the key hash. Got %s", page.Entries[0].After)
+	}
+}
+
+func TestAuditLogFilters(t *testing.T) {
+	clearTable()
+	addAccount(1)
+
+	for i := 0; i < 3; i++ {
+		req, _ := http.NewRequest("POST", "/transaction", bytes.NewBufferString(`{"depositdest":1,"externalsource":"michaeladityas@live.com","amount":10}`))
+		checkResponseCode(t, http.StatusCreated, executeRequest(req).Code)
+	}
+	req, _ := http.NewRequest("POST", "/account/1/withdrawal", bytes.NewBufferString(`{"amount":1}`))
+	req.Header.Set("Authorization", "Bearer "+mintToken(RoleTeller, "tina", 0))
+	checkResponseCode(t, http.StatusCreated, executeRequest(req).Code)
+
+	if page := getAuditPage(t, "?actor=user:tina"); len(page.Entries) != 1 || page.Entries[0].Action != AuditWithdrawalCreate {
+		t.Errorf("Expected the withdrawal only. Got %v", page.Entries)
+	}
+	if page := getAuditPage(t, "?target=transaction:2"); len(page.Entries) != 1 || page.Entries[0].Target != "transaction:2" {
+		t.Errorf("Expected transaction 2 only. Got %v", page.Entries)
+	}
+
+	first := getAuditPage(t, "?action="+AuditDepositCreate+"&limit=2")
+	if len(first.Entries) != 2 || first.NextCursor == "" {
+		t.Fatalf("Expected a full first page with a cursor. Got %v", first)
+	}
+	second := getAuditPage(t, "?action="+AuditDepositCreate+"&limit=2&cursor="+first.NextCursor)
+	if len(second.Entries) != 1 || second.NextCursor != "" || second.Entries[0].Target != "transaction:1" {
+		t.Errorf("Expected the oldest deposit on the last page. Got %v", second)
+	}
+
+	req, _ = http.NewRequest("GET", "/audit?from=yesterday", nil)
+	checkResponseCode(t, http.StatusBadRequest, executeRequest(req).Code)
+}
+
+func TestAuditLogPermissions(t *testing.T) {
+	clearTable()
+
+	req, _ := http.NewRequest("GET", "/audit", nil)
+	req.Header.Set("Authorization", "Bearer "+mintToken(RoleTeller, "tina", 0))
+	checkResponseCode(t, http.StatusForbidden, executeRequest(req).Code)
+
+	req, _ = http.NewRequest("POST", "/apikey", bytes.NewBufferString(`{"name":"reader","scopes":["audit:read"]}`))
+	checkResponseCode(t, http.StatusBadRequest, executeRequest(req).Code)
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// Roles carried in the "role" claim.
+//
+// Admins may call every endpoint. Tellers handle cash: deposits,
+// withdrawals, transfers and reversals, and may look up single accounts.
+// Auditors may read everything and change nothing. Customers may read
+// their own account and history, transfer out of their own account and
+// choose its notifications.
+const (
+	RoleAdmin    = "admin"
+	RoleTeller   = "teller"
+	RoleAuditor  = "auditor"
+	RoleCustomer = "customer"
+)
+
+// Scopes name what a route does. Every route requires one; roles grant a
+// fixed set and API keys the set they were created with.
+const (
+	ScopeAccountsList        = "accounts:list"
+	ScopeAccountRead         = "account:read"
+	ScopeAccountCreate       = "account:create"
+	ScopeAccountUpdate       = "account:update"
+	ScopeNotificationsUpdate = "notifications:update"
+	ScopeCustomerRead        = "customer:read"
+	ScopeCustomerCreate      = "customer:create"
+	ScopeTransactionsRead    = "transactions:read"
+	ScopeDepositCreate       = "deposits:create"
+	ScopeTransferCreate      = "transfers:create"
+	ScopeWithdrawalCreate    = "withdrawals:create"
+	ScopeReversalCreate      = "reversals:create"
+	ScopeAPIKeysManage       = "apikeys:manage"
+	ScopeAuditRead           = "audit:read"
+)
+
+// APIKeyScopes are the scopes an API key may be given. Keys can never
+// manage other keys or read the audit log.
+var APIKeyScopes = []string{
+	ScopeAccountsList, ScopeAccountRead, ScopeAccountCreate, ScopeAccountUpdate, ScopeNotificationsUpdate, ScopeCustomerRead, ScopeCustomerCreate, ScopeTransactionsRead,
+	ScopeDepositCreate, ScopeTransferCreate, ScopeWithdrawalCreate, ScopeReversalCreate,
+}
+
+var roleScopes = map[string][]string{
+	RoleAdmin:    append([]string{ScopeAPIKeysManage, ScopeAuditRead}, APIKeyScopes...),
+	RoleTeller:   {ScopeAccountRead, ScopeDepositCreate, ScopeTransferCreate, ScopeWithdrawalCreate, ScopeReversalCreate},
+	RoleAuditor:  {ScopeAccountsList, ScopeAccountRead, ScopeCustomerRead, ScopeTransactionsRead, ScopeAuditRead},
+	RoleCustomer: {ScopeAccountRead, ScopeTransferCreate, ScopeNotificationsUpdate},
+}
+
+// Principal is the authenticated caller of a request: a user with a
+// bearer token, or an API key.
+type Principal struct {
+	Subject   string
+	Role      string
+	AccountID uint32
+	KeyID     uint64
+	Scopes    []string
+}
+
+// Actor identifies the principal in the records it creates, as
+// "user:<subject>" or "apikey:<id>".
+func (p *Principal) Actor() string {
+	if p.KeyID != 0 {
+		return "apikey:" + strconv.FormatUint(p.KeyID, 10)
+	}
+	return "user:" + p.Subject
+}
+
+func (p *Principal) can(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type principalKey struct{}
+
+// PrincipalFrom returns the caller authenticated by App.authorize, or nil.
+func PrincipalFrom(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalKey{}).(*Principal)
+	return p
+}
+
+// authorize wraps a handler so that it only runs for callers with a valid
+// bearer token or API key that grants scope. On routes with an
+// {accountid} variable, customers are further limited to their own
+// account. Routes keyed by {customerid} have no such check and must use a
+// customer:* scope, which customers are never granted.
+func (a *App) authorize(h http.HandlerFunc, scope string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p, ok := a.authenticate(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="simple-cash-deposit"`)
+			respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		if !p.can(scope) {
+			respondWithError(w, http.StatusForbidden, "Forbidden")
+			return
+		}
+
+		if id, ok := mux.Vars(r)["accountid"]; ok && p.Role == RoleCustomer {
+			if id != strconv.FormatUint(uint64(p.AccountID), 10) {
+				respondWithError(w, http.StatusForbidden, "Forbidden")
+				return
+			}
+		}
+
+		h(w, r.WithContext(context.WithValue(r.Context(), principalKey{}, p)))
+	}
+}
+
+// authenticate checks the request's bearer token or API key.
+func (a *App) authenticate(r *http.Request) (*Principal, bool) {
+	scheme, credentials := splitAuthorization(r.Header.Get("Authorization"))
+	switch {
+	case credentials == "":
+		return nil, false
+	case strings.EqualFold(scheme, "ApiKey"):
+		return a.authenticateAPIKey(credentials, clientIP(r))
+	case !strings.EqualFold(scheme, "Bearer"):
+		return nil, false
+	}
+
+	claims, err := a.Tokens.Verify(credentials)
+	if err != nil {
+		return nil, false
+	}
+
+	scopes, ok := roleScopes[claims.Role]
+	if !ok || claims.Subject == "" || claims.Role == RoleCustomer && claims.AccountID == 0 {
+		return nil, false
+	}
+
+	return &Principal{Subject: claims.Subject, Role: claims.Role, AccountID: claims.AccountID, Scopes: scopes}, true
+}
+
+// splitAuthorization splits an Authorization header into its scheme and
+// credentials.
+func splitAuthorization(header string) (scheme, credentials string) {
+	i := strings.IndexByte(header, ' ')
+	if i < 0 {
+		return header, ""
+	}
+	return header[:i], strings.TrimSpace(header[i+1:])
+}
+
+// clientIP is the address the request came from. Proxy headers are not
+// trusted.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,273 @@
+package main_test
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	. "github.com/mikeadityas/simple-cash-deposit-be"
+)
+
+func TestAuthenticationRequired(t *testing.T) {
+	clearTable()
+	addAccount(1)
+
+	expired, _ := MintToken(Claims{Subject: "admin", Role: RoleAdmin, ExpiresAt: time.Now().Add(-time.Hour).Unix()}, AlgHS256, testSecret)
+	forged, _ := MintToken(Claims{Subject: "admin", Role: RoleAdmin, ExpiresAt: time.Now().Add(time.Hour).Unix()}, AlgHS256, []byte("wrong-secret"))
+	noExpiry, _ := MintToken(Claims{Subject: "admin", Role: RoleAdmin}, AlgHS256, testSecret)
+	unknownRole, _ := MintToken(Claims{Subject: "root", Role: "root", ExpiresAt: time.Now().Add(time.Hour).Unix()}, AlgHS256, testSecret)
+	// A customer token without an account cannot be scoped.
+	noAccount := mintToken(RoleCustomer, "michael", 0)
+	// An unsigned token must never be accepted.
+	unsigned := "eyJhbGciOiJub25lIiwidHlwIjoiSldUIn0.eyJzdWIiOiJhZG1pbiIsInJvbGUiOiJhZG1pbiIsImV4cCI6NDEwMjQ0NDgwMH0."
+
+	for _, header := range []string{"Basic YWRtaW46YWRtaW4=", "Bearer", "Bearer " + expired, "Bearer " + forged, "Bearer " + noExpiry, "Bearer " + unknownRole, "Bearer " + noAccount, "Bearer " + unsigned} {
+		req, _ := http.NewRequest("GET", "/account/1", nil)
+		req.Header.Set("Authorization", header)
+		response := executeRequest(req)
+
+		checkResponseCode(t, http.StatusUnauthorized, response.Code)
+		if response.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("Expected a WWW-Authenticate header for %q", header)
+		}
+	}
+}
+
+func TestRolePermissions(t *testing.T) {
+	clearTable()
+	addAccount(2)
+	addTransaction(false, "michaeladityas@live.com", 1)
+
+	tests := []struct {
+		role    string
+		account uint32
+		method  string
+		path    string
+		body    string
+		code    int
+	}{
+		{RoleAuditor, 0, "GET", "/account", "", http.StatusOK},
+		{RoleAuditor, 0, "GET", "/transaction", "", http.StatusOK},
+		{RoleAuditor, 0, "GET", "/account/2/history", "", http.StatusOK},
+		{RoleAuditor, 0, "POST", "/transaction", `{"depositdest":1,"externalsource":"michaeladityas@live.com","amount":1}`, http.StatusForbidden},
+		{RoleAuditor, 0, "POST", "/account", `{"idcardno":"3171093101900001","name":"Michael","email":"michaeladityas@live.com"}`, http.StatusForbidden},
+
+		{RoleTeller, 0, "POST", "/transaction", `{"depositdest":1,"externalsource":"michaeladityas@live.com","amount":1}`, http.StatusCreated},
+		{RoleTeller, 0, "GET", "/account/2", "", http.StatusOK},
+		{RoleTeller, 0, "GET", "/account", "", http.StatusForbidden},
+		{RoleTeller, 0, "POST", "/account", `{"idcardno":"3171093101900001","name":"Michael","email":"michaeladityas@live.com"}`, http.StatusForbidden},
+
+		{RoleAdmin, 0, "POST", "/account", `{"idcardno":"3171093101900001","name":"Michael","email":"michaeladityas@live.com"}`, http.StatusCreated},
+
+		{RoleCustomer, 1, "GET", "/account/1", "", http.StatusOK},
+		{RoleCustomer, 1, "GET", "/account/1/history", "", http.StatusOK},
+		{RoleCustomer, 1, "GET", "/account/2", "", http.StatusForbidden},
+		{RoleCustomer, 1, "GET", "/account/2/history", "", http.StatusForbidden},
+		{RoleCustomer, 1, "GET", "/account", "", http.StatusForbidden},
+		{RoleCustomer, 1, "POST", "/transfer", `{"internalsource":1,"depositdest":2,"amount":1}`, http.StatusCreated},
+		{RoleCustomer, 1, "POST", "/transfer", `{"internalsource":2,"depositdest":1,"amount":1}`, http.StatusForbidden},
+		{RoleCustomer, 1, "POST", "/account/1/withdrawal", `{"amount":1}`, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		req, _ := http.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.body))
+		req.Header.Set("Authorization", "Bearer "+mintToken(tt.role, tt.role+"-test", tt.account))
+		response := executeRequest(req)
+
+		if response.Code != tt.code {
+			t.Errorf("%s %s as %s: expected response code %d. Got %d", tt.method, tt.path, tt.role, tt.code, response.Code)
+		}
+	}
+}
+
+func TestEdDSAToken(t *testing.T) {
+	clearTable()
+	addAccount(1)
+
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	a.Tokens = TokenVerifier{EdDSAKeys: []ed25519.PublicKey{pub}, Issuer: "cash-deposit", Audience: "api"}
+
+	claims := Claims{Subject: "auditor", Role: RoleAuditor, Issuer: "cash-deposit", ExpiresAt: time.Now().Add(time.Hour).Unix()}
+	wrongAudience, _ := MintToken(claims, AlgEdDSA, priv)
+
+	claims.Audience = []string{"other", "api"}
+	valid, _ := MintToken(claims, AlgEdDSA, priv)
+
+	// With only Ed25519 keys configured, HS256 tokens are rejected even if
+	// signed with the public key bytes.
+	confused, _ := MintToken(claims, AlgHS256, []byte(pub))
+
+	for token, code := range map[string]int{valid: http.StatusOK, wrongAudience: http.StatusUnauthorized, confused: http.StatusUnauthorized} {
+		req, _ := http.NewRequest("GET", "/account/1", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		response := executeRequest(req)
+
+		checkResponseCode(t, code, response.Code)
+	}
+}
+
+// createAPIKey creates a key as admin and returns the response body.
+func createAPIKey(t *testing.T, body string) map[string]interface{} {
+	req, _ := http.NewRequest("POST", "/apikey", bytes.NewBufferString(body))
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusCreated, response.Code)
+
+	var m map[string]interface{}
+	json.Unmarshal(response.Body.Bytes(), &m)
+	return m
+}
+
+// requestWithAPIKey sends a request from 192.0.2.1 authenticated with key.
+func requestWithAPIKey(method, path, body, key string) int {
+	req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+	req.RemoteAddr = "192.0.2.1:1234"
+	req.Header.Set("Authorization", "ApiKey "+key)
+	return executeRequest(req).Code
+}
+
+func TestCreateAPIKey(t *testing.T) {
+	clearTable()
+	addAccount(1)
+
+	key := createAPIKey(t, `{"name":"kiosk 1","scopes":["deposits:create","account:read"]}`)
+	secret, _ := key["key"].(string)
+	if secret == "" {
+		t.Fatalf("Expected the key in the response. Got %v", key)
+	}
+	if key["createdby"] != "user:admin" {
+		t.Errorf("Expected createdby to be 'user:admin'. Got '%v'", key["createdby"])
+	}
+
+	checkResponseCode(t, http.StatusOK, requestWithAPIKey("GET", "/account/1", "", secret))
+	checkResponseCode(t, http.StatusForbidden, requestWithAPIKey("GET", "/account", "", secret))
+	checkResponseCode(t, http.StatusForbidden, requestWithAPIKey("GET", "/apikey", "", secret))
+	checkResponseCode(t, http.StatusUnauthorized, requestWithAPIKey("GET", "/account/1", "", secret+"x"))
+
+	// The key is never listed, and neither is its hash.
+	req, _ := http.NewRequest("GET", "/apikey", nil)
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	if bytes.Contains(response.Body.Bytes(), []byte(secret)) || bytes.Contains(response.Body.Bytes(), []byte("hash")) {
+		t.Errorf("Expected the key list to leave out secrets. Got %s", response.Body.String())
+	}
+}
+
+func TestCreateAPIKeyValidation(t *testing.T) {
+	clearTable()
+
+	for _, body := range []string{
+		`{"name":"","scopes":["account:read"]}`,
+		`{"name":"kiosk","scopes":[]}`,
+		`{"name":"kiosk","scopes":["apikeys:manage"]}`,
+		`{"name":"kiosk","scopes":["account:read"],"allowedips":["not an ip"]}`,
+	} {
+		req, _ := http.NewRequest("POST", "/apikey", bytes.NewBufferString(body))
+		response := executeRequest(req)
+		checkResponseCode(t, http.StatusBadRequest, response.Code)
+	}
+
+	req, _ := http.NewRequest("POST", "/apikey", bytes.NewBufferString(`{"name":"kiosk","scopes":["account:read"]}`))
+	req.Header.Set("Authorization", "Bearer "+mintToken(RoleTeller, "teller", 0))
+	checkResponseCode(t, http.StatusForbidden, executeRequest(req).Code)
+}
+
+func TestAPIKeyAllowedIPs(t *testing.T) {
+	clearTable()
+	addAccount(1)
+
+	allowed := createAPIKey(t, `{"name":"branch","scopes":["account:read"],"allowedips":["192.0.2.0/24"]}`)
+	exact := createAPIKey(t, `{"name":"kiosk","scopes":["account:read"],"allowedips":["192.0.2.1"]}`)
+	denied := createAPIKey(t, `{"name":"elsewhere","scopes":["account:read"],"allowedips":["198.51.100.0/24","2001:db8::1"]}`)
+
+	checkResponseCode(t, http.StatusOK, requestWithAPIKey("GET", "/account/1", "", allowed["key"].(string)))
+	checkResponseCode(t, http.StatusOK, requestWithAPIKey("GET", "/account/1", "", exact["key"].(string)))
+	checkResponseCode(t, http.StatusUnauthorized, requestWithAPIKey("GET", "/account/1", "", denied["key"].(string)))
+}
+
+func TestRevokeAPIKey(t *testing.T) {
+	clearTable()
+	addAccount(1)
+
+	key := createAPIKey(t, `{"name":"kiosk","scopes":["account:read"]}`)
+	secret := key["key"].(string)
+
+	req, _ := http.NewRequest("DELETE", "/apikey/1", nil)
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+
+	var m map[string]interface{}
+	json.Unmarshal(response.Body.Bytes(), &m)
+	if m["revoked"] == nil {
+		t.Errorf("Expected the key to be revoked. Got %v", m)
+	}
+
+	checkResponseCode(t, http.StatusUnauthorized, requestWithAPIKey("GET", "/account/1", "", secret))
+
+	req, _ = http.NewRequest("POST", "/apikey/1/rotation", nil)
+	checkResponseCode(t, http.StatusConflict, executeRequest(req).Code)
+
+	req, _ = http.NewRequest("DELETE", "/apikey/2", nil)
+	checkResponseCode(t, http.StatusNotFound, executeRequest(req).Code)
+}
+
+func TestRotateAPIKey(t *testing.T) {
+	clearTable()
+	addAccount(1)
+
+	key := createAPIKey(t, `{"name":"kiosk","scopes":["account:read"]}`)
+	old := key["key"].(string)
+
+	req, _ := http.NewRequest("POST", "/apikey/1/rotation", nil)
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+
+	var m map[string]interface{}
+	json.Unmarshal(response.Body.Bytes(), &m)
+	rotated, _ := m["key"].(string)
+	if rotated == "" || rotated == old {
+		t.Fatalf("Expected a new key. Got %v", m)
+	}
+	if m["keyid"] != 1.0 || m["rotated"] == nil {
+		t.Errorf("Expected key 1 to be rotated in place. Got %v", m)
+	}
+
+	checkResponseCode(t, http.StatusUnauthorized, requestWithAPIKey("GET", "/account/1", "", old))
+	checkResponseCode(t, http.StatusOK, requestWithAPIKey("GET", "/account/1", "", rotated))
+}
+
+func TestTransactionCreatedBy(t *testing.T) {
+	clearTable()
+	addAccount(1)
+
+	key := createAPIKey(t, `{"name":"kiosk","scopes":["deposits:create"]}`)
+
+	code := requestWithAPIKey("POST", "/transaction", `{"depositdest":1,"externalsource":"michaeladityas@live.com","amount":10,"createdby":"someone else"}`, key["key"].(string))
+	checkResponseCode(t, http.StatusBadRequest, code)
+
+	code = requestWithAPIKey("POST", "/transaction", `{"depositdest":1,"externalsource":"michaeladityas@live.com","amount":10}`, key["key"].(string))
+	checkResponseCode(t, http.StatusCreated, code)
+
+	req, _ := http.NewRequest("POST", "/account/1/withdrawal", bytes.NewBufferString(`{"amount":1}`))
+	req.Header.Set("Authorization", "Bearer "+mintToken(RoleTeller, "tina", 0))
+	checkResponseCode(t, http.StatusCreated, executeRequest(req).Code)
+
+	req, _ = http.NewRequest("GET", "/transaction", nil)
+	response := executeRequest(req)
+
+	var page struct {
+		Transactions []map[string]interface{} `json:"transactions"`
+	}
+	json.Unmarshal(response.Body.Bytes(), &page)
+	transactions := page.Transactions
+	createdBy := map[interface{}]bool{}
+	for _, trans := range transactions {
+		createdBy[trans["createdby"]] = true
+	}
+	if len(transactions) != 2 || !createdBy["apikey:1"] || !createdBy["user:tina"] {
+		t.Errorf("Expected transactions created by 'apikey:1' and 'user:tina'. Got %v", transactions)
+	}
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// The transaction log is a hash chain: every row stores the hash of its
+// contents together with the hash of the row before it. Changing a row
+// changes its hash, and removing or inserting one breaks the link from the
+// next row. Someone able to rewrite the whole chain from the changed row
+// onward is caught by checkpoints: chain heads signed with a key that
+// never leaves the application host.
+//
+// Postings are not hashed, but they follow from the row: verification
+// rebuilds each row's postings from its kind, accounts and amount and
+// reports any that were changed. Account balances are checked against
+// the postings by the check-balances command.
+
+// ChainHead is the last row of the hash chain. Its hash is empty while
+// the chain is.
+type ChainHead struct {
+	TransactionID uint64 `json:"transid"`
+	Hash          string `json:"hash"`
+}
+
+// ChainLink is a transaction log row with the hashes and postings stored
+// with it.
+type ChainLink struct {
+	Transaction
+	PrevHash string
+	Hash     string
+	Postings []Posting
+}
+
+// chainHash hashes the stored fields of a transaction log row onto the
+// hash of the row before it.
+func chainHash(prev string, t Transaction) string {
+	data, _ := json.Marshal([]interface{}{
+		prev, t.TransactionID, t.Kind, t.ExternalSource, t.InternalSource, t.DepositDest,
+		int64(t.Amount), t.TransactionTime.Unix(), t.ReversalOf, t.ReasonCode, t.Operator, t.CreatedBy,
+	})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Checkpoint is a chain head signed with the ledger key.
+type Checkpoint struct {
+	CheckpointID  uint64    `json:"checkpointid"`
+	TransactionID uint64    `json:"transid"`
+	Hash          string    `json:"hash"`
+	CreatedAt     time.Time `json:"created"`
+
+	// Signature is the base64 Ed25519 signature of signedMessage.
+	Signature string `json:"signature"`
+}
+
+// signedMessage is what a checkpoint's signature covers.
+func (c *Checkpoint) signedMessage() []byte {
+	return []byte(fmt.Sprintf("simple-cash-deposit ledger checkpoint\n%d\n%s\n%d\n", c.TransactionID, c.Hash, c.CreatedAt.Unix()))
+}
+
+// ChainReport is the result of verifying the hash chain.
+type ChainReport struct {
+	Valid       bool        `json:"valid"`
+	Checked     int         `json:"checked"`
+	Checkpoints int         `json:"checkpoints"`
+	Head        ChainHead   `json:"head"`
+	FirstBreak  *ChainBreak `json:"firstbreak,omitempty"`
+}
+
+// ChainBreak is the first place the chain fails to verify.
+type ChainBreak struct {
+	TransactionID uint64 `json:"transid"`
+	Reason        string `json:"reason"`
+}
+
+const chainBatchSize = 500
+
+// DefaultCheckpointInterval is how often checkpoints are signed when
+// App.CheckpointInterval is not set.
+const DefaultCheckpointInterval = time.Hour
+
+var errNoLedgerKey = errors.New("no ledger signing key configured")
+
+// VerifyLedger walks the hash chain from the first row and reports the
+// first row that does not match its hash, its predecessor, its postings or
+// a checkpoint.
+// Checkpoint signatures are checked when key is not nil.
+func VerifyLedger(store Store, key ed25519.PublicKey) (*ChainReport, error) {
+	head, err := store.GetChainHead()
+	if err != nil {
+		return nil, err
+	}
+	checkpoints, err := store.GetCheckpoints()
+	if err != nil {
+		return nil, err
+	}
+	report := &ChainReport{Head: head, Checkpoints: len(checkpoints)}
+
+	broken := func(id uint64, reason string) (*ChainReport, error) {
+		report.FirstBreak = &ChainBreak{TransactionID: id, Reason: reason}
+		return report, nil
+	}
+
+	for _, c := range checkpoints {
+		sig, err := base64.StdEncoding.DecodeString(c.Signature)
+		if key != nil && (err != nil || !ed25519.Verify(key, c.signedMessage(), sig)) {
+			return broken(c.TransactionID, fmt.Sprintf("checkpoint %d has an invalid signature", c.CheckpointID))
+		}
+	}
+
+	prev := ""
+	var last uint64
+	pending := append([]Checkpoint(nil), checkpoints...)
+	sort.SliceStable(pending, func(i, j int) bool { return pending[i].TransactionID < pending[j].TransactionID })
+	for {
+		links, err := store.GetChainLinks(last, chainBatchSize)
+		if err != nil {
+			return nil, err
+		}
+		for _, l := range links {
+			id := l.TransactionID
+			switch {
+			case l.Hash == "":
+				return broken(id, "row is not hashed")
+			case chainHash(l.PrevHash, l.Transaction) != l.Hash:
+				return broken(id, "row does not match its hash")
+			case l.PrevHash != prev:
+				return broken(id, "previous row is missing or has changed")
+			}
+			want, err := entryPostings(store, l.Transaction)
+			if err != nil {
+				return nil, err
+			}
+			if !samePostings(want, l.Postings) {
+				return broken(id, "postings do not match the row")
+			}
+			for len(pending) > 0 && pending[0].TransactionID <= id {
+				c := pending[0]
+				if c.TransactionID < id {
+					return broken(c.TransactionID, fmt.Sprintf("row of checkpoint %d is missing", c.CheckpointID))
+				}
+				if c.Hash != l.Hash {
+					return broken(id, fmt.Sprintf("row does not match checkpoint %d", c.CheckpointID))
+				}
+				pending = pending[1:]
+			}
+			prev, last = l.Hash, id
+			report.Checked++
+		}
+		if len(links) < chainBatchSize {
+			break
+		}
+	}
+
+	if len(pending) > 0 {
+		return broken(pending[0].TransactionID, fmt.Sprintf("row of checkpoint %d is missing", pending[0].CheckpointID))
+	}
+	if last != head.TransactionID || prev != head.Hash {
+		return broken(head.TransactionID, "ledger does not end at its recorded head")
+	}
+
+	report.Valid = true
+	return report, nil
+}
+
+// entryPostings rebuilds the postings a transaction log row was written
+// with. A reversal's are those of the row it reverses, negated; that row
+// comes earlier in the chain. It returns nil if the row names no known
+// kind or reverses no earlier row.
+func entryPostings(store Store, t Transaction) ([]Posting, error) {
+	switch t.Kind {
+	case KindDeposit:
+		return depositPostings(t), nil
+	case KindTransfer:
+		return transferPostings(t), nil
+	case KindWithdrawal:
+		return withdrawalPostings(t), nil
+	case KindReversal:
+		if t.ReversalOf == 0 || t.ReversalOf >= t.TransactionID {
+			return nil, nil
+		}
+		links, err := store.GetChainLinks(t.ReversalOf-1, 1)
+		if err != nil || len(links) == 0 || links[0].TransactionID != t.ReversalOf {
+			return nil, err
+		}
+		original, err := entryPostings(store, links[0].Transaction)
+		if err != nil || original == nil {
+			return nil, err
+		}
+		return reversalPostings(original), nil
+	}
+	return nil, nil
+}
+
+// samePostings reports whether two sets of postings move the same amounts
+// on the same accounts, in any order.
+func samePostings(want, got []Posting) bool {
+	if want == nil || len(want) != len(got) {
+		return false
+	}
+	type leg struct {
+		account uint32
+		system  string
+		amount  Money
+	}
+	legs := map[leg]int{}
+	for _, p := range want {
+		legs[leg{p.AccountID, p.SystemAccount, p.Amount}]++
+	}
+	for _, p := range got {
+		k := leg{p.AccountID, p.SystemAccount, p.Amount}
+		if legs[k] == 0 {
+			return false
+		}
+		legs[k]--
+	}
+	return true
+}
+
+// CreateCheckpoint signs the current chain head and stores it. It returns
+// nil if the head has not moved since the last checkpoint.
+func (a *App) CreateCheckpoint() (*Checkpoint, error) {
+	if a.LedgerKey == nil {
+		return nil, errNoLedgerKey
+	}
+
+	head, err := a.Store.GetChainHead()
+	if err != nil {
+		return nil, err
+	}
+	checkpoints, err := a.Store.GetCheckpoints()
+	if err != nil {
+		return nil, err
+	}
+	if head.TransactionID == 0 || len(checkpoints) > 0 && checkpoints[len(checkpoints)-1].TransactionID == head.TransactionID {
+		return nil, nil
+	}
+
+	c := Checkpoint{TransactionID: head.TransactionID, Hash: head.Hash, CreatedAt: time.Now().UTC().Truncate(time.Second)}
+	c.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(a.LedgerKey, c.signedMessage()))
+	if err := a.Store.CreateCheckpoint(&c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (a *App) runCheckpoints(interval time.Duration) {
+	for range time.Tick(interval) {
+		if _, err := a.CreateCheckpoint(); err != nil {
+			log.Printf("checkpoint: %v", err)
+		}
+	}
+}
+
+// ledgerPublicKey returns the public half of the ledger key, or nil.
+func (a *App) ledgerPublicKey() ed25519.PublicKey {
+	if a.LedgerKey == nil {
+		return nil
+	}
+	return a.LedgerKey.Public().(ed25519.PublicKey)
+}
+
+// CheckpointExport is what auditors receive: every checkpoint and the PEM
+// public key that verifies them.
+type CheckpointExport struct {
+	PublicKey   string       `json:"publickey"`
+	Checkpoints []Checkpoint `json:"checkpoints"`
+}
+
+// ExportCheckpoints returns every checkpoint with the ledger public key.
+func (a *App) ExportCheckpoints() (*CheckpointExport, error) {
+	checkpoints, err := a.Store.GetCheckpoints()
+	if err != nil {
+		return nil, err
+	}
+
+	export := &CheckpointExport{Checkpoints: checkpoints}
+	if pub := a.ledgerPublicKey(); pub != nil {
+		der, err := x509.MarshalPKIXPublicKey(pub)
+		if err != nil {
+			return nil, err
+		}
+		export.PublicKey = string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	}
+	return export, nil
+}
+
+func (a *App) verifyLedger(w http.ResponseWriter, r *http.Request) {
+	report, err := VerifyLedger(a.Store, a.ledgerPublicKey())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, report)
+}
+
+func (a *App) getCheckpoints(w http.ResponseWriter, r *http.Request) {
+	export, err := a.ExportCheckpoints()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, export)
+}
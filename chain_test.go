@@ -0,0 +1,152 @@
+package main_test
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"database/sql"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/mikeadityas/simple-cash-deposit-be"
+)
+
+func verifyLedger(t *testing.T) ChainReport {
+	req, _ := http.NewRequest("GET", "/ledger/verification", nil)
+	req.Header.Set("Authorization", "Bearer "+mintToken(RoleAuditor, "audrey", 0))
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+
+	var report ChainReport
+	json.Unmarshal(response.Body.Bytes(), &report)
+	return report
+}
+
+func TestVerifyLedger(t *testing.T) {
+	clearTable()
+	addAccount(2)
+
+	requests := []struct{ path, body string }{
+		{"/transaction", `{"depositdest":1,"externalsource":"michaeladityas@live.com","amount":100}`},
+		{"/transaction", `{"depositdest":2,"internalsource":1,"amount":10}`},
+		{"/transfer", `{"internalsource":1,"depositdest":2,"amount":5}`},
+		{"/account/2/withdrawal", `{"amount":1}`},
+		{"/transaction/1/reversal", `{"reasoncode":"duplicate"}`},
+	}
+	for _, r := range requests {
+		req, _ := http.NewRequest("POST", r.path, bytes.NewBufferString(r.body))
+		checkResponseCode(t, http.StatusCreated, executeRequest(req).Code)
+	}
+
+	report := verifyLedger(t)
+	if !report.Valid || report.Checked != 5 || report.Head.TransactionID != 5 || len(report.Head.Hash) != 64 {
+		t.Errorf("Expected a valid chain of 5 rows. Got %+v", report)
+	}
+
+	req, _ := http.NewRequest("GET", "/ledger/verification", nil)
+	req.Header.Set("Authorization", "Bearer "+mintToken(RoleTeller, "tina", 0))
+	checkResponseCode(t, http.StatusForbidden, executeRequest(req).Code)
+}
+
+func TestLedgerCheckpoints(t *testing.T) {
+	clearTable()
+	addAccount(1)
+
+	if _, err := a.CreateCheckpoint(); err == nil {
+		t.Errorf("Expected an error without a ledger key")
+	}
+
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	a.LedgerKey = priv
+
+	if c, err := a.CreateCheckpoint(); c != nil || err != nil {
+		t.Errorf("Expected no checkpoint of an empty ledger. Got %v, %v", c, err)
+	}
+
+	addTransaction(false, "michaeladityas@live.com", 1)
+	c, err := a.CreateCheckpoint()
+	if err != nil || c == nil || c.TransactionID != 1 {
+		t.Fatalf("Expected a checkpoint at transaction 1. Got %v, %v", c, err)
+	}
+	if c, err := a.CreateCheckpoint(); c != nil || err != nil {
+		t.Errorf("Expected no checkpoint while the head has not moved. Got %v, %v", c, err)
+	}
+
+	req, _ := http.NewRequest("GET", "/ledger/checkpoints", nil)
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+
+	var export CheckpointExport
+	json.Unmarshal(response.Body.Bytes(), &export)
+	if len(export.Checkpoints) != 1 || export.Checkpoints[0].Hash != c.Hash {
+		t.Errorf("Expected the checkpoint to be exported. Got %+v", export)
+	}
+	block, _ := pem.Decode([]byte(export.PublicKey))
+	if block == nil {
+		t.Fatalf("Expected a PEM public key. Got %q", export.PublicKey)
+	}
+	key, _ := x509.ParsePKIXPublicKey(block.Bytes)
+	if !pub.Equal(key) {
+		t.Errorf("Expected the exported key to be the ledger public key")
+	}
+
+	if report := verifyLedger(t); !report.Valid || report.Checkpoints != 1 {
+		t.Errorf("Expected a valid chain with 1 checkpoint. Got %+v", report)
+	}
+}
+
+func TestLedgerTampering(t *testing.T) {
+	tests := []struct {
+		name    string
+		sql     string
+		transid uint64
+		reason  string
+	}{
+		{"edited row", `UPDATE transaction_log SET amount = 1 WHERE transaction_id = 2`, 2, "row does not match its hash"},
+		{"deleted row", `DELETE FROM posting WHERE transaction_id = 2; DELETE FROM transaction_log WHERE transaction_id = 2`, 3, "previous row is missing or has changed"},
+		{"deleted last row", `DELETE FROM posting WHERE transaction_id = 3; DELETE FROM transaction_log WHERE transaction_id = 3`, 3, "ledger does not end at its recorded head"},
+		{"inserted row", `INSERT INTO transaction_log (kind, source_external, destination, amount, transaction_time) VALUES ('deposit', 'x@mail.com', 1, 100, '2020-01-01 00:00:00')`, 4, "row is not hashed"},
+		{"edited postings", `UPDATE posting SET amount = amount + 1 WHERE transaction_id = 2 AND account_id = 1; UPDATE posting SET amount = amount - 1 WHERE transaction_id = 2 AND system_account = 'cash_vault'; UPDATE account SET balance = balance + 1 WHERE account_id = 1`, 2, "postings do not match the row"},
+		{"moved posting", `UPDATE posting SET account_id = 2 WHERE transaction_id = 3 AND account_id = 1`, 3, "postings do not match the row"},
+		{"forged checkpoint", `UPDATE ledger_checkpoint SET hash = (SELECT row_hash FROM transaction_log WHERE transaction_id = 1)`, 2, "checkpoint 1 has an invalid signature"},
+	}
+
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "ledger.db")
+		_, priv, _ := ed25519.GenerateKey(rand.Reader)
+		notifier = &RecorderNotifier{}
+		a = App{Notifier: notifier, Tokens: TokenVerifier{HMACSecret: testSecret}, LedgerKey: priv}
+		a.InitializeDriver("sqlite", path)
+
+		addAccount(2)
+		addTransaction(false, "michaeladityas@live.com", 1)
+		addTransaction(false, "michaeladityas@live.com", 1)
+		a.CreateCheckpoint()
+		addTransaction(false, "michaeladityas@live.com", 1)
+
+		if report := verifyLedger(t); !report.Valid {
+			t.Fatalf("%s: expected a valid chain before tampering. Got %+v", tt.name, report.FirstBreak)
+		}
+
+		db, err := sql.Open("sqlite3", path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, stmt := range strings.Split(tt.sql, ";") {
+			if _, err := db.Exec(stmt); err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+		}
+		db.Close()
+
+		report := verifyLedger(t)
+		if report.Valid || report.FirstBreak == nil || report.FirstBreak.TransactionID != tt.transid || report.FirstBreak.Reason != tt.reason {
+			t.Errorf("%s: expected a break at transaction %d: %s. Got %+v", tt.name, tt.transid, tt.reason, report.FirstBreak)
+		}
+	}
+}
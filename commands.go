@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// runCommand runs a maintenance subcommand against the app's store instead
+// of serving HTTP, and returns the process exit code.
+func runCommand(a *App, args []string, out io.Writer) int {
+	switch args[0] {
+	case "check-balances":
+		return checkBalancesCommand(a, args[1:], out)
+	case "mint-token":
+		return mintTokenCommand(args[1:], out)
+	case "verify-ledger":
+		return verifyLedgerCommand(a, out)
+	case "checkpoint":
+		return checkpointCommand(a, out)
+	case "export-checkpoints":
+		return exportCheckpointsCommand(a, out)
+	}
+
+	fmt.Fprintf(out, "unknown command %q\n", args[0])
+	return 2
+}
+
+// checkBalancesCommand reports journal entries whose postings do not sum
+// to zero and accounts whose stored balance has drifted from their
+// postings, and with -repair corrects the balances. It exits 1 when an
+// entry is unbalanced or drift was found and not repaired.
+func checkBalancesCommand(a *App, args []string, out io.Writer) int {
+	fs := flag.NewFlagSet("check-balances", flag.ContinueOnError)
+	fs.SetOutput(out)
+	repair := fs.Bool("repair", false, "overwrite drifted balances with the recomputed value")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	unbalanced, err := a.Store.FindUnbalancedEntries()
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return 1
+	}
+	for _, id := range unbalanced {
+		fmt.Fprintf(out, "transaction %d: postings do not balance\n", id)
+	}
+
+	drifts, err := a.Store.CheckBalances(*repair)
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return 1
+	}
+
+	for _, d := range drifts {
+		fmt.Fprintf(out, "account %d: stored %s, computed %s\n", d.AccountID, d.Stored, d.Computed)
+	}
+
+	switch {
+	case len(unbalanced) > 0:
+		return 1
+	case len(drifts) == 0:
+		fmt.Fprintln(out, "all balances match the ledger")
+	case *repair:
+		fmt.Fprintf(out, "repaired %d account(s)\n", len(drifts))
+	default:
+		return 1
+	}
+	return 0
+}
+
+// mintTokenCommand prints a signed JWT for local development and testing.
+// HS256 tokens are signed with JWT_HS256_SECRET, EdDSA tokens with the
+// PKCS #8 private key in the -key file.
+func mintTokenCommand(args []string, out io.Writer) int {
+	fs := flag.NewFlagSet("mint-token", flag.ContinueOnError)
+	fs.SetOutput(out)
+	sub := fs.String("sub", "", "subject, e.g. the user name")
+	role := fs.String("role", "", "admin, teller, auditor or customer")
+	account := fs.Uint("account", 0, "account ID, required for customers")
+	ttl := fs.Duration("ttl", time.Hour, "lifetime of the token")
+	alg := fs.String("alg", AlgHS256, "HS256 or EdDSA")
+	keyFile := fs.String("key", "", "Ed25519 private key PEM file, for EdDSA")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	var key interface{}
+	switch *alg {
+	case AlgHS256:
+		key = []byte(os.Getenv("JWT_HS256_SECRET"))
+	case AlgEdDSA:
+		data, err := ioutil.ReadFile(*keyFile)
+		if err != nil {
+			fmt.Fprintln(out, err)
+			return 1
+		}
+		if key, err = parseEd25519PrivateKey(data); err != nil {
+			fmt.Fprintln(out, err)
+			return 1
+		}
+	}
+
+	now := time.Now()
+	claims := Claims{
+		Subject:   *sub,
+		Role:      *role,
+		AccountID: uint32(*account),
+		Issuer:    os.Getenv("JWT_ISSUER"),
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(*ttl).Unix(),
+	}
+	if aud := os.Getenv("JWT_AUDIENCE"); aud != "" {
+		claims.Audience = audience{aud}
+	}
+
+	token, err := MintToken(claims, *alg, key)
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return 1
+	}
+
+	fmt.Fprintln(out, token)
+	return 0
+}
+
+// verifyLedgerCommand walks the transaction log hash chain and reports the
+// first broken link. It exits 1 if the chain does not verify.
+func verifyLedgerCommand(a *App, out io.Writer) int {
+	report, err := VerifyLedger(a.Store, a.ledgerPublicKey())
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return 1
+	}
+
+	if b := report.FirstBreak; b != nil {
+		fmt.Fprintf(out, "transaction %d: %s\n", b.TransactionID, b.Reason)
+		return 1
+	}
+	fmt.Fprintf(out, "ledger verified: %d row(s), %d checkpoint(s), head %d %s\n", report.Checked, report.Checkpoints, report.Head.TransactionID, report.Head.Hash)
+	return 0
+}
+
+// checkpointCommand signs a checkpoint of the current chain head with
+// LEDGER_SIGNING_KEY.
+func checkpointCommand(a *App, out io.Writer) int {
+	c, err := a.CreateCheckpoint()
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return 1
+	}
+
+	if c == nil {
+		fmt.Fprintln(out, "no new transactions since the last checkpoint")
+		return 0
+	}
+	fmt.Fprintf(out, "checkpoint %d: transaction %d %s\n", c.CheckpointID, c.TransactionID, c.Hash)
+	return 0
+}
+
+// exportCheckpointsCommand prints every checkpoint and the public key that
+// verifies them as JSON, for handing to auditors.
+func exportCheckpointsCommand(a *App, out io.Writer) int {
+	export, err := a.ExportCheckpoints()
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return 1
+	}
+
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(export); err != nil {
+		fmt.Fprintln(out, err)
+		return 1
+	}
+	return 0
+}
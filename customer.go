@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+// createCustomer registers a customer without opening an account; open
+// accounts for them with POST /account and their customerid.
+func (a *App) createCustomer(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		IDCard      string `json:"idcardno"`
+		Name        string `json:"name"`
+		Email       string `json:"email"`
+		Phone       string `json:"phone"`
+		DateOfBirth string `json:"dateofbirth"`
+	}
+	if !decodeRequest(w, r, &payload) {
+		return
+	}
+
+	c := Customer{
+		IDCard:      payload.IDCard,
+		Name:        NormalizeName(payload.Name),
+		Email:       payload.Email,
+		Phone:       payload.Phone,
+		DateOfBirth: payload.DateOfBirth,
+	}
+
+	var v validator
+	v.idCard(c.IDCard, "idcardno")
+	v.required(c.Name, "name", isValidName, nameRule)
+	v.required(c.Email, "email", isValidEmail, "must be an email address")
+	v.check(c.Phone == "" || isValidPhone(c.Phone), "phone", FieldInvalid, "must be 8 to 15 digits, optionally starting with +")
+	v.check(c.DateOfBirth == "" || isValidDateOfBirth(c.DateOfBirth), "dateofbirth", FieldInvalid, "must be a date as YYYY-MM-DD, not in the future")
+	if !v.valid(w) {
+		return
+	}
+
+	err := a.Store.CreateCustomer(&c, a.verificationEmail, newAuditEntry(r, AuditCustomerCreate))
+	if err != nil {
+		if errors.Is(err, ErrDuplicateCustomer) {
+			respondWithProblem(w, http.StatusBadRequest, []FieldError{{"idcardno", FieldDuplicate, "is already registered"}})
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, c)
+}
+
+func (a *App) getCustomer(w http.ResponseWriter, r *http.Request) {
+	customerid, ok := pathID(w, r, "customerid", 32)
+	if !ok {
+		return
+	}
+
+	c := Customer{CustomerID: uint32(customerid)}
+
+	err := a.Store.GetCustomer(&c)
+	if err != nil {
+		if errors.Is(err, ErrCustomerNotFound) {
+			respondWithError(w, http.StatusNotFound, "Customer not found")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, c)
+}
+
+func (a *App) getCustomerAccounts(w http.ResponseWriter, r *http.Request) {
+	customerid, ok := pathID(w, r, "customerid", 32)
+	if !ok {
+		return
+	}
+
+	accounts, err := a.Store.GetCustomerAccounts(uint32(customerid))
+	if err != nil {
+		if errors.Is(err, ErrCustomerNotFound) {
+			respondWithError(w, http.StatusNotFound, "Customer not found")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, accounts)
+}
+
+// jointHolders checks that every joint holder of acc is a customer ID
+// listed once and is not the owner.
+func (v *validator) jointHolders(acc Account) {
+	seen := map[uint32]bool{}
+	for i, id := range acc.JointHolders {
+		field := "jointholders." + strconv.Itoa(i)
+		switch {
+		case id == 0:
+			v.add(field, FieldInvalid, "must be a customer ID")
+		case id == acc.CustomerID:
+			v.add(field, FieldInvalid, "must not be the account's owner")
+		case seen[id]:
+			v.add(field, FieldDuplicate, "is listed more than once")
+		}
+		seen[id] = true
+	}
+}
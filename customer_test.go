@@ -0,0 +1,165 @@
+package main_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	. "github.com/mikeadityas/simple-cash-deposit-be"
+)
+
+func TestCreateCustomer(t *testing.T) {
+	clearTable()
+
+	for _, payload := range []string{
+		`{"idcardno":"123","name":"Michael","email":"michaeladityas@live.com"}`,
+		`{"idcardno":"3171093101900001","name":"Michael","email":"michaeladityas@live.com","phone":"12ab"}`,
+		`{"idcardno":"3171093101900001","name":"Michael","email":"michaeladityas@live.com","dateofbirth":"1990-02-30"}`,
+		`{"idcardno":"3171093101900001","name":"Michael","email":"michaeladityas@live.com","dateofbirth":"2999-01-01"}`,
+	} {
+		req, _ := http.NewRequest("POST", "/customer", bytes.NewBufferString(payload))
+		response := executeRequest(req)
+		checkResponseCode(t, http.StatusBadRequest, response.Code)
+	}
+
+	payload := `{"idcardno":"3171093101900001","name":"Michael","email":"michaeladityas@live.com","phone":"+6281234567890","dateofbirth":"1990-01-31"}`
+	req, _ := http.NewRequest("POST", "/customer", bytes.NewBufferString(payload))
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusCreated, response.Code)
+
+	var c Customer
+	json.Unmarshal(response.Body.Bytes(), &c)
+	if c.CustomerID != 1 || c.Phone != "+6281234567890" || c.DateOfBirth != "1990-01-31" {
+		t.Errorf("Unexpected customer %+v", c)
+	}
+
+	req, _ = http.NewRequest("POST", "/customer", bytes.NewBufferString(payload))
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusBadRequest, response.Code)
+
+	req, _ = http.NewRequest("GET", "/customer/1", nil)
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+
+	var fetched Customer
+	json.Unmarshal(response.Body.Bytes(), &fetched)
+	if fetched.IDCard != c.IDCard || fetched.DateOfBirth != c.DateOfBirth || fetched.Phone != c.Phone {
+		t.Errorf("Expected %+v. Got %+v", c, fetched)
+	}
+
+	req, _ = http.NewRequest("GET", "/customer/2", nil)
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusNotFound, response.Code)
+
+	if page := getAuditPage(t, "?target=customer:1"); len(page.Entries) != 1 || page.Entries[0].Action != AuditCustomerCreate {
+		t.Errorf("Expected a customer.create audit entry. Got %+v", page.Entries)
+	}
+}
+
+func TestCustomerWithSeveralAccounts(t *testing.T) {
+	clearTable()
+
+	req, _ := http.NewRequest("POST", "/account", bytes.NewBufferString(`{"idcardno":"3171093101900001","name":"Michael","email":"michaeladityas@live.com"}`))
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusCreated, response.Code)
+
+	var first Account
+	json.Unmarshal(response.Body.Bytes(), &first)
+	if first.CustomerID != 1 || first.ProductType != ProductSavings {
+		t.Errorf("Expected a savings account of customer 1. Got %+v", first)
+	}
+
+	req, _ = http.NewRequest("POST", "/account", bytes.NewBufferString(`{"customerid":1,"producttype":"current"}`))
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusCreated, response.Code)
+
+	var second Account
+	json.Unmarshal(response.Body.Bytes(), &second)
+	if second.AccountID != 2 || second.CustomerID != 1 || second.ProductType != ProductCurrent || second.IDCard != "3171093101900001" || second.Name != "Michael" {
+		t.Errorf("Expected a current account of customer 1. Got %+v", second)
+	}
+
+	req, _ = http.NewRequest("POST", "/account", bytes.NewBufferString(`{"customerid":1,"producttype":"deposito"}`))
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusBadRequest, response.Code)
+
+	req, _ = http.NewRequest("POST", "/account", bytes.NewBufferString(`{"customerid":9}`))
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusNotFound, response.Code)
+
+	req, _ = http.NewRequest("PATCH", "/account/2", bytes.NewBufferString(`{"name":"Michael Aditya"}`))
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+
+	acc := Account{AccountID: 1}
+	a.Store.GetAccount(&acc)
+	if acc.Name != "Michael Aditya" {
+		t.Errorf("Expected the new name on every account of the customer. Got '%v'", acc.Name)
+	}
+}
+
+func TestJointAccount(t *testing.T) {
+	clearTable()
+	addAccount(2)
+
+	for _, payload := range []string{
+		`{"customerid":1,"jointholders":[1]}`,
+		`{"customerid":1,"jointholders":[2,2]}`,
+		`{"customerid":1,"jointholders":[0]}`,
+	} {
+		req, _ := http.NewRequest("POST", "/account", bytes.NewBufferString(payload))
+		response := executeRequest(req)
+		checkResponseCode(t, http.StatusBadRequest, response.Code)
+	}
+
+	req, _ := http.NewRequest("POST", "/account", bytes.NewBufferString(`{"customerid":1,"jointholders":[9]}`))
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusNotFound, response.Code)
+
+	req, _ = http.NewRequest("POST", "/account", bytes.NewBufferString(`{"customerid":1,"jointholders":[2]}`))
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusCreated, response.Code)
+
+	var joint Account
+	json.Unmarshal(response.Body.Bytes(), &joint)
+	if joint.AccountID != 3 || len(joint.JointHolders) != 1 || joint.JointHolders[0] != 2 {
+		t.Errorf("Expected account 3 held jointly with customer 2. Got %+v", joint)
+	}
+
+	req, _ = http.NewRequest("GET", "/customer/2/account", nil)
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+
+	var accounts []Account
+	json.Unmarshal(response.Body.Bytes(), &accounts)
+	if len(accounts) != 2 || accounts[0].AccountID != 2 || accounts[1].AccountID != 3 {
+		t.Errorf("Expected customer 2 to hold accounts 2 and 3. Got %+v", accounts)
+	}
+
+	req, _ = http.NewRequest("GET", "/customer/3/account", nil)
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusNotFound, response.Code)
+}
+
+func TestCustomerPermissions(t *testing.T) {
+	clearTable()
+	addAccount(1)
+
+	req, _ := http.NewRequest("GET", "/customer/1", nil)
+	req.Header.Set("Authorization", "Bearer "+mintToken(RoleAuditor, "audrey", 0))
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+
+	for _, role := range []string{RoleTeller, RoleCustomer} {
+		req, _ = http.NewRequest("GET", "/customer/1", nil)
+		req.Header.Set("Authorization", "Bearer "+mintToken(role, "someone", 1))
+		response = executeRequest(req)
+		checkResponseCode(t, http.StatusForbidden, response.Code)
+	}
+
+	req, _ = http.NewRequest("POST", "/customer", bytes.NewBufferString(`{"idcardno":"3171093101900001","name":"Michael","email":"michaeladityas@live.com"}`))
+	req.Header.Set("Authorization", "Bearer "+mintToken(RoleAuditor, "audrey", 0))
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusForbidden, response.Code)
+}
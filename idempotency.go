@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"time"
+)
+
+// DefaultIdempotencyRetention is how long Idempotency-Key responses are kept
+// when App.IdempotencyRetention is not set.
+const DefaultIdempotencyRetention = 24 * time.Hour
+
+const maxIdempotencyKeyLength = 255
+
+// idempotent wraps a handler so that requests carrying an Idempotency-Key
+// header are processed at most once. A retry with the same key and request
+// replays the stored response; reusing the key for a different request, or
+// while the first one is still running, is a 409. Server errors and
+// requests that failed validation are not stored, so the client may retry
+// them with the same key. Keys belong to the caller that sent them: the
+// same key from another caller is a different request, and never replays
+// someone else's response. It must run inside authorize.
+func (a *App) idempotent(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		clientKey := r.Header.Get("Idempotency-Key")
+		if clientKey == "" {
+			h(w, r)
+			return
+		}
+
+		if len(clientKey) > maxIdempotencyKeyLength {
+			respondWithError(w, http.StatusBadRequest, "Invalid Idempotency-Key")
+			return
+		}
+		key := scopedIdempotencyKey(PrincipalFrom(r.Context()).Actor(), clientKey)
+
+		// Some endpoints, such as resending a verification email, take no
+		// body.
+		var body []byte
+		if r.Body != nil {
+			var err error
+			if body, err = ioutil.ReadAll(r.Body); err != nil {
+				respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+				return
+			}
+			r.Body.Close()
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		}
+
+		sum := sha256.Sum256([]byte(r.Method + " " + r.URL.Path + "\n" + string(body)))
+		hash := hex.EncodeToString(sum[:])
+
+		now := time.Now().UTC().Truncate(time.Second)
+		existing, err := a.Store.ReserveIdempotencyKey(IdempotencyRecord{
+			Key:         key,
+			RequestHash: hash,
+			CreatedAt:   now,
+		}, now.Add(-a.IdempotencyRetention))
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		if existing != nil {
+			switch {
+			case existing.RequestHash != hash:
+				respondWithError(w, http.StatusConflict, "Idempotency-Key was used for a different request")
+			case existing.StatusCode == 0:
+				respondWithError(w, http.StatusConflict, "A request with this Idempotency-Key is still in progress")
+			default:
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("Idempotent-Replayed", "true")
+				w.WriteHeader(existing.StatusCode)
+				w.Write(existing.Response)
+			}
+			return
+		}
+
+		rec := &responseCapture{ResponseWriter: w, status: http.StatusOK}
+		h(rec, r)
+
+		if rec.status >= 500 || rec.Header().Get("Content-Type") == problemContentType {
+			err = a.Store.ReleaseIdempotencyKey(key)
+		} else {
+			err = a.Store.CompleteIdempotencyKey(key, rec.status, rec.body.Bytes())
+		}
+		if err != nil {
+			log.Printf("idempotency key %q: %v", clientKey, err)
+		}
+	}
+}
+
+// scopedIdempotencyKey is the key a caller's Idempotency-Key is stored
+// under. Hashing keeps it within the column whatever the length of the
+// actor.
+func scopedIdempotencyKey(actor, key string) string {
+	sum := sha256.Sum256([]byte(actor + "\n" + key))
+	return hex.EncodeToString(sum[:])
+}
+
+// purgeIdempotencyKeys deletes expired Idempotency-Key records once per
+// interval, forever.
+func (a *App) purgeIdempotencyKeys(interval time.Duration) {
+	for range time.Tick(interval) {
+		err := a.Store.PurgeIdempotencyKeys(time.Now().UTC().Add(-a.IdempotencyRetention))
+		if err != nil {
+			log.Printf("purging idempotency keys: %v", err)
+		}
+	}
+}
+
+// responseCapture passes a response through while keeping a copy of its
+// status code and body.
+type responseCapture struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rc *responseCapture) WriteHeader(code int) {
+	rc.status = code
+	rc.ResponseWriter.WriteHeader(code)
+}
+
+func (rc *responseCapture) Write(b []byte) (int, error) {
+	rc.body.Write(b)
+	return rc.ResponseWriter.Write(b)
+}
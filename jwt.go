@@ -0,0 +1,238 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Claims are the JWT claims the API understands. Role is one of the Role*
+// constants; AccountID is required for RoleCustomer and names the only
+// account the customer may see.
+type Claims struct {
+	Subject   string `json:"sub"`
+	Role      string `json:"role"`
+	AccountID uint32 `json:"accountid,omitempty"`
+
+	Issuer    string   `json:"iss,omitempty"`
+	Audience  audience `json:"aud,omitempty"`
+	ExpiresAt int64    `json:"exp"`
+	NotBefore int64    `json:"nbf,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+}
+
+// audience is the "aud" claim, which may be a single string or an array.
+type audience []string
+
+func (a audience) MarshalJSON() ([]byte, error) {
+	if len(a) == 1 {
+		return json.Marshal(a[0])
+	}
+	return json.Marshal([]string(a))
+}
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var one string
+	if err := json.Unmarshal(data, &one); err == nil {
+		*a = audience{one}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(a))
+}
+
+// Signing algorithms accepted in the JWT "alg" header.
+const (
+	AlgHS256 = "HS256"
+	AlgEdDSA = "EdDSA"
+)
+
+// clockSkew is how far exp and nbf may be off from our clock.
+const clockSkew = 30 * time.Second
+
+var errInvalidToken = errors.New("invalid token")
+
+// TokenVerifier checks JWTs signed with a shared HS256 secret or with one
+// of a set of Ed25519 keys. A token is only checked against keys of the
+// algorithm named in its header, and an algorithm without keys is
+// rejected.
+type TokenVerifier struct {
+	HMACSecret []byte
+	EdDSAKeys  []ed25519.PublicKey
+	Issuer     string
+	Audience   string
+	Now        func() time.Time
+}
+
+// Configured reports whether any key has been set up.
+func (v *TokenVerifier) Configured() bool {
+	return len(v.HMACSecret) > 0 || len(v.EdDSAKeys) > 0
+}
+
+// Verify checks token's signature and time window, and its issuer and
+// audience if the verifier requires them, and returns its claims.
+func (v *TokenVerifier) Verify(token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errInvalidToken
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, errInvalidToken
+	}
+
+	signed := []byte(parts[0] + "." + parts[1])
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errInvalidToken
+	}
+
+	valid := false
+	switch header.Alg {
+	case AlgHS256:
+		if len(v.HMACSecret) > 0 {
+			mac := hmac.New(sha256.New, v.HMACSecret)
+			mac.Write(signed)
+			valid = hmac.Equal(sig, mac.Sum(nil))
+		}
+	case AlgEdDSA:
+		for _, key := range v.EdDSAKeys {
+			if ed25519.Verify(key, signed, sig) {
+				valid = true
+				break
+			}
+		}
+	}
+	if !valid {
+		return nil, errInvalidToken
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, errInvalidToken
+	}
+
+	now := time.Now()
+	if v.Now != nil {
+		now = v.Now()
+	}
+	if claims.ExpiresAt == 0 || now.Add(-clockSkew).Unix() >= claims.ExpiresAt {
+		return nil, errors.New("token expired")
+	}
+	if claims.NotBefore != 0 && now.Add(clockSkew).Unix() < claims.NotBefore {
+		return nil, errors.New("token not valid yet")
+	}
+	if v.Issuer != "" && claims.Issuer != v.Issuer {
+		return nil, errInvalidToken
+	}
+	if v.Audience != "" && !claims.Audience.contains(v.Audience) {
+		return nil, errInvalidToken
+	}
+	return &claims, nil
+}
+
+func (a audience) contains(aud string) bool {
+	for _, s := range a {
+		if s == aud {
+			return true
+		}
+	}
+	return false
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// MintToken signs claims as a JWT. key is a []byte secret for AlgHS256 or
+// an ed25519.PrivateKey for AlgEdDSA. It is used by the mint-token command
+// and by tests.
+func MintToken(claims Claims, alg string, key interface{}) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": alg, "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	var sig []byte
+	switch k := key.(type) {
+	case []byte:
+		if alg != AlgHS256 {
+			return "", fmt.Errorf("a secret cannot sign %s", alg)
+		}
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	case ed25519.PrivateKey:
+		if alg != AlgEdDSA {
+			return "", fmt.Errorf("an Ed25519 key cannot sign %s", alg)
+		}
+		sig = ed25519.Sign(k, []byte(signed))
+	default:
+		return "", fmt.Errorf("unsupported key type %T", key)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// parseEd25519PublicKeys reads every PKIX "PUBLIC KEY" block in a PEM file.
+func parseEd25519PublicKeys(data []byte) ([]ed25519.PublicKey, error) {
+	keys := []ed25519.PublicKey{}
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "PUBLIC KEY" {
+			continue
+		}
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		pub, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("public key is %T, not Ed25519", key)
+		}
+		keys = append(keys, pub)
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no PUBLIC KEY block found")
+	}
+	return keys, nil
+}
+
+// parseEd25519PrivateKey reads a PKCS #8 "PRIVATE KEY" PEM block.
+func parseEd25519PrivateKey(data []byte) (ed25519.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, errors.New("no PRIVATE KEY block found")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	priv, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private key is %T, not Ed25519", key)
+	}
+	return priv, nil
+}
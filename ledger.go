@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+)
+
+// The ledger is double-entry: every transaction_log row is a journal entry
+// whose postings sum to zero. Posting amounts are signed from the account
+// holder's side, so a positive posting raises a customer's balance and a
+// customer balance is the sum of its postings.
+//
+// Cash coming in from outside the bank is posted against CashVault, a
+// system account standing in for the physical cash. Its balance is minus
+// the cash the bank has taken in.
+
+// CashVault is the system account that balances cash deposits.
+const CashVault = "cash_vault"
+
+// Journal entry kinds, stored in transaction_log.kind.
+const (
+	KindDeposit    = "deposit"
+	KindTransfer   = "transfer"
+	KindWithdrawal = "withdrawal"
+	KindReversal   = "reversal"
+)
+
+// Posting is one leg of a journal entry. Exactly one of AccountID and
+// SystemAccount is set.
+type Posting struct {
+	PostingID     uint64 `json:"postingid"`
+	TransactionID uint64 `json:"transid"`
+	AccountID     uint32 `json:"accountid,omitempty"`
+	SystemAccount string `json:"systemaccount,omitempty"`
+	Amount        Money  `json:"amount"`
+}
+
+// ErrUnbalancedEntry is returned when the postings of a journal entry do
+// not sum to zero. It indicates a bug, never bad input.
+var ErrUnbalancedEntry = errors.New("journal entry does not balance")
+
+// checkBalanced verifies that postings form a valid journal entry.
+func checkBalanced(postings []Posting) error {
+	var sum Money
+	for _, p := range postings {
+		if (p.AccountID == 0) == (p.SystemAccount == "") {
+			return ErrUnbalancedEntry
+		}
+		sum += p.Amount
+	}
+	if len(postings) < 2 || sum != 0 {
+		return ErrUnbalancedEntry
+	}
+	return nil
+}
+
+// depositPostings credits the destination account with cash taken into the
+// vault. Deposits by account holders are cash deposits too; the source
+// account only identifies the depositor and is not debited.
+func depositPostings(trans Transaction) []Posting {
+	return []Posting{
+		{AccountID: trans.DepositDest, Amount: trans.Amount},
+		{SystemAccount: CashVault, Amount: -trans.Amount},
+	}
+}
+
+// transferPostings moves money from the source account to the destination
+// account. No system account is involved.
+func transferPostings(trans Transaction) []Posting {
+	return []Posting{
+		{AccountID: trans.DepositDest, Amount: trans.Amount},
+		{AccountID: trans.InternalSource, Amount: -trans.Amount},
+	}
+}
+
+// withdrawalPostings pays cash out of the vault to the holder of the
+// account stored as trans.DepositDest.
+func withdrawalPostings(trans Transaction) []Posting {
+	return []Posting{
+		{AccountID: trans.DepositDest, Amount: -trans.Amount},
+		{SystemAccount: CashVault, Amount: trans.Amount},
+	}
+}
+
+// reversalPostings undoes an entry by posting the opposite of every leg.
+func reversalPostings(original []Posting) []Posting {
+	postings := make([]Posting, len(original))
+	for i, p := range original {
+		postings[i] = Posting{AccountID: p.AccountID, SystemAccount: p.SystemAccount, Amount: -p.Amount}
+	}
+	return postings
+}
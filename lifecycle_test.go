@@ -0,0 +1,216 @@
+package main_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	. "github.com/mikeadityas/simple-cash-deposit-be"
+)
+
+func checkErrorCode(t *testing.T, body []byte, expected string) {
+	var m map[string]string
+	json.Unmarshal(body, &m)
+	if m["code"] != expected {
+		t.Errorf("Expected the error code to be '%s'. Got '%s'", expected, m["code"])
+	}
+}
+
+func TestUpdateAccount(t *testing.T) {
+	clearTable()
+	addAccount(1)
+
+	req, _ := http.NewRequest("PATCH", "/account/1", bytes.NewBufferString(`{"name":"M1ch4el"}`))
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusBadRequest, response.Code)
+
+	req, _ = http.NewRequest("PATCH", "/account/1", bytes.NewBufferString(`{"email":"not-an-email"}`))
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusBadRequest, response.Code)
+
+	req, _ = http.NewRequest("PATCH", "/account/2", bytes.NewBufferString(`{"name":"Michael"}`))
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusNotFound, response.Code)
+
+	req, _ = http.NewRequest("PATCH", "/account/1", bytes.NewBufferString(`{"email":"michaeladityas@live.com"}`))
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+
+	before := Account{AccountID: 1}
+	a.Store.GetAccount(&before)
+	if before.Email != "michaeladityas@live.com" {
+		t.Errorf("Expected the 'email' to be updated. Got '%v'", before.Email)
+	}
+
+	req, _ = http.NewRequest("PATCH", "/account/1", bytes.NewBufferString(`{"name":"Michael"}`))
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+
+	var acc Account
+	json.Unmarshal(response.Body.Bytes(), &acc)
+	if acc.Name != "Michael" || acc.Email != "michaeladityas@live.com" || acc.IDCard != before.IDCard {
+		t.Errorf("Expected only the 'name' to change. Got %+v", acc)
+	}
+
+	page := getAuditPage(t, "?action="+AuditAccountUpdate)
+	if len(page.Entries) != 2 {
+		t.Fatalf("Expected 2 account.update entries. Got %d", len(page.Entries))
+	}
+	var snapshot Account
+	json.Unmarshal(page.Entries[0].Before, &snapshot)
+	if snapshot.Name != before.Name {
+		t.Errorf("Expected the before snapshot to hold the old name. Got %s", page.Entries[0].Before)
+	}
+}
+
+func TestFreezeAccount(t *testing.T) {
+	clearTable()
+	addAccount(2)
+	addTransaction(false, "michaeladityas@live.com", 1)
+
+	req, _ := http.NewRequest("POST", "/account/1/freeze", bytes.NewBufferString(`{"reason":"Suspicious activity"}`))
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+
+	var acc Account
+	json.Unmarshal(response.Body.Bytes(), &acc)
+	if acc.Status != AccountFrozen {
+		t.Errorf("Expected the 'status' to be '%s'. Got '%s'", AccountFrozen, acc.Status)
+	}
+
+	req, _ = http.NewRequest("POST", "/account/1/freeze", nil)
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusConflict, response.Code)
+	checkErrorCode(t, response.Body.Bytes(), "invalid_status_change")
+
+	req, _ = http.NewRequest("POST", "/transaction", bytes.NewBufferString(`{"depositdest":1,"externalsource":"michaeladityas@live.com","amount":10}`))
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusUnprocessableEntity, response.Code)
+	checkErrorCode(t, response.Body.Bytes(), "account_frozen")
+
+	req, _ = http.NewRequest("POST", "/account/1/withdrawal", bytes.NewBufferString(`{"amount":10}`))
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusUnprocessableEntity, response.Code)
+	checkErrorCode(t, response.Body.Bytes(), "account_frozen")
+
+	req, _ = http.NewRequest("POST", "/transfer", bytes.NewBufferString(`{"internalsource":1,"depositdest":2,"amount":10}`))
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusUnprocessableEntity, response.Code)
+	checkErrorCode(t, response.Body.Bytes(), "account_frozen")
+
+	req, _ = http.NewRequest("POST", "/account/1/unfreeze", nil)
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+
+	req, _ = http.NewRequest("POST", "/account/1/unfreeze", nil)
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusConflict, response.Code)
+
+	req, _ = http.NewRequest("POST", "/transaction", bytes.NewBufferString(`{"depositdest":1,"externalsource":"michaeladityas@live.com","amount":10}`))
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusCreated, response.Code)
+}
+
+func TestCloseAccount(t *testing.T) {
+	clearTable()
+	addAccount(1)
+	addTransaction(false, "michaeladityas@live.com", 1)
+
+	req, _ := http.NewRequest("POST", "/account/1/close", nil)
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusUnprocessableEntity, response.Code)
+	checkErrorCode(t, response.Body.Bytes(), "balance_not_zero")
+
+	req, _ = http.NewRequest("POST", "/account/1/withdrawal", bytes.NewBufferString(`{"amount":100000}`))
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusCreated, response.Code)
+
+	req, _ = http.NewRequest("POST", "/account/1/close", bytes.NewBufferString(`{"reason":"Customer request"}`))
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+
+	req, _ = http.NewRequest("POST", "/transaction", bytes.NewBufferString(`{"depositdest":1,"externalsource":"michaeladityas@live.com","amount":10}`))
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusUnprocessableEntity, response.Code)
+	checkErrorCode(t, response.Body.Bytes(), "account_closed")
+
+	req, _ = http.NewRequest("PATCH", "/account/1", bytes.NewBufferString(`{"name":"Michael"}`))
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusUnprocessableEntity, response.Code)
+	checkErrorCode(t, response.Body.Bytes(), "account_closed")
+
+	for _, action := range []string{"freeze", "unfreeze", "close"} {
+		req, _ = http.NewRequest("POST", "/account/1/"+action, nil)
+		response = executeRequest(req)
+		checkResponseCode(t, http.StatusUnprocessableEntity, response.Code)
+		checkErrorCode(t, response.Body.Bytes(), "account_closed")
+	}
+}
+
+func TestAccountStatusHistory(t *testing.T) {
+	clearTable()
+	addAccount(1)
+
+	req, _ := http.NewRequest("POST", "/account/1/freeze", bytes.NewBufferString(`{"reason":"Lost card"}`))
+	req.Header.Set("Authorization", "Bearer "+mintToken(RoleAdmin, "ops", 0))
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+
+	req, _ = http.NewRequest("POST", "/account/1/unfreeze", nil)
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+
+	req, _ = http.NewRequest("POST", "/account/1/freeze", bytes.NewBufferString(`{"reason":"`+generateString(97, 122, 256)+`"}`))
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusBadRequest, response.Code)
+
+	req, _ = http.NewRequest("GET", "/account/1/status-history", nil)
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+
+	var history []AccountStatusChange
+	json.Unmarshal(response.Body.Bytes(), &history)
+	if len(history) != 3 {
+		t.Fatalf("Expected 3 status changes. Got %d", len(history))
+	}
+	if history[0].Status != AccountActive {
+		t.Errorf("Expected the first entry to record the opening. Got %+v", history[0])
+	}
+	if history[1].Status != AccountFrozen || history[1].Reason != "Lost card" || history[1].ChangedBy != "user:ops" {
+		t.Errorf("Unexpected freeze entry %+v", history[1])
+	}
+	if history[2].Status != AccountActive || history[2].ChangedBy != "user:admin" {
+		t.Errorf("Unexpected unfreeze entry %+v", history[2])
+	}
+
+	req, _ = http.NewRequest("GET", "/account/2/status-history", nil)
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusNotFound, response.Code)
+
+	if page := getAuditPage(t, "?target=account:1&action="+AuditAccountFreeze); len(page.Entries) != 1 {
+		t.Errorf("Expected 1 account.freeze entry. Got %d", len(page.Entries))
+	}
+}
+
+func TestAccountLifecyclePermissions(t *testing.T) {
+	clearTable()
+	addAccount(1)
+
+	for _, role := range []string{RoleTeller, RoleAuditor, RoleCustomer} {
+		req, _ := http.NewRequest("POST", "/account/1/freeze", nil)
+		req.Header.Set("Authorization", "Bearer "+mintToken(role, "someone", 1))
+		response := executeRequest(req)
+		checkResponseCode(t, http.StatusForbidden, response.Code)
+
+		req, _ = http.NewRequest("PATCH", "/account/1", bytes.NewBufferString(`{"name":"Michael"}`))
+		req.Header.Set("Authorization", "Bearer "+mintToken(role, "someone", 1))
+		response = executeRequest(req)
+		checkResponseCode(t, http.StatusForbidden, response.Code)
+	}
+
+	req, _ := http.NewRequest("GET", "/account/1/status-history", nil)
+	req.Header.Set("Authorization", "Bearer "+mintToken(RoleCustomer, "someone", 1))
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+}
@@ -1,8 +1,12 @@
 package main
 
 import (
+	"crypto/ed25519"
+	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -13,9 +17,188 @@ func main() {
 		log.Fatal("Error loading .env file")
 	}
 	a := App{}
-	a.Initialize(
-		os.Getenv("DB_USERNAME"),
-		os.Getenv("DB_PASSWORD"),
-		os.Getenv("DB_NAME"))
+
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = os.Getenv("SMTP_USER")
+	}
+	switch notifier := os.Getenv("NOTIFIER"); notifier {
+	case "", "smtp":
+		a.Notifier = &SMTPNotifier{
+			Server:   os.Getenv("SMTP_SERVER"),
+			Port:     os.Getenv("SMTP_PORT"),
+			Username: os.Getenv("SMTP_USER"),
+			Password: os.Getenv("SMTP_PASS"),
+			From:     from,
+		}
+	case "maildir":
+		a.Notifier = &MaildirNotifier{Dir: os.Getenv("NOTIFIER_PATH"), From: from}
+	case "mbox":
+		a.Notifier = &MboxNotifier{Path: os.Getenv("NOTIFIER_PATH"), From: from}
+	case "log":
+		a.Notifier = &LogNotifier{}
+	default:
+		log.Fatal("Unknown NOTIFIER: ", notifier)
+	}
+
+	if v := os.Getenv("IDEMPOTENCY_RETENTION"); v != "" {
+		a.IdempotencyRetention, err = time.ParseDuration(v)
+		if err != nil {
+			log.Fatal("Invalid IDEMPOTENCY_RETENTION: ", err)
+		}
+	}
+
+	a.DepositPolicy, err = loadDepositPolicy()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	a.Tokens, err = loadTokenVerifier()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	a.LedgerKey, a.CheckpointInterval, err = loadLedgerKey()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	a.EmailVerification, err = loadEmailVerification()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	switch driver := os.Getenv("DB_DRIVER"); driver {
+	case "", "mysql":
+		a.Initialize(
+			os.Getenv("DB_USERNAME"),
+			os.Getenv("DB_PASSWORD"),
+			os.Getenv("DB_NAME"))
+	case "memory":
+		a.InitializeWithStore(NewMemoryStore())
+	default:
+		a.InitializeDriver(driver, os.Getenv("DB_DSN"))
+	}
+
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(&a, os.Args[1:], os.Stdout))
+	}
+
 	a.Run(":" + os.Getenv("APP_PORT"))
 }
+
+// loadDepositPolicy reads the DEPOSIT_* limits. Unset limits are disabled.
+func loadDepositPolicy() (DepositPolicy, error) {
+	var p DepositPolicy
+	limits := []struct {
+		env   string
+		value *Money
+	}{
+		{"DEPOSIT_MIN_AMOUNT", &p.MinAmount},
+		{"DEPOSIT_MAX_AMOUNT", &p.MaxAmount},
+		{"DEPOSIT_DAILY_ACCOUNT_LIMIT", &p.DailyAccountLimit},
+		{"DEPOSIT_MONTHLY_ACCOUNT_LIMIT", &p.MonthlyAccountLimit},
+		{"DEPOSIT_DAILY_DEPOSITOR_LIMIT", &p.DailyDepositorLimit},
+		{"DEPOSIT_MONTHLY_DEPOSITOR_LIMIT", &p.MonthlyDepositorLimit},
+	}
+	for _, l := range limits {
+		v := os.Getenv(l.env)
+		if v == "" {
+			continue
+		}
+		m, err := ParseMoney(v)
+		if err != nil || m < 0 {
+			return p, fmt.Errorf("invalid %s: %q", l.env, v)
+		}
+		*l.value = m
+	}
+
+	if tz := os.Getenv("DEPOSIT_LIMIT_TIMEZONE"); tz != "" {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			return p, fmt.Errorf("invalid DEPOSIT_LIMIT_TIMEZONE: %v", err)
+		}
+		p.Location = loc
+	}
+	return p, nil
+}
+
+// loadTokenVerifier reads the JWT_* settings. At least one of the HS256
+// secret and the EdDSA public key file must be set.
+func loadTokenVerifier() (TokenVerifier, error) {
+	v := TokenVerifier{
+		HMACSecret: []byte(os.Getenv("JWT_HS256_SECRET")),
+		Issuer:     os.Getenv("JWT_ISSUER"),
+		Audience:   os.Getenv("JWT_AUDIENCE"),
+	}
+
+	if path := os.Getenv("JWT_EDDSA_PUBLIC_KEYS"); path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return v, err
+		}
+		v.EdDSAKeys, err = parseEd25519PublicKeys(data)
+		if err != nil {
+			return v, fmt.Errorf("invalid JWT_EDDSA_PUBLIC_KEYS: %v", err)
+		}
+	}
+
+	if !v.Configured() {
+		return v, fmt.Errorf("set JWT_HS256_SECRET or JWT_EDDSA_PUBLIC_KEYS")
+	}
+	return v, nil
+}
+
+// loadLedgerKey reads the LEDGER_* settings: the PKCS #8 Ed25519 key that
+// signs ledger checkpoints, which is optional, and how often to sign.
+func loadLedgerKey() (ed25519.PrivateKey, time.Duration, error) {
+	var interval time.Duration
+	if v := os.Getenv("LEDGER_CHECKPOINT_INTERVAL"); v != "" {
+		var err error
+		interval, err = time.ParseDuration(v)
+		if err != nil || interval <= 0 {
+			return nil, 0, fmt.Errorf("invalid LEDGER_CHECKPOINT_INTERVAL: %q", v)
+		}
+	}
+
+	path := os.Getenv("LEDGER_SIGNING_KEY")
+	if path == "" {
+		return nil, interval, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	key, err := parseEd25519PrivateKey(data)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid LEDGER_SIGNING_KEY: %v", err)
+	}
+	return key, interval, nil
+}
+
+// loadEmailVerification reads the EMAIL_VERIFICATION_* settings and what to
+// do with notifications for unverified addresses.
+func loadEmailVerification() (EmailVerification, error) {
+	v := EmailVerification{
+		Secret:     []byte(os.Getenv("EMAIL_VERIFICATION_SECRET")),
+		Unverified: os.Getenv("UNVERIFIED_EMAIL_NOTIFICATIONS"),
+		BaseURL:    os.Getenv("PUBLIC_URL"),
+	}
+	if len(v.Secret) == 0 {
+		return v, fmt.Errorf("set EMAIL_VERIFICATION_SECRET")
+	}
+	switch v.Unverified {
+	case "", UnverifiedHold, UnverifiedSuppress:
+	default:
+		return v, fmt.Errorf("invalid UNVERIFIED_EMAIL_NOTIFICATIONS: %q", v.Unverified)
+	}
+
+	if ttl := os.Getenv("EMAIL_VERIFICATION_TTL"); ttl != "" {
+		var err error
+		v.TTL, err = time.ParseDuration(ttl)
+		if err != nil || v.TTL <= 0 {
+			return v, fmt.Errorf("invalid EMAIL_VERIFICATION_TTL: %q", ttl)
+		}
+	}
+	return v, nil
+}
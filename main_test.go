@@ -3,38 +3,32 @@ package main_test
 import (
 	"bytes"
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
 	"math/rand"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
-	"github.com/joho/godotenv"
 	. "github.com/mikeadityas/simple-cash-deposit-be"
 )
 
 var a App
+var notifier *RecorderNotifier
 
 func TestMain(m *testing.M) {
-	err := godotenv.Load()
-	if err != nil {
-		log.Fatal("Error loading .env file")
-	}
-
-	a = App{}
-	a.Initialize(
-		os.Getenv("TEST_DB_USERNAME"),
-		os.Getenv("TEST_DB_PASSWORD"),
-		os.Getenv("TEST_DB_NAME"))
+	// The handler tests run against a MemoryStore and only queue deposit
+	// notifications in the outbox, so no .env is needed.
 
-	ensureTableExists()
 	rand.Seed(time.Now().UnixNano())
 	code := m.Run()
 
-	clearTable()
-
 	os.Exit(code)
 }
 
@@ -46,8 +40,68 @@ func TestEmptyTable(t *testing.T) {
 
 	checkResponseCode(t, http.StatusOK, response.Code)
 
-	if body := response.Body.String(); body != "[]" {
-		t.Errorf("Expected an empty array. Got %s", body)
+	if body := response.Body.String(); body != `{"accounts":[],"total":0,"next_cursor":""}` {
+		t.Errorf("Expected an empty page. Got %s", body)
+	}
+}
+
+func TestListAccounts(t *testing.T) {
+	clearTable()
+
+	for i, name := range []string{"Bob", "alice", "Albert", "Carol"} {
+		a.Store.CreateAccount(&Account{IDCard: fmt.Sprintf("123456789012345%d", i), Name: name, Email: strings.ToLower(name) + "@mail.com"}, nil, nil)
+	}
+	addTransaction(false, "michaeladityas@live.com", 4)
+	addTransaction(false, "michaeladityas@live.com", 4)
+	addTransaction(false, "michaeladityas@live.com", 1)
+
+	listNames := func(query string) ([]string, int) {
+		names := []string{}
+		total := 0
+		cursor := ""
+		for page := 0; page < 10; page++ {
+			req, _ := http.NewRequest("GET", "/account?limit=1&"+query+"&cursor="+cursor, nil)
+			response := executeRequest(req)
+
+			checkResponseCode(t, http.StatusOK, response.Code)
+
+			var m AccountPage
+			json.Unmarshal(response.Body.Bytes(), &m)
+			for _, acc := range m.Accounts {
+				names = append(names, acc.Name)
+			}
+			total = m.Total
+
+			if cursor = m.NextCursor; cursor == "" {
+				break
+			}
+		}
+		return names, total
+	}
+
+	cases := map[string]string{
+		"":                                     "[Bob alice Albert Carol] 4",
+		"sort=registered&order=desc":           "[Carol Albert alice Bob] 4",
+		"sort=balance&order=desc":              "[Carol Bob Albert alice] 4",
+		"name=al":                              "[alice Albert] 2",
+		"name=AL&sort=name":                    "[Albert alice] 2",
+		"email=CAROL@mail.com":                 "[Carol] 1",
+		"idcardno=1234567890123451":            "[alice] 1",
+		"registered_from=2999-01-01T00:00:00Z": "[] 0",
+		"registered_to=2999-01-01T00:00:00Z":   "[Bob alice Albert Carol] 4",
+	}
+	for query, expected := range cases {
+		names, total := listNames(query)
+		if got := fmt.Sprint(names, " ", total); got != expected {
+			t.Errorf("Expected %s for %q. Got %s", expected, query, got)
+		}
+	}
+
+	for _, query := range []string{"sort=email", "order=up", "limit=1000", "cursor=abc", "registered_from=today"} {
+		req, _ := http.NewRequest("GET", "/account?"+query, nil)
+		response := executeRequest(req)
+
+		checkResponseCode(t, http.StatusBadRequest, response.Code)
 	}
 }
 
@@ -78,8 +132,8 @@ func TestGetAccountAndBalance(t *testing.T) {
 	var acc Account
 	acc = Account{}
 	json.Unmarshal(response.Body.Bytes(), &acc)
-	if acc.Balance != float64(0) {
-		t.Errorf("Expected the 'balance' to be set to 0.00. Got '%.2f'", acc.Balance)
+	if acc.Balance != Money(0) {
+		t.Errorf("Expected the 'balance' to be set to 0. Got '%s'", acc.Balance)
 	}
 
 	addTransaction(false, "michaeladityas@gmail.com", 1)
@@ -90,15 +144,44 @@ func TestGetAccountAndBalance(t *testing.T) {
 	checkResponseCode(t, http.StatusOK, response.Code)
 
 	json.Unmarshal(response.Body.Bytes(), &acc)
-	if acc.Balance != float64(100000) {
-		t.Errorf("Expected the 'balance' to be set to 100000.00. Got '%.2f'", acc.Balance)
+	if acc.Balance != Money(100000*MinorUnits) {
+		t.Errorf("Expected the 'balance' to be set to 100000. Got '%s'", acc.Balance)
+	}
+}
+
+func TestConcurrentDepositsKeepBalance(t *testing.T) {
+	clearTable()
+	addAccount(1)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			payload := []byte(`{"depositdest":1,"externalsource":"michaeladityas@live.com","amount":"1000.01"}`)
+			req, _ := http.NewRequest("POST", "/transaction", bytes.NewBuffer(payload))
+			response := executeRequest(req)
+			checkResponseCode(t, http.StatusCreated, response.Code)
+		}()
+	}
+	wg.Wait()
+
+	acc := Account{AccountID: 1}
+	a.Store.GetAccount(&acc)
+	if acc.Balance != Money(20*100001) {
+		t.Errorf("Expected the 'balance' to be set to 20000.20. Got '%s'", acc.Balance)
+	}
+
+	drifts, err := a.Store.CheckBalances(false)
+	if err != nil || len(drifts) != 0 {
+		t.Errorf("Expected no balance drift. Got %v, %v", drifts, err)
 	}
 }
 
 func TestCreateDuplicateAccount(t *testing.T) {
 	clearTable()
 
-	idCard := generateString(48, 57, 16)
+	idCard := generateNIK()
 	name := generateString(97, 122, 7)
 	email := name + "@mail.com"
 
@@ -125,14 +208,7 @@ func TestCreateDuplicateAccount(t *testing.T) {
 	}
 
 	req, _ = http.NewRequest("POST", "/account", bytes.NewBuffer(payload))
-	response = executeRequest(req)
-
-	checkResponseCode(t, http.StatusBadRequest, response.Code)
-
-	json.Unmarshal(response.Body.Bytes(), &m)
-	if m["error"] != "Account exists!" {
-		t.Errorf("Expected the 'error' message of the response to be set to 'Account exists!'. Got '%s'", m["error"])
-	}
+	checkProblem(t, executeRequest(req), map[string]string{"idcardno": FieldDuplicate})
 }
 
 func TestCreateAccountInvalidIDCardNumber(t *testing.T) {
@@ -147,19 +223,13 @@ func TestCreateAccountInvalidIDCardNumber(t *testing.T) {
 	req, _ := http.NewRequest("POST", "/account", bytes.NewBuffer(payload))
 	response := executeRequest(req)
 
-	checkResponseCode(t, http.StatusBadRequest, response.Code)
-
-	var m map[string]interface{}
-	json.Unmarshal(response.Body.Bytes(), &m)
-	if m["error"] != "Invalid ID Card" {
-		t.Errorf("Expected the 'error' message of the response to be set to 'Invalid ID Card'. Got '%s'", m["error"])
-	}
+	checkProblem(t, response, map[string]string{"idcardno": NIKFormat})
 }
 
 func TestCreateAccountInvalidName(t *testing.T) {
 	clearTable()
 
-	idCard := generateString(48, 57, 16)
+	idCard := generateNIK()
 	name := "th3nun"
 	email := name + "@mail.com"
 
@@ -168,19 +238,13 @@ func TestCreateAccountInvalidName(t *testing.T) {
 	req, _ := http.NewRequest("POST", "/account", bytes.NewBuffer(payload))
 	response := executeRequest(req)
 
-	checkResponseCode(t, http.StatusBadRequest, response.Code)
-
-	var m map[string]interface{}
-	json.Unmarshal(response.Body.Bytes(), &m)
-	if m["error"] != "Invalid Name" {
-		t.Errorf("Expected the 'error' message of the response to be set to 'Invalid Name'. Got '%s'", m["error"])
-	}
+	checkProblem(t, response, map[string]string{"name": FieldInvalid})
 }
 
 func TestCreateAccountInvalidEmail(t *testing.T) {
 	clearTable()
 
-	idCard := generateString(48, 57, 16)
+	idCard := generateNIK()
 	name := generateString(97, 122, 7)
 	email := name + "mail.com"
 
@@ -189,13 +253,7 @@ func TestCreateAccountInvalidEmail(t *testing.T) {
 	req, _ := http.NewRequest("POST", "/account", bytes.NewBuffer(payload))
 	response := executeRequest(req)
 
-	checkResponseCode(t, http.StatusBadRequest, response.Code)
-
-	var m map[string]interface{}
-	json.Unmarshal(response.Body.Bytes(), &m)
-	if m["error"] != "Invalid Email Address" {
-		t.Errorf("Expected the 'error' message of the response to be set to 'Invalid Email Address'. Got '%s'", m["error"])
-	}
+	checkProblem(t, response, map[string]string{"email": FieldInvalid})
 }
 
 func TestCreateDepositFromRegisteredAccount(t *testing.T) {
@@ -203,12 +261,7 @@ func TestCreateDepositFromRegisteredAccount(t *testing.T) {
 	addAccount(1)
 
 	// Create account with valid Email, so we can also test email functionality
-	q := `INSERT INTO account
-				(id_card_number, name, email)
-				VALUES
-				("1234567890123456","Michael","mike.sutiono@gmail.com")
-		`
-	a.DB.Exec(q)
+	a.Store.CreateAccount(&Account{IDCard: "1234567890123456", Name: "Michael", Email: "mike.sutiono@gmail.com", EmailVerified: true}, nil, nil)
 
 	payload := []byte(`{"depositdest":1,"internalsource":2,"amount":3879000}`)
 
@@ -228,10 +281,16 @@ func TestCreateDepositFromRegisteredAccount(t *testing.T) {
 		t.Errorf("Expected internalsource to be 2. Got %v", m["internalsource"])
 	}
 
-	if m["amount"] != 3879000.0 {
+	if m["amount"] != "3879000" {
 		t.Errorf("Expected amount to be 3879000. Got %v", m["amount"])
 	}
 
+	dest := Account{AccountID: 1}
+	a.Store.GetAccount(&dest)
+	checkQueuedNotifications(t,
+		Notification{Recipient: "mike.sutiono@gmail.com", Body: "You have successfully deposited 3879000 to account number 1. Ref No. #1"},
+		Notification{Recipient: dest.Email, Body: "Your account number 1 has received a deposit of 3879000. Your new balance is 3879000. Ref No. #1"},
+	)
 }
 
 func TestCreateDepositFromUnregisteredAccount(t *testing.T) {
@@ -256,10 +315,758 @@ func TestCreateDepositFromUnregisteredAccount(t *testing.T) {
 		t.Errorf("Expected internalsource to be michaeladityas@live.com. Got %v", m["externalsource"])
 	}
 
-	if m["amount"] != 3879000.0 {
+	if m["amount"] != "3879000" {
 		t.Errorf("Expected amount to be 3879000. Got %v", m["amount"])
 	}
 
+	dest := Account{AccountID: 1}
+	a.Store.GetAccount(&dest)
+	checkQueuedNotifications(t,
+		Notification{Recipient: "michaeladityas@live.com", Body: "You have successfully deposited 3879000 to account number 1. Ref No. #1"},
+		Notification{Recipient: dest.Email, Body: "Your account number 1 has received a deposit of 3879000. Your new balance is 3879000. Ref No. #1"},
+	)
+}
+
+func TestDepositPostsBalancedEntry(t *testing.T) {
+	clearTable()
+	addAccount(1)
+
+	payload := []byte(`{"depositdest":1,"externalsource":"michaeladityas@live.com","amount":"2500.50"}`)
+
+	req, _ := http.NewRequest("POST", "/transaction", bytes.NewBuffer(payload))
+	response := executeRequest(req)
+
+	checkResponseCode(t, http.StatusCreated, response.Code)
+
+	req, _ = http.NewRequest("GET", "/transaction/1/postings", nil)
+	response = executeRequest(req)
+
+	checkResponseCode(t, http.StatusOK, response.Code)
+
+	var postings []Posting
+	json.Unmarshal(response.Body.Bytes(), &postings)
+
+	if len(postings) != 2 {
+		t.Fatalf("Expected 2 postings. Got %v", postings)
+	}
+	if postings[0].AccountID != 1 || postings[0].Amount != 250050 {
+		t.Errorf("Expected account 1 to be credited 2500.50. Got %+v", postings[0])
+	}
+	if postings[1].SystemAccount != CashVault || postings[1].Amount != -250050 {
+		t.Errorf("Expected the cash vault to be debited 2500.50. Got %+v", postings[1])
+	}
+
+	unbalanced, err := a.Store.FindUnbalancedEntries()
+	if err != nil || len(unbalanced) != 0 {
+		t.Errorf("Expected no unbalanced entries. Got %v, %v", unbalanced, err)
+	}
+
+	req, _ = http.NewRequest("GET", "/transaction/2/postings", nil)
+	response = executeRequest(req)
+
+	checkResponseCode(t, http.StatusNotFound, response.Code)
+}
+
+func TestCreateTransfer(t *testing.T) {
+	clearTable()
+	addAccount(2)
+	addTransaction(false, "michaeladityas@live.com", 1)
+
+	payload := []byte(`{"internalsource":1,"depositdest":2,"amount":"40000.25"}`)
+
+	req, _ := http.NewRequest("POST", "/transfer", bytes.NewBuffer(payload))
+	response := executeRequest(req)
+
+	checkResponseCode(t, http.StatusCreated, response.Code)
+
+	var trans Transaction
+	json.Unmarshal(response.Body.Bytes(), &trans)
+
+	if trans.Kind != KindTransfer || trans.TransactionID != 2 {
+		t.Errorf("Expected transfer #2. Got %+v", trans)
+	}
+
+	src, dest := Account{AccountID: 1}, Account{AccountID: 2}
+	a.Store.GetAccount(&src)
+	a.Store.GetAccount(&dest)
+	if src.Balance != 5999975 || dest.Balance != 4000025 {
+		t.Errorf("Expected balances 59999.75 and 40000.25. Got %s and %s", src.Balance, dest.Balance)
+	}
+
+	postings, _ := a.Store.GetPostings(2)
+	if len(postings) != 2 || postings[0].AccountID != 2 || postings[1].AccountID != 1 || postings[0].Amount+postings[1].Amount != 0 {
+		t.Errorf("Expected a balanced entry between accounts 1 and 2. Got %+v", postings)
+	}
+
+	msgs, _ := a.Store.GetOutboxMessages(OutboxPending)
+	if len(msgs) != 2 {
+		t.Fatalf("Expected 2 pending notifications. Got %d", len(msgs))
+	}
+	if msgs[0].Recipient != src.Email || msgs[0].Body != "You have successfully transferred 40000.25 from account number 1 to account number 2. Ref No. #2" {
+		t.Errorf("Unexpected sender notification %+v", msgs[0].Notification)
+	}
+	if msgs[1].Recipient != dest.Email || msgs[1].Body != "You have received 40000.25 from account number 1 to account number 2. Your new balance is 40000.25. Ref No. #2" {
+		t.Errorf("Unexpected recipient notification %+v", msgs[1].Notification)
+	}
+}
+
+func TestCreateTransferRejected(t *testing.T) {
+	clearTable()
+	addAccount(2)
+	addTransaction(false, "michaeladityas@live.com", 1)
+
+	tests := []struct {
+		payload string
+		code    int
+		message string
+	}{
+		{`{"internalsource":1,"depositdest":2,"amount":100000.01}`, http.StatusUnprocessableEntity, "Insufficient funds"},
+		{`{"internalsource":1,"depositdest":1,"amount":1}`, http.StatusBadRequest, "Source and destination must be different accounts"},
+		{`{"internalsource":1,"depositdest":3,"amount":1}`, http.StatusNotFound, "Invalid Account ID"},
+	}
+
+	for _, tt := range tests {
+		req, _ := http.NewRequest("POST", "/transfer", bytes.NewBufferString(tt.payload))
+		response := executeRequest(req)
+
+		checkResponseCode(t, tt.code, response.Code)
+
+		var m map[string]string
+		json.Unmarshal(response.Body.Bytes(), &m)
+		if m["error"] != tt.message {
+			t.Errorf("%s: expected the 'error' key to be set to '%s'. Got '%s'", tt.payload, tt.message, m["error"])
+		}
+	}
+
+	invalid := []struct {
+		payload string
+		errors  map[string]string
+	}{
+		{`{"externalsource":"michaeladityas@live.com","depositdest":2,"amount":1}`, map[string]string{"externalsource": FieldUnknown}},
+		{`{"depositdest":2,"amount":0}`, map[string]string{"internalsource": FieldRequired, "amount": FieldInvalid}},
+	}
+
+	for _, tt := range invalid {
+		req, _ := http.NewRequest("POST", "/transfer", bytes.NewBufferString(tt.payload))
+		checkProblem(t, executeRequest(req), tt.errors)
+	}
+
+	acc := Account{AccountID: 1}
+	a.Store.GetAccount(&acc)
+	if acc.Balance != Money(100000*MinorUnits) {
+		t.Errorf("Expected the source balance to be unchanged. Got '%s'", acc.Balance)
+	}
+}
+
+func TestConcurrentTransfersNeverOverdraw(t *testing.T) {
+	clearTable()
+	addAccount(2)
+	addTransaction(false, "michaeladityas@live.com", 1)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	created := 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// Alternate directions to exercise the lock ordering.
+			payload := `{"internalsource":1,"depositdest":2,"amount":30000}`
+			if i%2 == 1 {
+				payload = `{"internalsource":2,"depositdest":1,"amount":1}`
+			}
+			req, _ := http.NewRequest("POST", "/transfer", bytes.NewBufferString(payload))
+			response := executeRequest(req)
+			if response.Code == http.StatusCreated && i%2 == 0 {
+				mu.Lock()
+				created++
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	acc := Account{AccountID: 1}
+	a.Store.GetAccount(&acc)
+	if acc.Balance < 0 || created > 3 {
+		t.Errorf("Expected at most 3 transfers of 30000 from 100000. Got %d, balance %s", created, acc.Balance)
+	}
+
+	drifts, err := a.Store.CheckBalances(false)
+	if err != nil || len(drifts) != 0 {
+		t.Errorf("Expected no balance drift. Got %v, %v", drifts, err)
+	}
+}
+
+func TestCreateWithdrawal(t *testing.T) {
+	clearTable()
+	addAccount(1)
+	addTransaction(false, "michaeladityas@live.com", 1)
+
+	payload := []byte(`{"amount":"25000.50"}`)
+
+	req, _ := http.NewRequest("POST", "/account/1/withdrawal", bytes.NewBuffer(payload))
+	response := executeRequest(req)
+
+	checkResponseCode(t, http.StatusCreated, response.Code)
+
+	var trans Transaction
+	json.Unmarshal(response.Body.Bytes(), &trans)
+
+	if trans.Kind != KindWithdrawal || trans.DepositDest != 1 || trans.Amount != 2500050 {
+		t.Errorf("Expected a withdrawal of 25000.50 from account 1. Got %+v", trans)
+	}
+
+	acc := Account{AccountID: 1}
+	a.Store.GetAccount(&acc)
+	if acc.Balance != 7499950 {
+		t.Errorf("Expected the 'balance' to be set to 74999.50. Got '%s'", acc.Balance)
+	}
+
+	checkQueuedNotification(t, acc.Email, "You have successfully withdrawn 25000.50 from account number 1. Ref No. #2")
+
+	req, _ = http.NewRequest("POST", "/account/1/withdrawal", bytes.NewBufferString(`{"amount":75000}`))
+	response = executeRequest(req)
+
+	checkResponseCode(t, http.StatusUnprocessableEntity, response.Code)
+
+	req, _ = http.NewRequest("POST", "/account/2/withdrawal", bytes.NewBufferString(`{"amount":1}`))
+	response = executeRequest(req)
+
+	checkResponseCode(t, http.StatusNotFound, response.Code)
+}
+
+func TestWithdrawalOverdraftLimit(t *testing.T) {
+	clearTable()
+	a.Store.CreateAccount(&Account{IDCard: "1234567890123456", Name: "Michael", Email: "michaeladityas@live.com", OverdraftLimit: 500 * MinorUnits}, nil, nil)
+
+	req, _ := http.NewRequest("POST", "/account/1/withdrawal", bytes.NewBufferString(`{"amount":500}`))
+	response := executeRequest(req)
+
+	checkResponseCode(t, http.StatusCreated, response.Code)
+
+	req, _ = http.NewRequest("POST", "/account/1/withdrawal", bytes.NewBufferString(`{"amount":0.01}`))
+	response = executeRequest(req)
+
+	checkResponseCode(t, http.StatusUnprocessableEntity, response.Code)
+
+	req, _ = http.NewRequest("GET", "/account/1", nil)
+	response = executeRequest(req)
+
+	var acc Account
+	json.Unmarshal(response.Body.Bytes(), &acc)
+	if acc.Balance != -500*MinorUnits || acc.OverdraftLimit != 500*MinorUnits {
+		t.Errorf("Expected balance -500 with overdraft limit 500. Got %s and %s", acc.Balance, acc.OverdraftLimit)
+	}
+}
+
+func TestConcurrentWithdrawalsNeverOverdraw(t *testing.T) {
+	clearTable()
+	addAccount(1)
+	addTransaction(false, "michaeladityas@live.com", 1)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 12; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req, _ := http.NewRequest("POST", "/account/1/withdrawal", bytes.NewBufferString(`{"amount":10000}`))
+			executeRequest(req)
+		}()
+	}
+	wg.Wait()
+
+	acc := Account{AccountID: 1}
+	a.Store.GetAccount(&acc)
+	if acc.Balance != 0 {
+		t.Errorf("Expected exactly 10 withdrawals to succeed. Got balance '%s'", acc.Balance)
+	}
+}
+
+func TestHistoryDirection(t *testing.T) {
+	clearTable()
+	addAccount(2)
+	addTransaction(false, "michaeladityas@live.com", 1)
+
+	a.Store.CreateTransfer(&Transaction{InternalSource: 1, DepositDest: 2, Amount: 100 * MinorUnits}, nil, nil)
+	a.Store.CreateWithdrawal(&Transaction{DepositDest: 1, Amount: 50 * MinorUnits}, nil, nil)
+
+	req, _ := http.NewRequest("GET", "/account/1/history", nil)
+	response := executeRequest(req)
+
+	checkResponseCode(t, http.StatusOK, response.Code)
+
+	var history []Transaction
+	json.Unmarshal(response.Body.Bytes(), &history)
+
+	want := []struct {
+		kind, direction string
+	}{
+		{KindWithdrawal, DirectionDebit},
+		{KindTransfer, DirectionDebit},
+		{KindDeposit, DirectionCredit},
+	}
+	if len(history) != len(want) {
+		t.Fatalf("Expected %d history entries. Got %d", len(want), len(history))
+	}
+	for i, w := range want {
+		if history[i].Kind != w.kind || history[i].Direction != w.direction {
+			t.Errorf("Entry %d: expected %s %s. Got %s %s", i, w.kind, w.direction, history[i].Kind, history[i].Direction)
+		}
+	}
+
+	req, _ = http.NewRequest("GET", "/account/2/history", nil)
+	response = executeRequest(req)
+
+	json.Unmarshal(response.Body.Bytes(), &history)
+	if len(history) != 1 || history[0].Direction != DirectionCredit {
+		t.Errorf("Expected one incoming transfer. Got %+v", history)
+	}
+}
+
+func TestReverseDeposit(t *testing.T) {
+	clearTable()
+	addAccount(1)
+	addTransaction(false, "michaeladityas@live.com", 1)
+
+	payload := []byte(`{"reasoncode":"wrong_amount"}`)
+
+	req, _ := http.NewRequest("POST", "/transaction/1/reversal", bytes.NewBuffer(payload))
+	req.Header.Set("Authorization", "Bearer "+mintToken(RoleTeller, "teller-07", 0))
+	response := executeRequest(req)
+
+	checkResponseCode(t, http.StatusCreated, response.Code)
+
+	var reversal Transaction
+	json.Unmarshal(response.Body.Bytes(), &reversal)
+
+	if reversal.Kind != KindReversal || reversal.ReversalOf != 1 || reversal.ReasonCode != "wrong_amount" || reversal.Operator != "teller-07" || reversal.Amount != 100000*MinorUnits {
+		t.Errorf("Expected a reversal of transaction 1. Got %+v", reversal)
+	}
+
+	acc := Account{AccountID: 1}
+	a.Store.GetAccount(&acc)
+	if acc.Balance != 0 {
+		t.Errorf("Expected the 'balance' to be set to 0. Got '%s'", acc.Balance)
+	}
+
+	postings, _ := a.Store.GetPostings(reversal.TransactionID)
+	if len(postings) != 2 || postings[0].AccountID != 1 || postings[0].Amount != -100000*MinorUnits || postings[1].SystemAccount != CashVault {
+		t.Errorf("Expected the deposit postings to be negated. Got %+v", postings)
+	}
+
+	req, _ = http.NewRequest("GET", "/account/1/history", nil)
+	response = executeRequest(req)
+
+	var history []Transaction
+	json.Unmarshal(response.Body.Bytes(), &history)
+
+	if len(history) != 2 {
+		t.Fatalf("Expected 2 history entries. Got %d", len(history))
+	}
+	if history[0].Kind != KindReversal || history[0].Direction != DirectionDebit || history[0].Status != StatusPosted {
+		t.Errorf("Expected the reversal to be a posted debit. Got %+v", history[0])
+	}
+	if history[1].TransactionID != 1 || history[1].Status != StatusReversed || history[1].Amount != 100000*MinorUnits {
+		t.Errorf("Expected the original deposit to be unchanged but reversed. Got %+v", history[1])
+	}
+
+	req, _ = http.NewRequest("POST", "/transaction/1/reversal", bytes.NewBuffer(payload))
+	response = executeRequest(req)
+
+	checkResponseCode(t, http.StatusConflict, response.Code)
+
+	req, _ = http.NewRequest("POST", "/transaction/2/reversal", bytes.NewBuffer(payload))
+	response = executeRequest(req)
+
+	checkResponseCode(t, http.StatusUnprocessableEntity, response.Code)
+}
+
+func TestReverseTransfer(t *testing.T) {
+	clearTable()
+	addAccount(2)
+	addTransaction(false, "michaeladityas@live.com", 1)
+	a.Store.CreateTransfer(&Transaction{InternalSource: 1, DepositDest: 2, Amount: 300 * MinorUnits}, nil, nil)
+
+	payload := []byte(`{"reasoncode":"wrong_account"}`)
+
+	req, _ := http.NewRequest("POST", "/transaction/2/reversal", bytes.NewBuffer(payload))
+	response := executeRequest(req)
+
+	checkResponseCode(t, http.StatusCreated, response.Code)
+
+	src, dest := Account{AccountID: 1}, Account{AccountID: 2}
+	a.Store.GetAccount(&src)
+	a.Store.GetAccount(&dest)
+	if src.Balance != 100000*MinorUnits || dest.Balance != 0 {
+		t.Errorf("Expected the transfer to be undone. Got balances %s and %s", src.Balance, dest.Balance)
+	}
+
+	unbalanced, _ := a.Store.FindUnbalancedEntries()
+	drifts, _ := a.Store.CheckBalances(false)
+	if len(unbalanced) != 0 || len(drifts) != 0 {
+		t.Errorf("Expected a consistent ledger. Got %v and %v", unbalanced, drifts)
+	}
+}
+
+func TestReverseTransactionInvalid(t *testing.T) {
+	clearTable()
+	addAccount(1)
+	addTransaction(false, "michaeladityas@live.com", 1)
+
+	tests := []struct {
+		path    string
+		payload string
+		code    int
+		message string
+	}{
+		{"/transaction/9/reversal", `{"reasoncode":"duplicate"}`, http.StatusNotFound, "Transaction not found"},
+	}
+
+	for _, tt := range tests {
+		req, _ := http.NewRequest("POST", tt.path, bytes.NewBufferString(tt.payload))
+		response := executeRequest(req)
+
+		checkResponseCode(t, tt.code, response.Code)
+
+		var m map[string]string
+		json.Unmarshal(response.Body.Bytes(), &m)
+		if m["error"] != tt.message {
+			t.Errorf("%s: expected the 'error' key to be set to '%s'. Got '%s'", tt.payload, tt.message, m["error"])
+		}
+	}
+
+	req, _ := http.NewRequest("POST", "/transaction/1/reversal", bytes.NewBufferString(`{}`))
+	checkProblem(t, executeRequest(req), map[string]string{"reasoncode": FieldRequired})
+
+	req, _ = http.NewRequest("POST", "/transaction/1/reversal", bytes.NewBufferString(`{"reasoncode":"oops"}`))
+	checkProblem(t, executeRequest(req), map[string]string{"reasoncode": FieldInvalid})
+}
+
+func TestConcurrentDepositsRespectDepositorLimit(t *testing.T) {
+	clearTable()
+	addAccount(10)
+	a.DepositPolicy = DepositPolicy{DailyDepositorLimit: 3000 * MinorUnits}
+
+	// Ten deposits of 1000 from one depositor into ten accounts: only
+	// three fit under the limit, whatever order they run in.
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	codes := map[int]int{}
+	for i := 1; i <= 10; i++ {
+		wg.Add(1)
+		go func(dest int) {
+			defer wg.Done()
+			payload := fmt.Sprintf(`{"depositdest":%d,"externalsource":"michaeladityas@live.com","amount":1000}`, dest)
+			req, _ := http.NewRequest("POST", "/transaction", bytes.NewBufferString(payload))
+			response := executeRequest(req)
+			mu.Lock()
+			codes[response.Code]++
+			mu.Unlock()
+		}(i)
+	}
+	wg.Wait()
+
+	if codes[http.StatusCreated] != 3 || codes[http.StatusUnprocessableEntity] != 7 {
+		t.Errorf("Expected 3 deposits accepted and 7 over the limit. Got %v", codes)
+	}
+}
+
+func TestDepositPolicy(t *testing.T) {
+	clearTable()
+	addAccount(2)
+	a.DepositPolicy = DepositPolicy{
+		MinAmount:             10 * MinorUnits,
+		MaxAmount:             1000 * MinorUnits,
+		DailyAccountLimit:     1500 * MinorUnits,
+		MonthlyDepositorLimit: 2000 * MinorUnits,
+	}
+
+	deposit := func(payload string) map[string]interface{} {
+		req, _ := http.NewRequest("POST", "/transaction", bytes.NewBufferString(payload))
+		response := executeRequest(req)
+
+		var m map[string]interface{}
+		json.Unmarshal(response.Body.Bytes(), &m)
+		m["code"] = response.Code
+		return m
+	}
+
+	tests := []struct {
+		payload string
+		rule    string
+		used    string
+	}{
+		{`{"depositdest":1,"externalsource":"michaeladityas@live.com","amount":9.99}`, RuleMinAmount, "0"},
+		{`{"depositdest":1,"externalsource":"michaeladityas@live.com","amount":1000.01}`, RuleMaxAmount, "0"},
+		{`{"depositdest":1,"externalsource":"michaeladityas@live.com","amount":1000}`, "", "0"},
+		{`{"depositdest":1,"internalsource":2,"amount":500.01}`, RuleDailyAccountLimit, "1000"},
+		{`{"depositdest":1,"internalsource":2,"amount":500}`, "", "0"},
+		{`{"depositdest":2,"externalsource":"MichaelAdityaS@live.com","amount":1000}`, "", "0"},
+		{`{"depositdest":2,"externalsource":"michaeladityas@live.com","amount":10}`, RuleMonthlyDepositorLimit, "2000"},
+		{`{"depositdest":2,"externalsource":"someone@live.com","amount":10}`, "", "0"},
+	}
+
+	for _, tt := range tests {
+		m := deposit(tt.payload)
+		if tt.rule == "" {
+			if m["code"] != http.StatusCreated {
+				t.Errorf("%s: expected the deposit to be accepted. Got %v", tt.payload, m)
+			}
+			continue
+		}
+		if m["code"] != http.StatusUnprocessableEntity || m["rule"] != tt.rule || m["used"] != tt.used {
+			t.Errorf("%s: expected rule %s with %v used. Got %v", tt.payload, tt.rule, tt.used, m)
+		}
+	}
+
+	// A reversed deposit no longer counts towards the limits.
+	a.Store.ReverseTransaction(&Transaction{ReversalOf: 1, ReasonCode: "duplicate", Operator: "teller-07"}, nil)
+	if m := deposit(`{"depositdest":1,"externalsource":"michaeladityas@live.com","amount":1000}`); m["code"] != http.StatusCreated {
+		t.Errorf("Expected the deposit to be accepted after the reversal. Got %v", m)
+	}
+}
+
+func TestDispatchOutboxDeliversDepositNotification(t *testing.T) {
+	clearTable()
+	addAccount(1)
+
+	payload := []byte(`{"depositdest":1,"externalsource":"michaeladityas@live.com","amount":1325000.5}`)
+
+	req, _ := http.NewRequest("POST", "/transaction", bytes.NewBuffer(payload))
+	response := executeRequest(req)
+
+	checkResponseCode(t, http.StatusCreated, response.Code)
+
+	if len(notifier.Sent()) != 0 {
+		t.Errorf("Expected nothing to be sent before the outbox is dispatched")
+	}
+
+	if err := a.DispatchOutbox(); err != nil {
+		t.Fatal(err)
+	}
+
+	dest := Account{AccountID: 1}
+	a.Store.GetAccount(&dest)
+	expected := []Notification{{
+		Kind:      "deposit_made",
+		Recipient: "michaeladityas@live.com",
+		Subject:   "Cash Deposit Notification",
+		Body:      "You have successfully deposited 1325000.50 to account number 1. Ref No. #1",
+	}, {
+		Kind:      "deposit_received",
+		Recipient: dest.Email,
+		Subject:   "Cash Deposit Notification",
+		Body:      "Your account number 1 has received a deposit of 1325000.50. Your new balance is 1325000.50. Ref No. #1",
+	}}
+	sent := notifier.Sent()
+	if !reflect.DeepEqual(sent, expected) {
+		t.Errorf("Expected exactly %+v to be sent. Got %+v", expected, sent)
+	}
+
+	msgs, _ := a.Store.GetOutboxMessages(OutboxSent)
+	if len(msgs) != 2 || msgs[0].Attempts != 1 || msgs[1].Attempts != 1 {
+		t.Errorf("Expected the messages to be marked sent after 1 attempt. Got %+v", msgs)
+	}
+}
+
+func TestDispatchOutboxRetriesFailedDelivery(t *testing.T) {
+	clearTable()
+	addAccount(1)
+
+	notifier.FailWith(errors.New("mail server unavailable"))
+
+	payload := []byte(`{"depositdest":1,"externalsource":"michaeladityas@live.com","amount":3879000}`)
+
+	req, _ := http.NewRequest("POST", "/transaction", bytes.NewBuffer(payload))
+	response := executeRequest(req)
+
+	checkResponseCode(t, http.StatusCreated, response.Code)
+
+	if err := a.DispatchOutbox(); err != nil {
+		t.Fatal(err)
+	}
+
+	msgs, _ := a.Store.GetOutboxMessages(OutboxPending)
+	if len(msgs) != 2 {
+		t.Fatalf("Expected the failed notifications to stay pending. Got %d pending", len(msgs))
+	}
+
+	if msgs[0].Attempts != 1 || msgs[0].LastError != "mail server unavailable" {
+		t.Errorf("Expected 1 failed attempt with its error recorded. Got %d attempts, error %q", msgs[0].Attempts, msgs[0].LastError)
+	}
+
+	if !msgs[0].NextAttemptAt.After(time.Now()) {
+		t.Errorf("Expected the retry to be scheduled in the future. Got %v", msgs[0].NextAttemptAt)
+	}
+}
+
+func TestCreateDepositIdempotencyKey(t *testing.T) {
+	clearTable()
+	addAccount(1)
+
+	payload := []byte(`{"depositdest":1,"externalsource":"michaeladityas@live.com","amount":3879000}`)
+
+	req, _ := http.NewRequest("POST", "/transaction", bytes.NewBuffer(payload))
+	req.Header.Set("Idempotency-Key", "teller-7-0001")
+	first := executeRequest(req)
+
+	checkResponseCode(t, http.StatusCreated, first.Code)
+
+	req, _ = http.NewRequest("POST", "/transaction", bytes.NewBuffer(payload))
+	req.Header.Set("Idempotency-Key", "teller-7-0001")
+	retry := executeRequest(req)
+
+	checkResponseCode(t, http.StatusCreated, retry.Code)
+
+	if retry.Body.String() != first.Body.String() {
+		t.Errorf("Expected the retry to replay %s. Got %s", first.Body.String(), retry.Body.String())
+	}
+
+	if retry.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("Expected the retry to be marked as replayed")
+	}
+
+	trans, _ := a.Store.GetHistory(1)
+	if len(trans) != 1 {
+		t.Errorf("Expected exactly 1 deposit. Got %d", len(trans))
+	}
+
+	payload = []byte(`{"depositdest":1,"externalsource":"michaeladityas@live.com","amount":1}`)
+	req, _ = http.NewRequest("POST", "/transaction", bytes.NewBuffer(payload))
+	req.Header.Set("Idempotency-Key", "teller-7-0001")
+	response := executeRequest(req)
+
+	checkResponseCode(t, http.StatusConflict, response.Code)
+}
+
+func TestIdempotencyKeyBelongsToCaller(t *testing.T) {
+	clearTable()
+	addAccount(2)
+	addTransaction(false, "michaeladityas@live.com", 1)
+
+	transfer := func(token, payload string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/transfer", bytes.NewBufferString(payload))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Idempotency-Key", "0001")
+		return executeRequest(req)
+	}
+
+	// The same key and body from two tellers are two transfers.
+	payload := `{"internalsource":1,"depositdest":2,"amount":100}`
+	checkResponseCode(t, http.StatusCreated, transfer(mintToken(RoleTeller, "teller-07", 0), payload).Code)
+	second := transfer(mintToken(RoleTeller, "teller-08", 0), payload)
+	checkResponseCode(t, http.StatusCreated, second.Code)
+	if second.Header().Get("Idempotent-Replayed") != "" {
+		t.Errorf("Expected another caller's key not to be replayed")
+	}
+
+	// Nor does another caller's key conflict with a different body.
+	checkResponseCode(t, http.StatusCreated, transfer(mintToken(RoleTeller, "teller-09", 0), `{"internalsource":1,"depositdest":2,"amount":5}`).Code)
+
+	// A customer reusing the key still goes through the ownership check.
+	checkResponseCode(t, http.StatusForbidden, transfer(mintToken(RoleCustomer, "bob", 2), payload).Code)
+
+	if history, _ := a.Store.GetHistory(2); len(history) != 3 {
+		t.Errorf("Expected 3 transfers into account 2. Got %d", len(history))
+	}
+}
+
+func TestIdempotencyKeyExpiry(t *testing.T) {
+	clearTable()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	rec := IdempotencyRecord{Key: "k", RequestHash: "h1", CreatedAt: now}
+	if existing, err := a.Store.ReserveIdempotencyKey(rec, now.Add(-time.Hour)); existing != nil || err != nil {
+		t.Fatalf("Expected a fresh reservation. Got %v, %v", existing, err)
+	}
+	a.Store.CompleteIdempotencyKey("k", http.StatusCreated, []byte(`{}`))
+
+	rec.RequestHash = "h2"
+	existing, _ := a.Store.ReserveIdempotencyKey(rec, now.Add(-time.Hour))
+	if existing == nil || existing.RequestHash != "h1" || existing.StatusCode != http.StatusCreated {
+		t.Errorf("Expected the stored record within the retention window. Got %v", existing)
+	}
+
+	existing, _ = a.Store.ReserveIdempotencyKey(rec, now.Add(time.Second))
+	if existing != nil {
+		t.Errorf("Expected an expired key to be reusable. Got %v", existing)
+	}
+}
+
+func TestListTransactionsPagination(t *testing.T) {
+	clearTable()
+	addAccount(2)
+
+	for i := 1; i <= 5; i++ {
+		trans := Transaction{DepositDest: uint32(i%2 + 1), Amount: Money(i * 1000 * MinorUnits)}
+		if i%2 == 0 {
+			trans.InternalSource = 1
+		} else {
+			trans.ExternalSource = "michaeladityas@live.com"
+		}
+		a.Store.CreateTransaction(&trans, nil, nil, nil)
+	}
+
+	ids := []float64{}
+	cursor := ""
+	for page := 0; page < 5; page++ {
+		req, _ := http.NewRequest("GET", "/transaction?limit=2&cursor="+cursor, nil)
+		response := executeRequest(req)
+
+		checkResponseCode(t, http.StatusOK, response.Code)
+
+		var m struct {
+			Transactions []map[string]interface{} `json:"transactions"`
+			NextCursor   string                   `json:"next_cursor"`
+		}
+		json.Unmarshal(response.Body.Bytes(), &m)
+		for _, trans := range m.Transactions {
+			ids = append(ids, trans["transid"].(float64))
+		}
+
+		cursor = m.NextCursor
+		if cursor == "" {
+			break
+		}
+	}
+
+	if fmt.Sprint(ids) != "[5 4 3 2 1]" {
+		t.Errorf("Expected transactions 5 to 1 newest first across pages. Got %v", ids)
+	}
+
+	cases := map[string]string{
+		"min_amount=2000&max_amount=4000": "[4 3 2]",
+		"source=internal":                 "[4 2]",
+		"source=external&destination=2":   "[5 3 1]",
+		"from=2999-01-01T00:00:00Z":       "[]",
+		"to=2999-01-01T00:00:00Z&limit=1": "[5]",
+	}
+	for query, expected := range cases {
+		req, _ := http.NewRequest("GET", "/transaction?"+query, nil)
+		response := executeRequest(req)
+
+		checkResponseCode(t, http.StatusOK, response.Code)
+
+		var m struct {
+			Transactions []map[string]interface{} `json:"transactions"`
+		}
+		json.Unmarshal(response.Body.Bytes(), &m)
+		got := []float64{}
+		for _, trans := range m.Transactions {
+			got = append(got, trans["transid"].(float64))
+		}
+		if fmt.Sprint(got) != expected {
+			t.Errorf("Expected %s for %s. Got %v", expected, query, got)
+		}
+	}
+
+	for _, query := range []string{"limit=0", "limit=abc", "cursor=nope", "source=cash", "from=yesterday", "min_amount=x"} {
+		req, _ := http.NewRequest("GET", "/transaction?"+query, nil)
+		response := executeRequest(req)
+
+		checkResponseCode(t, http.StatusBadRequest, response.Code)
+	}
 }
 
 func TestCreateDepositInvalidExternal(t *testing.T) {
@@ -271,12 +1078,32 @@ func TestCreateDepositInvalidExternal(t *testing.T) {
 	req, _ := http.NewRequest("POST", "/transaction", bytes.NewBuffer(payload))
 	response := executeRequest(req)
 
-	checkResponseCode(t, http.StatusBadRequest, response.Code)
+	checkProblem(t, response, map[string]string{"externalsource": FieldInvalid})
+}
 
-	var m map[string]interface{}
-	json.Unmarshal(response.Body.Bytes(), &m)
-	if m["error"] != "Invalid Email Address" {
-		t.Errorf("Expected the 'error' message of the response to be set to 'Invalid Email Address'. Got '%s'", m["error"])
+func TestCreateDepositRequiresOneSource(t *testing.T) {
+	clearTable()
+	addAccount(2)
+
+	tests := []struct {
+		payload string
+		errors  map[string]string
+	}{
+		{`{"depositdest":1,"amount":100}`, map[string]string{"externalsource": FieldRequired, "internalsource": FieldRequired}},
+		{`{"depositdest":1,"externalsource":"michaeladityas@live.com","internalsource":2,"amount":100}`, map[string]string{"internalsource": FieldInvalid}},
+		{`{"depositdest":1,"externalsource":"asd.com","internalsource":2,"amount":100}`, map[string]string{"externalsource": FieldInvalid, "internalsource": FieldInvalid}},
+	}
+
+	for _, tt := range tests {
+		req, _ := http.NewRequest("POST", "/transaction", bytes.NewBufferString(tt.payload))
+		checkProblem(t, executeRequest(req), tt.errors)
+	}
+
+	acc := Account{AccountID: 1}
+	a.Store.GetAccount(&acc)
+	msgs, _ := a.Store.GetOutboxMessages(OutboxPending)
+	if acc.Balance != 0 || len(msgs) != 0 {
+		t.Errorf("Expected nothing to be deposited or notified. Got balance %s and %+v", acc.Balance, msgs)
 	}
 }
 
@@ -316,6 +1143,19 @@ func TestCreateDepositInvalidDestination(t *testing.T) {
 	}
 }
 
+func TestCreateDepositZeroAmount(t *testing.T) {
+	clearTable()
+	addAccount(1)
+
+	// 0.004 rounds to zero sen
+	payload := []byte(`{"depositdest":1,"externalsource":"michaeladityas@live.com","amount":0.004}`)
+
+	req, _ := http.NewRequest("POST", "/transaction", bytes.NewBuffer(payload))
+	response := executeRequest(req)
+
+	checkProblem(t, response, map[string]string{"amount": FieldInvalid})
+}
+
 func TestCreateDepositInvalidAmount(t *testing.T) {
 	clearTable()
 	addAccount(1)
@@ -325,33 +1165,68 @@ func TestCreateDepositInvalidAmount(t *testing.T) {
 	req, _ := http.NewRequest("POST", "/transaction", bytes.NewBuffer(payload))
 	response := executeRequest(req)
 
-	checkResponseCode(t, http.StatusBadRequest, response.Code)
+	checkProblem(t, response, map[string]string{"amount": FieldWrongType})
+}
 
-	var m map[string]interface{}
-	json.Unmarshal(response.Body.Bytes(), &m)
-	if m["error"] != "Invalid request payload" {
-		t.Errorf("Expected the 'error' message of the response to be set to 'Invalid request payload'. Got '%s'", m["error"])
+// testSecret signs the HS256 tokens used by the tests.
+var testSecret = []byte("test-secret")
+
+// clearTable starts every test from an empty store. Setting
+// TEST_DB_DRIVER=sqlite runs the suite against a fresh in-memory SQLite
+// database instead of the MemoryStore.
+func clearTable() {
+	notifier = &RecorderNotifier{}
+	a = App{Notifier: notifier, Tokens: TokenVerifier{HMACSecret: testSecret}}
+	if os.Getenv("TEST_DB_DRIVER") == "sqlite" {
+		a.InitializeDriver("sqlite", ":memory:")
+		return
 	}
+	a.InitializeWithStore(NewMemoryStore())
 }
 
-func ensureTableExists() {
-	if _, err := a.DB.Exec(tableAccountCreationQuery); err != nil {
-		log.Fatal(err)
+func checkQueuedNotification(t *testing.T, recipient, body string) {
+	checkQueuedNotifications(t, Notification{Recipient: recipient, Body: body})
+}
+
+// checkQueuedNotifications checks the recipients and bodies of the pending
+// notifications, in order.
+func checkQueuedNotifications(t *testing.T, expected ...Notification) {
+	msgs, _ := a.Store.GetOutboxMessages(OutboxPending)
+	if len(msgs) != len(expected) {
+		t.Fatalf("Expected %d pending notifications. Got %d", len(expected), len(msgs))
 	}
 
-	if _, err := a.DB.Exec(tableTransactionLogCreationQuery); err != nil {
-		log.Fatal(err)
+	for i, e := range expected {
+		if msgs[i].Recipient != e.Recipient {
+			t.Errorf("Expected the notification to be sent to %s. Got %s", e.Recipient, msgs[i].Recipient)
+		}
+
+		if msgs[i].Body != e.Body {
+			t.Errorf("Expected notification body %q. Got %q", e.Body, msgs[i].Body)
+		}
 	}
 }
 
-func clearTable() {
-	a.DB.Exec("DELETE FROM account")
-	a.DB.Exec("DELETE FROM transaction_log")
-	a.DB.Exec("ALTER TABLE account AUTO_INCREMENT = 1")
-	a.DB.Exec("ALTER TABLE transaction_log AUTO_INCREMENT = 1")
+// mintToken returns an HS256 bearer token valid for an hour.
+func mintToken(role, subject string, accountID uint32) string {
+	token, err := MintToken(Claims{
+		Subject:   subject,
+		Role:      role,
+		AccountID: accountID,
+		ExpiresAt: time.Now().Add(time.Hour).Unix(),
+	}, AlgHS256, testSecret)
+	if err != nil {
+		panic(err)
+	}
+	return token
 }
 
+// executeRequest serves req, authenticated as an admin unless it already
+// carries an Authorization header.
 func executeRequest(req *http.Request) *httptest.ResponseRecorder {
+	if req.Header.Get("Authorization") == "" {
+		req.Header.Set("Authorization", "Bearer "+mintToken(RoleAdmin, "admin", 0))
+	}
 	rr := httptest.NewRecorder()
 	a.Router.ServeHTTP(rr, req)
 
@@ -364,38 +1239,55 @@ func checkResponseCode(t *testing.T, expected, actual int) {
 	}
 }
 
+// checkProblem checks that response is a 400 problem+json body listing
+// exactly the expected errors, given as field path to code.
+func checkProblem(t *testing.T, response *httptest.ResponseRecorder, expected map[string]string) {
+	t.Helper()
+	checkResponseCode(t, http.StatusBadRequest, response.Code)
+	if ct := response.Header().Get("Content-Type"); ct != "application/problem+json" {
+		t.Errorf("Expected Content-Type application/problem+json. Got '%s'", ct)
+	}
+
+	var p Problem
+	json.Unmarshal(response.Body.Bytes(), &p)
+	got := map[string]string{}
+	for _, e := range p.Errors {
+		got[e.Field] = e.Code
+	}
+	if p.Status != http.StatusBadRequest || !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected errors %v. Got %+v", expected, p)
+	}
+}
+
+// addAccount creates count accounts whose owners' email addresses are
+// verified.
 func addAccount(count int) {
 	if count < 1 {
 		count = 1
 	}
 
 	for i := 0; i < count; i++ {
-		q := `INSERT INTO account
-					(id_card_number, name, email)
-					VALUES
-					(?,?,?)
-		`
 		idCard := generateString(48, 57, 16)
 		name := generateString(97, 122, 7)
 		email := name + "@mail.com"
-		a.DB.Exec(q, idCard, name, email)
+		a.Store.CreateAccount(&Account{IDCard: idCard, Name: name, Email: email, EmailVerified: true}, nil, nil)
 	}
 }
 
 func addTransaction(isMember bool, from string, to int) {
-	var q string
+	trans := Transaction{DepositDest: uint32(to), Amount: 100000 * MinorUnits}
 	if isMember {
-		q = `INSERT INTO transaction_log
-				 (source_internal, destination, amount)
-				 VALUES
-				 (?,?,?)`
+		source, _ := strconv.Atoi(from)
+		trans.InternalSource = uint32(source)
 	} else {
-		q = `INSERT INTO transaction_log
-				 (source_external, destination, amount)
-				 VALUES
-				 (?,?,?)`
+		trans.ExternalSource = from
 	}
-	a.DB.Exec(q, from, to, 100000)
+	a.Store.CreateTransaction(&trans, nil, nil, nil)
+}
+
+// generateNIK returns a valid NIK with a random serial number.
+func generateNIK() string {
+	return fmt.Sprintf("3171093101900%03d", randomInt(1, 1000))
 }
 
 func generateString(from int, to int, len int) string {
@@ -409,28 +1301,3 @@ func generateString(from int, to int, len int) string {
 func randomInt(min, max int) int {
 	return min + rand.Intn(max-min)
 }
-
-const tableAccountCreationQuery = `
-CREATE TABLE IF NOT EXISTS account (
-  account_id INT UNSIGNED NOT NULL AUTO_INCREMENT ,
-  id_card_number VARCHAR(20) NOT NULL UNIQUE,
-  name VARCHAR(100) NOT NULL ,
-  email VARCHAR(320) NOT NULL ,
-  registration_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ,
-  PRIMARY KEY (account_id,id_card_number)
-) ENGINE = InnoDB;
-`
-
-const tableTransactionLogCreationQuery = `
-CREATE TABLE IF NOT EXISTS transaction_log (
-  transaction_id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT ,
-  source_external VARCHAR(320) NULL ,
-  source_internal INT UNSIGNED NULL ,
-  destination INT UNSIGNED NOT NULL ,
-  amount DOUBLE UNSIGNED NOT NULL ,
-  transaction_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ,
-  PRIMARY KEY (transaction_id),
-  CONSTRAINT internal_account_destination FOREIGN KEY (destination) REFERENCES account (account_id) ON UPDATE CASCADE,
-  CONSTRAINT internal_account_source FOREIGN KEY (source_internal) REFERENCES account (account_id) ON UPDATE CASCADE
-) ENGINE = InnoDB;
-`
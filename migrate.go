@@ -0,0 +1,142 @@
+package main
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+)
+
+//go:embed migrations
+var migrationFiles embed.FS
+
+// migrate applies every migrations/<dialect>/*.sql file that has not been
+// recorded in schema_migrations yet, in file name order. Each file runs in
+// its own transaction where the database supports transactional DDL.
+// rebind adapts "?" placeholders to the dialect.
+func migrate(db *sql.DB, rebind func(string) string, dialect string) error {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version VARCHAR(255) NOT NULL PRIMARY KEY,
+		applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`)
+	if err != nil {
+		return err
+	}
+
+	dir := path.Join("migrations", dialect)
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return err
+	}
+
+	names := []string{}
+	for _, e := range entries {
+		if strings.HasSuffix(e.Name(), ".sql") {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		version := strings.TrimSuffix(name, ".sql")
+
+		var applied int
+		err := db.QueryRow(rebind(`SELECT COUNT(*) FROM schema_migrations WHERE version = ?`), version).Scan(&applied)
+		if err != nil {
+			return err
+		}
+		if applied > 0 {
+			continue
+		}
+
+		body, err := migrationFiles.ReadFile(path.Join(dir, name))
+		if err != nil {
+			return err
+		}
+
+		if strings.HasPrefix(string(body), foreignKeysOff) {
+			err = applyWithoutForeignKeys(db, rebind, name, version, string(body))
+		} else {
+			err = applyMigration(db, rebind, name, version, string(body), nil)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// foreignKeysOff starts SQLite migrations that rebuild a table other
+// tables refer to. SQLite cannot drop such a table while foreign keys are
+// enforced, and the setting cannot change inside a transaction, so these
+// migrations run with enforcement off and are checked before committing.
+const foreignKeysOff = "-- migrate: foreign keys off"
+
+func applyWithoutForeignKeys(db *sql.DB, rebind func(string) string, name, version, body string) error {
+	if _, err := db.Exec(`PRAGMA foreign_keys = OFF`); err != nil {
+		return err
+	}
+	defer db.Exec(`PRAGMA foreign_keys = ON`)
+
+	return applyMigration(db, rebind, name, version, body, func(tx *sql.Tx) error {
+		rows, err := tx.Query(`PRAGMA foreign_key_check`)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		if rows.Next() {
+			return fmt.Errorf("migration %s: foreign key check failed", name)
+		}
+		return rows.Err()
+	})
+}
+
+// applyMigration runs body in a transaction and records version as
+// applied. check, if set, runs last and can abort the migration.
+func applyMigration(db *sql.DB, rebind func(string) string, name, version, body string, check func(*sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range splitStatements(body) {
+		if _, err := tx.Exec(stmt); err != nil {
+			return fmt.Errorf("migration %s: %v", name, err)
+		}
+	}
+	if check != nil {
+		if err := check(tx); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(rebind(`INSERT INTO schema_migrations (version) VALUES (?)`), version); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// splitStatements splits a migration file on statement-terminating
+// semicolons and drops "--" comment lines. Migrations must not contain
+// semicolons inside string literals.
+func splitStatements(body string) []string {
+	lines := []string{}
+	for _, line := range strings.Split(body, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "--") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+
+	stmts := []string{}
+	for _, stmt := range strings.Split(strings.Join(lines, "\n"), ";") {
+		if stmt = strings.TrimSpace(stmt); stmt != "" {
+			stmts = append(stmts, stmt)
+		}
+	}
+	return stmts
+}
@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS account (
+  account_id INT UNSIGNED NOT NULL AUTO_INCREMENT ,
+  id_card_number VARCHAR(20) NOT NULL UNIQUE,
+  name VARCHAR(100) NOT NULL ,
+  email VARCHAR(320) NOT NULL ,
+  registration_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ,
+  PRIMARY KEY (account_id,id_card_number)
+) ENGINE = InnoDB;
+
+CREATE TABLE IF NOT EXISTS transaction_log (
+  transaction_id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT ,
+  source_external VARCHAR(320) NULL ,
+  source_internal INT UNSIGNED NULL ,
+  destination INT UNSIGNED NOT NULL ,
+  amount DOUBLE UNSIGNED NOT NULL ,
+  transaction_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ,
+  PRIMARY KEY (transaction_id),
+  CONSTRAINT internal_account_destination FOREIGN KEY (destination) REFERENCES account (account_id) ON UPDATE CASCADE,
+  CONSTRAINT internal_account_source FOREIGN KEY (source_internal) REFERENCES account (account_id) ON UPDATE CASCADE
+) ENGINE = InnoDB;
@@ -0,0 +1,11 @@
+-- Convert transaction_log.amount from DOUBLE Rupiah to BIGINT sen.
+-- The DOUBLE is first cast to DECIMAL so ROUND() applies the same
+-- half-away-from-zero rule the API uses, instead of rounding the binary
+-- approximation.
+ALTER TABLE transaction_log ADD COLUMN amount_minor BIGINT UNSIGNED NULL AFTER amount;
+
+UPDATE transaction_log SET amount_minor = ROUND(CAST(amount AS DECIMAL(30,4)) * 100);
+
+ALTER TABLE transaction_log
+  DROP COLUMN amount,
+  CHANGE COLUMN amount_minor amount BIGINT UNSIGNED NOT NULL;
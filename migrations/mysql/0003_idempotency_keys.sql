@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS idempotency_key (
+  idempotency_key VARCHAR(255) NOT NULL ,
+  request_hash CHAR(64) NOT NULL ,
+  status_code INT NULL ,
+  response_body MEDIUMBLOB NULL ,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ,
+  PRIMARY KEY (idempotency_key),
+  INDEX idempotency_key_created_at (created_at)
+) ENGINE = InnoDB;
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS outbox (
+  message_id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT ,
+  kind VARCHAR(64) NOT NULL ,
+  recipient VARCHAR(320) NOT NULL ,
+  subject VARCHAR(255) NOT NULL ,
+  body TEXT NOT NULL ,
+  status VARCHAR(16) NOT NULL DEFAULT 'pending' ,
+  attempts INT NOT NULL DEFAULT 0 ,
+  last_error TEXT NULL ,
+  next_attempt_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ,
+  PRIMARY KEY (message_id),
+  INDEX outbox_due (status, next_attempt_at)
+) ENGINE = InnoDB;
@@ -0,0 +1,24 @@
+-- Double-entry ledger. Every transaction_log row is a journal entry whose
+-- posting rows sum to zero; account.balance is the sum of an account's
+-- postings. system_account names a bank-side account such as 'cash_vault'
+-- and is set exactly when account_id is NULL.
+ALTER TABLE transaction_log ADD COLUMN kind VARCHAR(32) NOT NULL DEFAULT 'deposit' AFTER transaction_id;
+
+CREATE TABLE IF NOT EXISTS posting (
+  posting_id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT ,
+  transaction_id BIGINT UNSIGNED NOT NULL ,
+  account_id INT UNSIGNED NULL ,
+  system_account VARCHAR(64) NULL ,
+  amount BIGINT NOT NULL ,
+  PRIMARY KEY (posting_id),
+  INDEX posting_account (account_id),
+  CONSTRAINT posting_transaction FOREIGN KEY (transaction_id) REFERENCES transaction_log (transaction_id),
+  CONSTRAINT posting_account FOREIGN KEY (account_id) REFERENCES account (account_id) ON UPDATE CASCADE
+) ENGINE = InnoDB;
+
+-- Existing deposits become cash_vault -> customer entries.
+INSERT INTO posting (transaction_id, account_id, system_account, amount)
+SELECT transaction_id, destination, NULL, CAST(amount AS SIGNED) FROM transaction_log ORDER BY transaction_id;
+
+INSERT INTO posting (transaction_id, account_id, system_account, amount)
+SELECT transaction_id, NULL, 'cash_vault', -CAST(amount AS SIGNED) FROM transaction_log ORDER BY transaction_id;
@@ -0,0 +1,4 @@
+-- How far below zero an account may go on withdrawals and transfers out.
+-- A withdrawal is stored in transaction_log with kind 'withdrawal' and the
+-- debited account as destination.
+ALTER TABLE account ADD COLUMN overdraft_limit BIGINT NOT NULL DEFAULT 0 AFTER balance;
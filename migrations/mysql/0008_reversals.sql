@@ -0,0 +1,10 @@
+-- A reversal is a transaction_log row of kind 'reversal' whose postings
+-- negate those of the row named by reversal_of. The original row is never
+-- updated; it counts as reversed when a reversal points at it, and the
+-- unique index allows at most one.
+ALTER TABLE transaction_log
+  ADD COLUMN reversal_of BIGINT UNSIGNED NULL ,
+  ADD COLUMN reason_code VARCHAR(64) NULL ,
+  ADD COLUMN operator VARCHAR(255) NULL ,
+  ADD UNIQUE INDEX transaction_log_reversal_of (reversal_of),
+  ADD CONSTRAINT transaction_log_reversal FOREIGN KEY (reversal_of) REFERENCES transaction_log (transaction_id);
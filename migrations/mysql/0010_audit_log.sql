@@ -0,0 +1,20 @@
+-- Append-only record of every change made through the API, written in
+-- the same transaction as the change. The application never updates or
+-- deletes rows; grant its database user only INSERT and SELECT on this
+-- table to enforce that.
+CREATE TABLE IF NOT EXISTS audit_log (
+  audit_id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT ,
+  created_at TIMESTAMP NOT NULL,
+  actor VARCHAR(255) NOT NULL,
+  action VARCHAR(50) NOT NULL,
+  target VARCHAR(100) NOT NULL,
+  request_id VARCHAR(128) NOT NULL,
+  client_ip VARCHAR(45) NOT NULL,
+  before_state MEDIUMTEXT NULL,
+  after_state MEDIUMTEXT NULL,
+  PRIMARY KEY (audit_id),
+  INDEX audit_log_actor (actor, audit_id),
+  INDEX audit_log_target (target, audit_id),
+  INDEX audit_log_request (request_id),
+  INDEX audit_log_created (created_at)
+) ENGINE = InnoDB;
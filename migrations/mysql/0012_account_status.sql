@@ -0,0 +1,18 @@
+-- Accounts are active, frozen or closed. Every change is kept in
+-- account_status_history, which starts with the account's registration.
+ALTER TABLE account ADD COLUMN status VARCHAR(16) NOT NULL DEFAULT 'active';
+
+CREATE TABLE IF NOT EXISTS account_status_history (
+  history_id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT ,
+  account_id INT UNSIGNED NOT NULL,
+  status VARCHAR(16) NOT NULL,
+  reason VARCHAR(255) NOT NULL,
+  changed_by VARCHAR(255) NOT NULL,
+  changed_at TIMESTAMP NOT NULL,
+  PRIMARY KEY (history_id),
+  INDEX account_status_history_account (account_id, history_id),
+  CONSTRAINT account_status_history_account FOREIGN KEY (account_id) REFERENCES account (account_id)
+) ENGINE = InnoDB;
+
+INSERT INTO account_status_history (account_id, status, reason, changed_by, changed_at)
+SELECT account_id, 'active', '', '', registration_time FROM account;
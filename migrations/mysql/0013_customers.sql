@@ -0,0 +1,41 @@
+-- A customer owns one or more accounts, so the identity moves from account
+-- to customer and an ID card number is unique per customer rather than per
+-- account. Every existing account becomes the only account of a customer
+-- with the same ID. account_holder lists joint holders other than the owner.
+CREATE TABLE IF NOT EXISTS customer (
+  customer_id INT UNSIGNED NOT NULL AUTO_INCREMENT ,
+  id_card_number VARCHAR(20) NOT NULL UNIQUE,
+  name VARCHAR(100) NOT NULL ,
+  email VARCHAR(320) NOT NULL ,
+  phone VARCHAR(16) NOT NULL DEFAULT '',
+  date_of_birth DATE NULL ,
+  registration_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ,
+  PRIMARY KEY (customer_id)
+) ENGINE = InnoDB;
+
+INSERT INTO customer (customer_id, id_card_number, name, email, registration_time)
+SELECT account_id, id_card_number, name, email, registration_time FROM account;
+
+ALTER TABLE account
+  ADD COLUMN customer_id INT UNSIGNED NULL AFTER account_id,
+  ADD COLUMN product_type VARCHAR(16) NOT NULL DEFAULT 'savings';
+
+UPDATE account SET customer_id = account_id;
+
+ALTER TABLE account
+  MODIFY customer_id INT UNSIGNED NOT NULL,
+  ADD CONSTRAINT account_customer FOREIGN KEY (customer_id) REFERENCES customer (customer_id),
+  DROP PRIMARY KEY,
+  ADD PRIMARY KEY (account_id),
+  DROP COLUMN id_card_number,
+  DROP COLUMN name,
+  DROP COLUMN email;
+
+CREATE TABLE IF NOT EXISTS account_holder (
+  account_id INT UNSIGNED NOT NULL,
+  customer_id INT UNSIGNED NOT NULL,
+  PRIMARY KEY (account_id, customer_id),
+  INDEX account_holder_customer (customer_id),
+  CONSTRAINT account_holder_account FOREIGN KEY (account_id) REFERENCES account (account_id),
+  CONSTRAINT account_holder_customer FOREIGN KEY (customer_id) REFERENCES customer (customer_id)
+) ENGINE = InnoDB;
@@ -0,0 +1,9 @@
+-- email_verified is set once the customer follows the link emailed to
+-- them. Addresses stored before verification existed have been receiving
+-- notifications all along and count as verified.
+ALTER TABLE customer ADD COLUMN email_verified BOOLEAN NOT NULL DEFAULT FALSE;
+
+UPDATE customer SET email_verified = TRUE;
+
+-- Held notifications are released by recipient once it is verified.
+CREATE INDEX outbox_recipient ON outbox (recipient, status);
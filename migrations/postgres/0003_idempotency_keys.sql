@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS idempotency_key (
+  idempotency_key VARCHAR(255) NOT NULL PRIMARY KEY,
+  request_hash CHAR(64) NOT NULL,
+  status_code INTEGER NULL,
+  response_body BYTEA NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idempotency_key_created_at ON idempotency_key (created_at);
@@ -0,0 +1,6 @@
+-- Materialized balance, kept up to date by every ledger insert. Run
+-- "check-balances" to compare it against transaction_log.
+ALTER TABLE account ADD COLUMN balance BIGINT NOT NULL DEFAULT 0;
+
+UPDATE account
+SET balance = COALESCE((SELECT SUM(tl.amount) FROM transaction_log tl WHERE tl.destination = account.account_id), 0);
@@ -0,0 +1,21 @@
+-- API keys for kiosk and batch clients. Only a SHA-256 hash of each key
+-- is stored; prefix is the public part used to look it up. scopes and
+-- allowed_ips are space separated; an empty allowed_ips allows any
+-- address.
+CREATE TABLE IF NOT EXISTS api_key (
+  key_id BIGSERIAL PRIMARY KEY,
+  name VARCHAR(100) NOT NULL,
+  prefix VARCHAR(32) NOT NULL,
+  secret_hash CHAR(64) NOT NULL,
+  scopes TEXT NOT NULL,
+  allowed_ips TEXT NOT NULL,
+  created_by VARCHAR(255) NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  rotated_at TIMESTAMPTZ NULL,
+  revoked_at TIMESTAMPTZ NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS api_key_prefix ON api_key (prefix);
+
+-- The Principal.Actor (user:<sub> or apikey:<id>) that created each row.
+ALTER TABLE transaction_log ADD COLUMN created_by VARCHAR(255) NULL;
@@ -0,0 +1,20 @@
+-- Append-only record of every change made through the API, written in
+-- the same transaction as the change. The application never updates or
+-- deletes rows; grant its database user only INSERT and SELECT on this
+-- table to enforce that.
+CREATE TABLE IF NOT EXISTS audit_log (
+  audit_id BIGSERIAL PRIMARY KEY,
+  created_at TIMESTAMPTZ NOT NULL,
+  actor VARCHAR(255) NOT NULL,
+  action VARCHAR(50) NOT NULL,
+  target VARCHAR(100) NOT NULL,
+  request_id VARCHAR(128) NOT NULL,
+  client_ip VARCHAR(45) NOT NULL,
+  before_state TEXT NULL,
+  after_state TEXT NULL
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_actor ON audit_log (actor, audit_id);
+CREATE INDEX IF NOT EXISTS audit_log_target ON audit_log (target, audit_id);
+CREATE INDEX IF NOT EXISTS audit_log_request ON audit_log (request_id);
+CREATE INDEX IF NOT EXISTS audit_log_created ON audit_log (created_at);
@@ -0,0 +1,17 @@
+-- Accounts are active, frozen or closed. Every change is kept in
+-- account_status_history, which starts with the account's registration.
+ALTER TABLE account ADD COLUMN status VARCHAR(16) NOT NULL DEFAULT 'active';
+
+CREATE TABLE IF NOT EXISTS account_status_history (
+  history_id BIGSERIAL PRIMARY KEY,
+  account_id INTEGER NOT NULL REFERENCES account (account_id),
+  status VARCHAR(16) NOT NULL,
+  reason VARCHAR(255) NOT NULL,
+  changed_by VARCHAR(255) NOT NULL,
+  changed_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS account_status_history_account ON account_status_history (account_id, history_id);
+
+INSERT INTO account_status_history (account_id, status, reason, changed_by, changed_at)
+SELECT account_id, 'active', '', '', registration_time FROM account;
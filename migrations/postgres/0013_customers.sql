@@ -0,0 +1,34 @@
+-- A customer owns one or more accounts, so the identity moves from account
+-- to customer and an ID card number is unique per customer rather than per
+-- account. Every existing account becomes the only account of a customer
+-- with the same ID. account_holder lists joint holders other than the owner.
+CREATE TABLE IF NOT EXISTS customer (
+  customer_id SERIAL PRIMARY KEY,
+  id_card_number VARCHAR(20) NOT NULL UNIQUE,
+  name VARCHAR(100) NOT NULL,
+  email VARCHAR(320) NOT NULL,
+  phone VARCHAR(16) NOT NULL DEFAULT '',
+  date_of_birth DATE NULL,
+  registration_time TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO customer (customer_id, id_card_number, name, email, registration_time)
+SELECT account_id, id_card_number, name, email, registration_time FROM account;
+
+SELECT setval(pg_get_serial_sequence('customer', 'customer_id'), COALESCE(MAX(customer_id), 0) + 1, false) FROM customer;
+
+ALTER TABLE account ADD COLUMN customer_id INTEGER NULL REFERENCES customer (customer_id);
+ALTER TABLE account ADD COLUMN product_type VARCHAR(16) NOT NULL DEFAULT 'savings';
+
+UPDATE account SET customer_id = account_id;
+
+ALTER TABLE account ALTER COLUMN customer_id SET NOT NULL;
+ALTER TABLE account DROP COLUMN id_card_number, DROP COLUMN name, DROP COLUMN email;
+
+CREATE TABLE IF NOT EXISTS account_holder (
+  account_id INTEGER NOT NULL REFERENCES account (account_id),
+  customer_id INTEGER NOT NULL REFERENCES customer (customer_id),
+  PRIMARY KEY (account_id, customer_id)
+);
+
+CREATE INDEX IF NOT EXISTS account_holder_customer ON account_holder (customer_id);
@@ -0,0 +1,8 @@
+-- name_key is the case-folded name that name searches match against.
+-- Names stored before it existed were limited to ASCII letters and
+-- spaces, for which LOWER is the same as case folding.
+ALTER TABLE customer ADD COLUMN name_key VARCHAR(200) NOT NULL DEFAULT '';
+
+UPDATE customer SET name_key = LOWER(name);
+
+CREATE INDEX IF NOT EXISTS customer_name_key ON customer (name_key);
@@ -0,0 +1,18 @@
+-- SQLite and PostgreSQL start from the integer sen schema, so there is no
+-- 0002_amount_minor_units step for them.
+CREATE TABLE IF NOT EXISTS account (
+  account_id INTEGER PRIMARY KEY AUTOINCREMENT,
+  id_card_number VARCHAR(20) NOT NULL UNIQUE,
+  name VARCHAR(100) NOT NULL,
+  email VARCHAR(320) NOT NULL,
+  registration_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS transaction_log (
+  transaction_id INTEGER PRIMARY KEY AUTOINCREMENT,
+  source_external VARCHAR(320) NULL,
+  source_internal INTEGER NULL REFERENCES account (account_id) ON UPDATE CASCADE,
+  destination INTEGER NOT NULL REFERENCES account (account_id) ON UPDATE CASCADE,
+  amount BIGINT NOT NULL CHECK (amount >= 0),
+  transaction_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
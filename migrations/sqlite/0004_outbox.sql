@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS outbox (
+  message_id INTEGER PRIMARY KEY AUTOINCREMENT,
+  kind VARCHAR(64) NOT NULL,
+  recipient VARCHAR(320) NOT NULL,
+  subject VARCHAR(255) NOT NULL,
+  body TEXT NOT NULL,
+  status VARCHAR(16) NOT NULL DEFAULT 'pending',
+  attempts INTEGER NOT NULL DEFAULT 0,
+  last_error TEXT NULL,
+  next_attempt_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS outbox_due ON outbox (status, next_attempt_at);
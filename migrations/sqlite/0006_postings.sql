@@ -0,0 +1,25 @@
+-- Double-entry ledger. Every transaction_log row is a journal entry whose
+-- posting rows sum to zero; account.balance is the sum of an account's
+-- postings. system_account names a bank-side account such as 'cash_vault'
+-- and is set exactly when account_id is NULL.
+ALTER TABLE transaction_log ADD COLUMN kind VARCHAR(32) NOT NULL DEFAULT 'deposit';
+
+CREATE TABLE IF NOT EXISTS posting (
+  posting_id INTEGER PRIMARY KEY AUTOINCREMENT,
+  transaction_id INTEGER NOT NULL REFERENCES transaction_log (transaction_id),
+  account_id INTEGER NULL REFERENCES account (account_id) ON UPDATE CASCADE,
+  system_account VARCHAR(64) NULL,
+  amount BIGINT NOT NULL,
+  CHECK ((account_id IS NULL) <> (system_account IS NULL))
+);
+
+CREATE INDEX IF NOT EXISTS posting_transaction ON posting (transaction_id);
+
+CREATE INDEX IF NOT EXISTS posting_account ON posting (account_id);
+
+-- Existing deposits become cash_vault -> customer entries.
+INSERT INTO posting (transaction_id, account_id, system_account, amount)
+SELECT transaction_id, destination, NULL, amount FROM transaction_log ORDER BY transaction_id;
+
+INSERT INTO posting (transaction_id, account_id, system_account, amount)
+SELECT transaction_id, NULL, 'cash_vault', -amount FROM transaction_log ORDER BY transaction_id;
@@ -0,0 +1,11 @@
+-- A reversal is a transaction_log row of kind 'reversal' whose postings
+-- negate those of the row named by reversal_of. The original row is never
+-- updated; it counts as reversed when a reversal points at it, and the
+-- unique index allows at most one.
+ALTER TABLE transaction_log ADD COLUMN reversal_of INTEGER NULL REFERENCES transaction_log (transaction_id);
+
+ALTER TABLE transaction_log ADD COLUMN reason_code VARCHAR(64) NULL;
+
+ALTER TABLE transaction_log ADD COLUMN operator VARCHAR(255) NULL;
+
+CREATE UNIQUE INDEX transaction_log_reversal_of ON transaction_log (reversal_of);
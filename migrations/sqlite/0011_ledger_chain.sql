@@ -0,0 +1,23 @@
+-- Each transaction_log row carries the hash of its contents and of the
+-- row before it, so editing, inserting or deleting rows outside the
+-- application breaks the chain. Rows that predate this migration are
+-- hashed once, the first time the application starts on it.
+ALTER TABLE transaction_log ADD COLUMN prev_hash CHAR(64) NULL;
+ALTER TABLE transaction_log ADD COLUMN row_hash CHAR(64) NULL;
+
+-- The single row holding the end of the chain. Writers lock it before
+-- adding a row, which keeps the chain in transaction ID order.
+CREATE TABLE IF NOT EXISTS ledger_chain (
+  chain_id INTEGER PRIMARY KEY,
+  last_transaction_id INTEGER NOT NULL,
+  last_hash CHAR(64) NOT NULL
+);
+
+-- Chain heads signed with the ledger Ed25519 key, for export to auditors.
+CREATE TABLE IF NOT EXISTS ledger_checkpoint (
+  checkpoint_id INTEGER PRIMARY KEY AUTOINCREMENT,
+  transaction_id INTEGER NOT NULL,
+  hash CHAR(64) NOT NULL,
+  created_at TIMESTAMP NOT NULL,
+  signature VARCHAR(128) NOT NULL
+);
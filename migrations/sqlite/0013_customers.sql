@@ -0,0 +1,45 @@
+-- migrate: foreign keys off
+-- A customer owns one or more accounts, so the identity moves from account
+-- to customer and an ID card number is unique per customer rather than per
+-- account. Every existing account becomes the only account of a customer
+-- with the same ID. account_holder lists joint holders other than the owner.
+--
+-- SQLite cannot drop the UNIQUE id_card_number column, so account is
+-- rebuilt; see foreignKeysOff in migrate.go.
+CREATE TABLE IF NOT EXISTS customer (
+  customer_id INTEGER PRIMARY KEY AUTOINCREMENT,
+  id_card_number VARCHAR(20) NOT NULL UNIQUE,
+  name VARCHAR(100) NOT NULL,
+  email VARCHAR(320) NOT NULL,
+  phone VARCHAR(16) NOT NULL DEFAULT '',
+  date_of_birth DATE NULL,
+  registration_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO customer (customer_id, id_card_number, name, email, registration_time)
+SELECT account_id, id_card_number, name, email, registration_time FROM account;
+
+CREATE TABLE account_new (
+  account_id INTEGER PRIMARY KEY AUTOINCREMENT,
+  customer_id INTEGER NOT NULL REFERENCES customer (customer_id),
+  registration_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  balance BIGINT NOT NULL DEFAULT 0,
+  overdraft_limit BIGINT NOT NULL DEFAULT 0,
+  status VARCHAR(16) NOT NULL DEFAULT 'active',
+  product_type VARCHAR(16) NOT NULL DEFAULT 'savings'
+);
+
+INSERT INTO account_new (account_id, customer_id, registration_time, balance, overdraft_limit, status)
+SELECT account_id, account_id, registration_time, balance, overdraft_limit, status FROM account;
+
+DROP TABLE account;
+
+ALTER TABLE account_new RENAME TO account;
+
+CREATE TABLE IF NOT EXISTS account_holder (
+  account_id INTEGER NOT NULL REFERENCES account (account_id),
+  customer_id INTEGER NOT NULL REFERENCES customer (customer_id),
+  PRIMARY KEY (account_id, customer_id)
+);
+
+CREATE INDEX IF NOT EXISTS account_holder_customer ON account_holder (customer_id);
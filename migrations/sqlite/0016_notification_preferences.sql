@@ -0,0 +1,6 @@
+-- Which deposit notifications each account's holder wants. Deposits
+-- smaller than notify_large_amount_threshold are not notified; zero
+-- notifies every amount.
+ALTER TABLE account ADD COLUMN notify_deposit_received BOOLEAN NOT NULL DEFAULT TRUE;
+ALTER TABLE account ADD COLUMN notify_deposit_made BOOLEAN NOT NULL DEFAULT TRUE;
+ALTER TABLE account ADD COLUMN notify_large_amount_threshold BIGINT NOT NULL DEFAULT 0;
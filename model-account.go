@@ -1,71 +1,159 @@
 package main
 
 import (
-	"database/sql"
+	"time"
 )
 
+// Account is a customer's account. IDCard, Name, Email and EmailVerified
+// are those of the customer who owns it.
 type Account struct {
-	AccountID uint32  `json:"accountid"`
-	IDCard    string  `json:"idcardno"`
-	Name      string  `json:"name"`
-	Email     string  `json:"email"`
-	Balance   float64 `json:"balance"`
+	AccountID     uint32    `json:"accountid"`
+	CustomerID    uint32    `json:"customerid"`
+	IDCard        string    `json:"idcardno"`
+	Name          string    `json:"name"`
+	Email         string    `json:"email"`
+	EmailVerified bool      `json:"emailverified"`
+	Balance       Money     `json:"balance"`
+	Registered    time.Time `json:"registered"`
+
+	// OverdraftLimit is how far below zero withdrawals and transfers may
+	// take the balance.
+	OverdraftLimit Money `json:"overdraftlimit"`
+
+	// Status is AccountActive, AccountFrozen or AccountClosed.
+	Status string `json:"status"`
+
+	// ProductType is ProductSavings or ProductCurrent.
+	ProductType string `json:"producttype"`
+
+	// JointHolders are the customer IDs of everyone other than the owner
+	// who holds the account.
+	JointHolders []uint32 `json:"jointholders"`
+
+	// Notifications are the deposit notifications the account's holder
+	// wants.
+	Notifications NotificationPreferences `json:"notifications"`
+
+	// IDCardInfo is what IDCard encodes; see ParseNIK.
+	IDCardInfo *NIK `json:"idcardinfo,omitempty"`
 }
 
-func (acc *Account) getAccount(db *sql.DB) error {
-	var q string = `SELECT acc.id_card_number, acc.name, acc.email, COALESCE(SUM(tl.amount),0) AS balance
-									FROM account acc
-									LEFT JOIN transaction_log tl ON tl.destination = acc.account_id
-									WHERE acc.account_id = ?
-									HAVING acc.id_card_number IS NOT NULL`
-	return db.QueryRow(q, acc.AccountID).Scan(&acc.IDCard, &acc.Name, &acc.Email, &acc.Balance)
+// Available returns how much can be withdrawn from the account.
+func (acc Account) Available() Money {
+	return acc.Balance + acc.OverdraftLimit
 }
 
-func (acc *Account) createAccount(db *sql.DB) error {
-	var q string = `INSERT INTO account
-									(id_card_number, name, email)
-									VALUES
-									(?,?,?)`
-	res, err := db.Exec(q, acc.IDCard, acc.Name, acc.Email)
+// NotificationPreferences choose which deposit notifications are sent for
+// an account: to its holder when money is deposited or transferred into
+// it, and to its holder when they deposit from it into another account.
+// Deposits and incoming transfers smaller than LargeAmountThreshold are
+// not notified; zero notifies every amount. Outgoing transfers and
+// withdrawals are always notified.
+type NotificationPreferences struct {
+	DepositReceived      bool  `json:"depositreceived"`
+	DepositMade          bool  `json:"depositmade"`
+	LargeAmountThreshold Money `json:"largeamountthreshold"`
+}
 
-	if err != nil {
-		return err
-	}
+// DefaultNotificationPreferences are those of a new account: every
+// deposit is notified.
+var DefaultNotificationPreferences = NotificationPreferences{DepositReceived: true, DepositMade: true}
+
+// notifiesReceived reports whether the holder is told about a deposit of
+// amount into the account.
+func (p NotificationPreferences) notifiesReceived(amount Money) bool {
+	return p.DepositReceived && amount >= p.LargeAmountThreshold
+}
+
+// notifiesMade reports whether the holder is told about a deposit of
+// amount they made from the account.
+func (p NotificationPreferences) notifiesMade(amount Money) bool {
+	return p.DepositMade && amount >= p.LargeAmountThreshold
+}
 
-	id, err := res.LastInsertId()
-	if err != nil {
-		return err
+// Account statuses. Money only moves in and out of active accounts;
+// reversals are the exception, so mistakes can still be corrected. A
+// closed account stays closed.
+const (
+	AccountActive = "active"
+	AccountFrozen = "frozen"
+	AccountClosed = "closed"
+)
+
+// checkOpen returns ErrAccountFrozen or ErrAccountClosed unless the
+// account is active.
+func (acc Account) checkOpen() error {
+	switch acc.Status {
+	case AccountFrozen:
+		return ErrAccountFrozen
+	case AccountClosed:
+		return ErrAccountClosed
 	}
-	acc.AccountID = uint32(id)
 	return nil
 }
 
-func (acc *Account) getAccounts(db *sql.DB) ([]Account, error) {
-	var q string = `SELECT acc.account_id, acc.id_card_number, acc.name, acc.email, COALESCE(SUM(tl.amount),0) AS balance
-									FROM account acc
-									LEFT JOIN transaction_log tl ON tl.destination = acc.account_id
-									GROUP BY acc.id_card_number
-									HAVING acc.id_card_number IS NOT NULL
-									ORDER BY tl.transaction_time DESC
-									`
-	rows, err := db.Query(q)
-
-	if err != nil {
-		return nil, err
+// checkStatusChange returns the error for moving the account to status:
+// accounts are frozen when active, unfrozen when frozen, and closed when
+// not already closed and their balance is zero.
+func (acc Account) checkStatusChange(status string) error {
+	switch {
+	case acc.Status == AccountClosed:
+		return ErrAccountClosed
+	case acc.Status == status:
+		return ErrInvalidStatusChange
+	case status == AccountActive && acc.Status != AccountFrozen:
+		return ErrInvalidStatusChange
+	case status == AccountClosed && acc.Balance != 0:
+		return ErrBalanceNotZero
 	}
+	return nil
+}
 
-	defer rows.Close()
+// AccountStatusChange is an entry in an account's status history.
+type AccountStatusChange struct {
+	AccountID uint32    `json:"accountid"`
+	Status    string    `json:"status"`
+	Reason    string    `json:"reason"`
+	ChangedBy string    `json:"changedby"`
+	ChangedAt time.Time `json:"changed"`
+}
 
-	accounts := []Account{}
-	for rows.Next() {
-		var accnt Account
-		err := rows.Scan(&accnt.AccountID, &accnt.IDCard, &accnt.Name, &accnt.Email, &accnt.Balance)
+// Sort orders for AccountFilter.Sort.
+const (
+	AccountSortName       = "name"
+	AccountSortRegistered = "registered"
+	AccountSortBalance    = "balance"
+)
 
-		if err != nil {
-			return nil, err
-		}
-		accounts = append(accounts, accnt)
-	}
+// AccountFilter selects a page of accounts. Results are ordered by Sort,
+// then account ID, in the same direction, and start strictly after After
+// when it is set.
+type AccountFilter struct {
+	Limit int
+	Sort  string
+	Desc  bool
+
+	// After is the last account of the previous page. Only its AccountID
+	// and the field used by Sort are read.
+	After *Account
+
+	// NamePrefix matches the start of the name, ignoring case as
+	// nameSearchKey does.
+	NamePrefix string
+	// Email matches the whole address, ignoring case.
+	Email  string
+	IDCard string
+
+	// RegisteredFrom is inclusive and RegisteredTo exclusive; zero values
+	// are unbounded.
+	RegisteredFrom time.Time
+	RegisteredTo   time.Time
+}
 
-	return accounts, nil
+// AccountPage is one page of GET /account. Total counts every account
+// matching the filter, across all pages.
+type AccountPage struct {
+	Accounts   []Account `json:"accounts"`
+	Total      int       `json:"total"`
+	NextCursor string    `json:"next_cursor"`
 }
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"time"
+)
+
+// APIKey lets a machine client, such as a kiosk or a batch job, call the
+// API without a user token. The key itself is only shown when it is
+// created or rotated; Hash is all that is stored.
+type APIKey struct {
+	KeyID  uint64   `json:"keyid"`
+	Name   string   `json:"name"`
+	Prefix string   `json:"prefix"`
+	Hash   string   `json:"-"`
+	Scopes []string `json:"scopes"`
+
+	// AllowedIPs holds addresses and CIDR ranges the key may be used
+	// from. Empty allows any address.
+	AllowedIPs []string `json:"allowedips"`
+
+	CreatedBy string     `json:"createdby"`
+	CreatedAt time.Time  `json:"created"`
+	RotatedAt *time.Time `json:"rotated,omitempty"`
+	RevokedAt *time.Time `json:"revoked,omitempty"`
+}
+
+// Revoked reports whether the key has been revoked.
+func (k *APIKey) Revoked() bool {
+	return k.RevokedAt != nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Audit actions, one per mutating endpoint.
+const (
+	AuditAccountCreate              = "account.create"
+	AuditAccountUpdate              = "account.update"
+	AuditAccountNotifications       = "account.update_notifications"
+	AuditAccountFreeze              = "account.freeze"
+	AuditAccountUnfreeze            = "account.unfreeze"
+	AuditAccountClose               = "account.close"
+	AuditCustomerCreate             = "customer.create"
+	AuditCustomerVerifyEmail        = "customer.verify_email"
+	AuditCustomerResendVerification = "customer.resend_verification"
+	AuditDepositCreate              = "deposit.create"
+	AuditTransferCreate             = "transfer.create"
+	AuditWithdrawalCreate           = "withdrawal.create"
+	AuditTransactionReverse         = "transaction.reverse"
+	AuditAPIKeyCreate               = "apikey.create"
+	AuditAPIKeyRevoke               = "apikey.revoke"
+	AuditAPIKeyRotate               = "apikey.rotate"
+)
+
+// AuditEntry records one change made through the API. Target names the
+// changed record, as "account:<id>", "customer:<id>", "transaction:<id>"
+// or "apikey:<id>", and Before and After are its JSON representation on
+// either side of the change; Before is null for records that were created.
+type AuditEntry struct {
+	AuditID   uint64          `json:"auditid"`
+	Time      time.Time       `json:"time"`
+	Actor     string          `json:"actor"`
+	Action    string          `json:"action"`
+	Target    string          `json:"target"`
+	RequestID string          `json:"requestid"`
+	ClientIP  string          `json:"clientip"`
+	Before    json.RawMessage `json:"before"`
+	After     json.RawMessage `json:"after"`
+}
+
+// AuditFilter selects a page of the audit log, newest first. Results start
+// strictly before BeforeID when it is set.
+type AuditFilter struct {
+	Limit    int
+	BeforeID uint64
+
+	Actor     string
+	Action    string
+	Target    string
+	RequestID string
+
+	// From is inclusive and To exclusive; zero values are unbounded.
+	From time.Time
+	To   time.Time
+}
+
+// AuditPage is one page of GET /audit.
+type AuditPage struct {
+	Entries    []AuditEntry `json:"entries"`
+	NextCursor string       `json:"next_cursor"`
+}
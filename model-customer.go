@@ -0,0 +1,48 @@
+package main
+
+import (
+	"regexp"
+	"time"
+)
+
+// Customer is the identity the bank has verified (know your customer). A
+// customer owns one or more accounts and may be a joint holder of others.
+type Customer struct {
+	CustomerID uint32    `json:"customerid"`
+	IDCard     string    `json:"idcardno"`
+	Name       string    `json:"name"`
+	Email      string    `json:"email"`
+	Phone      string    `json:"phone"`
+	Registered time.Time `json:"registered"`
+
+	// EmailVerified is set once the customer has followed the link sent
+	// to Email. Changing Email clears it.
+	EmailVerified bool `json:"emailverified"`
+
+	// DateOfBirth is a date in DateLayout, or empty if it was not given.
+	DateOfBirth string `json:"dateofbirth"`
+
+	// IDCardInfo is what IDCard encodes; see ParseNIK.
+	IDCardInfo *NIK `json:"idcardinfo,omitempty"`
+}
+
+// DateLayout is the form of dates without a time of day.
+const DateLayout = "2006-01-02"
+
+// Account product types.
+const (
+	ProductSavings = "savings"
+	ProductCurrent = "current"
+)
+
+func isValidProductType(p string) bool {
+	return p == ProductSavings || p == ProductCurrent
+}
+
+var isValidPhone = regexp.MustCompile(`^\+?[0-9]{8,15}$`).MatchString
+
+// isValidDateOfBirth accepts a DateLayout date that is not in the future.
+func isValidDateOfBirth(s string) bool {
+	dob, err := time.Parse(DateLayout, s)
+	return err == nil && !dob.After(time.Now())
+}
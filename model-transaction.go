@@ -1,117 +1,117 @@
 package main
 
 import (
-	"database/sql"
 	"time"
 )
 
 type Transaction struct {
 	TransactionID       uint64    `json:"transid"`
+	Kind                string    `json:"kind"`
 	DepositDest         uint32    `json:"depositdest"`
 	ExternalSource      string    `json:"externalsource"`
 	InternalSource      uint32    `json:"internalsource"`
 	InternalSourceEmail string    `json:"internalsourceemail"`
 	Name                string    `json:"name"`
-	Amount              float64   `json:"amount"`
+	Amount              Money     `json:"amount"`
 	TransactionTime     time.Time `json:"transtime"`
+
+	// CreatedBy is the Principal.Actor that created the transaction.
+	CreatedBy string `json:"createdby,omitempty"`
+
+	// Status is StatusReversed once a reversal has been posted for the
+	// transaction, and StatusPosted otherwise.
+	Status string `json:"status"`
+
+	// ReversalOf, ReasonCode and Operator are set on reversals only.
+	ReversalOf uint64 `json:"reversalof,omitempty"`
+	ReasonCode string `json:"reasoncode,omitempty"`
+	Operator   string `json:"operator,omitempty"`
+
+	// Direction is DirectionCredit or DirectionDebit from the point of view
+	// of the account whose history is listed. It is only set by GetHistory.
+	Direction string `json:"direction,omitempty"`
+
+	// DepositDestEmail is the destination account holder's email, filled
+	// in while a transaction is created so notifications can reach them.
+	DepositDestEmail string `json:"-"`
+
+	// DepositDestEmailVerified and InternalSourceEmailVerified say whether
+	// the account holders have verified those addresses.
+	DepositDestEmailVerified    bool `json:"-"`
+	InternalSourceEmailVerified bool `json:"-"`
+
+	// DepositDestBalance is the destination account's balance after a
+	// deposit or transfer, and DepositDestNotifications and
+	// InternalSourceNotifications the preferences of the accounts involved.
+	// They are filled in while a deposit or transfer is created.
+	DepositDestBalance          Money                   `json:"-"`
+	DepositDestNotifications    NotificationPreferences `json:"-"`
+	InternalSourceNotifications NotificationPreferences `json:"-"`
 }
 
-func (trans *Transaction) getHistory(db *sql.DB) ([]Transaction, error) {
-	var q string = `SELECT tl.destination, tl.transaction_time, tl.transaction_id, COALESCE(tl.source_external,""), COALESCE(tl.source_internal,0), tl.amount, COALESCE(acc.name,""), COALESCE(acc.email,"")
-									FROM transaction_log tl
-									LEFT JOIN account acc ON acc.account_id = tl.source_internal
-									WHERE destination = ?
-									ORDER BY transaction_time DESC`
-	rows, err := db.Query(q, trans.DepositDest)
+// Directions for Transaction.Direction.
+const (
+	DirectionCredit = "credit"
+	DirectionDebit  = "debit"
+)
 
-	if err != nil {
-		return nil, err
+// direction maps the net amount a transaction posted to an account to the
+// account's point of view.
+func direction(net Money) string {
+	if net < 0 {
+		return DirectionDebit
 	}
+	return DirectionCredit
+}
 
-	defer rows.Close()
+// Transaction statuses for Transaction.Status.
+const (
+	StatusPosted   = "posted"
+	StatusReversed = "reversed"
+)
 
-	transactions := []Transaction{}
-	for rows.Next() {
-		var t Transaction
-		err := rows.Scan(&t.DepositDest, &t.TransactionTime, &t.TransactionID, &t.ExternalSource, &t.InternalSource, &t.Amount, &t.Name, &t.InternalSourceEmail)
+// Reason codes accepted for reversals.
+var ReasonCodes = []string{"wrong_amount", "wrong_account", "duplicate", "customer_request", "other"}
 
-		if err != nil {
-			return nil, err
+func isValidReasonCode(code string) bool {
+	for _, c := range ReasonCodes {
+		if c == code {
+			return true
 		}
-		transactions = append(transactions, t)
 	}
-
-	return transactions, nil
+	return false
 }
 
-func (trans *Transaction) createTransaction(db *sql.DB) error {
-	var q string
-
-	var res sql.Result
-
-	if trans.InternalSource == 0 {
-		q = `INSERT INTO transaction_log
-				(source_external, destination, amount)
-				VALUES
-				(?,?,?)`
-		r, err := db.Exec(q, trans.ExternalSource, trans.DepositDest, trans.Amount)
-		if err != nil {
-			return err
-		}
-		res = r
-	} else {
-		q = `INSERT INTO transaction_log
-				(source_internal, destination, amount)
-				VALUES
-				(?,?,?)`
-		r, err := db.Exec(q, trans.InternalSource, trans.DepositDest, trans.Amount)
-		if err != nil {
-			return err
-		}
-
-		q = `SELECT email
-				 FROM account
-				 WHERE account_id = ?`
-		db.QueryRow(q, trans.InternalSource).Scan(&trans.InternalSourceEmail)
+// Transaction sources for TransactionFilter.Source.
+const (
+	SourceInternal = "internal"
+	SourceExternal = "external"
+)
 
-		res = r
-	}
+// TransactionFilter selects a page of the transaction log. Results are
+// ordered newest first by transaction time, then transaction ID, and start
+// strictly after the (BeforeTime, BeforeID) key when BeforeID is set.
+type TransactionFilter struct {
+	Limit int
 
-	id, err := res.LastInsertId()
-	if err != nil {
-		return err
-	}
-	trans.TransactionID = uint64(id)
-	q = `SELECT transaction_time
-			FROM transaction_log
-			WHERE transaction_id = ?`
-	db.QueryRow(q, trans.TransactionID).Scan(&trans.TransactionTime)
-	return nil
-}
+	BeforeTime time.Time
+	BeforeID   uint64
 
-func (trans *Transaction) getTransactions(db *sql.DB) ([]Transaction, error) {
-	var q string = `SELECT tl.destination, tl.transaction_time, tl.transaction_id, COALESCE(tl.source_external,""), COALESCE(tl.source_internal,0), tl.amount, COALESCE(acc.name,""), COALESCE(acc.email,"")
-									FROM transaction_log tl
-									LEFT JOIN account acc ON acc.account_id = tl.source_internal
-									ORDER BY transaction_time DESC`
-	rows, err := db.Query(q)
+	// From is inclusive and To exclusive; zero values are unbounded.
+	From time.Time
+	To   time.Time
 
-	if err != nil {
-		return nil, err
-	}
+	MinAmount *Money
+	MaxAmount *Money
 
-	defer rows.Close()
+	// Source is SourceInternal, SourceExternal or empty for both.
+	Source string
 
-	transactions := []Transaction{}
-	for rows.Next() {
-		var t Transaction
-		err := rows.Scan(&t.DepositDest, &t.TransactionTime, &t.TransactionID, &t.ExternalSource, &t.InternalSource, &t.Amount, &t.Name, &t.InternalSourceEmail)
-
-		if err != nil {
-			return nil, err
-		}
-		transactions = append(transactions, t)
-	}
+	Destination uint32
+}
 
-	return transactions, nil
+// TransactionPage is one page of GET /transaction.
+type TransactionPage struct {
+	Transactions []Transaction `json:"transactions"`
+	NextCursor   string        `json:"next_cursor"`
 }
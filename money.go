@@ -0,0 +1,165 @@
+package main
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Money is an amount of Rupiah stored as an integer number of minor units
+// (sen, 1/100 of a Rupiah). All arithmetic on Money is exact integer
+// arithmetic, so summing a large ledger never drifts.
+//
+// In JSON, Money is written as a string holding a decimal number
+// ("1325000" or "1325000.50"), so clients that read JSON numbers as
+// floating point do not round it. It can be read back from that string or
+// from a JSON number.
+//
+// Rounding rule: amounts with more than two decimal places are rounded to
+// the nearest sen, with halves rounded away from zero ("1.005" -> 1.01,
+// "1.0049" -> 1.00). Exponent notation is not accepted.
+type Money int64
+
+// MinorUnits is the number of minor units (sen) in one Rupiah.
+const MinorUnits = 100
+
+const minorDigits = 2
+
+var errInvalidMoney = errors.New("invalid money amount")
+
+// ParseMoney parses a decimal amount such as "1325000", "-12.5" or
+// "0.015" into Money, applying the rounding rule documented on Money.
+func ParseMoney(s string) (Money, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, errInvalidMoney
+	}
+
+	neg := false
+	switch s[0] {
+	case '-':
+		neg = true
+		s = s[1:]
+	case '+':
+		s = s[1:]
+	}
+
+	whole, frac := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		whole, frac = s[:i], s[i+1:]
+	}
+	if whole == "" && frac == "" || !isDigits(whole) || !isDigits(frac) {
+		return 0, errInvalidMoney
+	}
+
+	roundUp := false
+	if len(frac) > minorDigits {
+		roundUp = frac[minorDigits] >= '5'
+		frac = frac[:minorDigits]
+	}
+	frac += strings.Repeat("0", minorDigits-len(frac))
+	if whole == "" {
+		whole = "0"
+	}
+
+	units, err := strconv.ParseInt(whole+frac, 10, 64)
+	if err != nil {
+		return 0, errInvalidMoney
+	}
+	if roundUp {
+		units++
+		if units < 0 {
+			return 0, errInvalidMoney
+		}
+	}
+	if neg {
+		units = -units
+	}
+	return Money(units), nil
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// String formats m as a decimal number of Rupiah. Whole amounts have no
+// fractional part; anything else is written with exactly two decimals.
+func (m Money) String() string {
+	// The magnitude is taken as a uint64, since negating math.MinInt64
+	// overflows.
+	units := uint64(m)
+	sign := ""
+	if m < 0 {
+		sign = "-"
+		units = -units
+	}
+	whole, frac := units/MinorUnits, units%MinorUnits
+	if frac == 0 {
+		return fmt.Sprintf("%s%d", sign, whole)
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, whole, frac)
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(m.String())), nil
+}
+
+func (m *Money) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		return nil
+	}
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		s = s[1 : len(s)-1]
+	}
+	v, err := ParseMoney(s)
+	if err != nil {
+		return err
+	}
+	*m = v
+	return nil
+}
+
+// Value stores Money as a BIGINT number of minor units.
+func (m Money) Value() (driver.Value, error) {
+	return int64(m), nil
+}
+
+// Scan reads a number of minor units. Aggregates such as SUM() over a
+// BIGINT column come back from some drivers as decimal text, so integral
+// strings are accepted too.
+func (m *Money) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*m = 0
+	case int64:
+		*m = Money(v)
+	case []byte:
+		return m.scanString(string(v))
+	case string:
+		return m.scanString(v)
+	default:
+		return fmt.Errorf("cannot scan %T into Money", src)
+	}
+	return nil
+}
+
+func (m *Money) scanString(s string) error {
+	// DECIMAL aggregates may carry a ".0000" suffix.
+	if i := strings.IndexByte(s, '.'); i >= 0 && strings.Trim(s[i+1:], "0") == "" {
+		s = s[:i]
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return fmt.Errorf("cannot scan %q into Money", s)
+	}
+	*m = Money(v)
+	return nil
+}
@@ -0,0 +1,89 @@
+package main_test
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	. "github.com/mikeadityas/simple-cash-deposit-be"
+)
+
+func TestParseMoney(t *testing.T) {
+	cases := []struct {
+		in   string
+		want Money
+	}{
+		{"0", 0},
+		{"1325000", 132500000},
+		{"1325000.5", 132500050},
+		{"0.01", 1},
+		{".5", 50},
+		{"1.005", 101},
+		{"1.0049", 100},
+		{"-1.005", -101},
+		{"0.004", 0},
+	}
+
+	for _, c := range cases {
+		got, err := ParseMoney(c.in)
+		if err != nil {
+			t.Errorf("ParseMoney(%q) returned error %v", c.in, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("ParseMoney(%q) = %d. Expected %d", c.in, got, c.want)
+		}
+	}
+
+	for _, in := range []string{"", ".", "abc", "1e6", "1,000", "1.2.3", "3879000aaa"} {
+		if _, err := ParseMoney(in); err == nil {
+			t.Errorf("Expected ParseMoney(%q) to fail", in)
+		}
+	}
+}
+
+func TestMoneyJSONRoundTrip(t *testing.T) {
+	var v struct {
+		Number Money `json:"number"`
+		Text   Money `json:"text"`
+	}
+
+	err := json.Unmarshal([]byte(`{"number":1325000.10,"text":"0.20"}`), &v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v.Number != 132500010 || v.Text != 20 {
+		t.Errorf("Expected 132500010 and 20 minor units. Got %d and %d", v.Number, v.Text)
+	}
+
+	out, _ := json.Marshal(v)
+	if string(out) != `{"number":"1325000.10","text":"0.20"}` {
+		t.Errorf("Unexpected JSON %s", out)
+	}
+
+	out, _ = json.Marshal(Money(3879000 * MinorUnits))
+	if string(out) != `"3879000"` {
+		t.Errorf("Expected whole amounts without a fractional part. Got %s", out)
+	}
+}
+
+func TestMoneyString(t *testing.T) {
+	cases := []struct {
+		in   Money
+		want string
+	}{
+		{0, "0"},
+		{5, "0.05"},
+		{-5, "-0.05"},
+		{-132500050, "-1325000.50"},
+		{math.MaxInt64, "92233720368547758.07"},
+		{math.MinInt64, "-92233720368547758.08"},
+	}
+
+	for _, c := range cases {
+		if got := c.in.String(); got != c.want {
+			t.Errorf("Money(%d).String() = %q. Expected %q", int64(c.in), got, c.want)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Bounds on the length of a normalized name, in characters.
+const (
+	minNameLength = 3
+	maxNameLength = 100
+)
+
+// NormalizeName returns name in Unicode normalization form C with runs
+// of whitespace collapsed to a single space and none at either end, the
+// form in which names are validated and stored.
+func NormalizeName(name string) string {
+	return strings.Join(strings.Fields(norm.NFC.String(name)), " ")
+}
+
+// isValidName accepts a normalized name of letters, with the combining
+// marks that belong to them, separated by single spaces, apostrophes,
+// hyphens and periods, as in "Siti Nur'aini", "José", "Jean-Luc" or
+// "M. Hatta". It must start with a letter and must not contain two
+// punctuation marks in a row.
+func isValidName(name string) bool {
+	if n := utf8.RuneCountInString(name); n < minNameLength || n > maxNameLength {
+		return false
+	}
+
+	// Starting from a space rejects names that begin with anything but a
+	// letter.
+	prev := ' '
+	for _, r := range name {
+		switch {
+		case unicode.IsLetter(r):
+		case unicode.Is(unicode.M, r):
+			if !unicode.IsLetter(prev) && !unicode.Is(unicode.M, prev) {
+				return false
+			}
+		case r == ' ':
+			if prev == ' ' {
+				return false
+			}
+		case isNamePunct(r):
+			if prev == ' ' || isNamePunct(prev) {
+				return false
+			}
+		default:
+			return false
+		}
+		prev = r
+	}
+	return true
+}
+
+// nameRule explains isValidName to clients.
+const nameRule = "must be 3 to 100 letters, single spaces, apostrophes, hyphens and periods, starting with a letter"
+
+// isNamePunct reports whether r is punctuation allowed inside a name:
+// apostrophes, hyphens and periods.
+func isNamePunct(r rune) bool {
+	switch r {
+	case '\'', '’', '-', '‐', '.':
+		return true
+	}
+	return false
+}
+
+// nameSearchKey returns the case-folded form of a name used to search by
+// name regardless of case, so "STRAUSS" finds "Strauß".
+func nameSearchKey(name string) string {
+	return cases.Fold().String(norm.NFC.String(name))
+}
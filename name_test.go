@@ -0,0 +1,88 @@
+package main_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	. "github.com/mikeadityas/simple-cash-deposit-be"
+)
+
+func TestNormalizeName(t *testing.T) {
+	cases := map[string]string{
+		"  Siti \t Nur'aini ": "Siti Nur'aini",
+		"José":               "José",
+		"Jean-Luc\nPicard":    "Jean-Luc Picard",
+	}
+	for name, expected := range cases {
+		if got := NormalizeName(name); got != expected {
+			t.Errorf("Expected %q to normalize to %q. Got %q", name, expected, got)
+		}
+	}
+}
+
+func TestCreateAccountUnicodeName(t *testing.T) {
+	clearTable()
+
+	valid := map[string]string{
+		"Siti Nur'aini":      "Siti Nur'aini",
+		"José":              "José",
+		"  Jean-Luc  Picard": "Jean-Luc Picard",
+		"M. Hatta":           "M. Hatta",
+		"Strauß":             "Strauß",
+		"Nguyễn Văn An":      "Nguyễn Văn An",
+	}
+	serial := 0
+	for name, stored := range valid {
+		serial++
+		payload := `{"idcardno":"` + fmt.Sprintf("3171093101900%03d", serial) + `","name":"` + name + `","email":"someone@mail.com"}`
+		req, _ := http.NewRequest("POST", "/account", bytes.NewBufferString(payload))
+		response := executeRequest(req)
+		checkResponseCode(t, http.StatusCreated, response.Code)
+
+		var acc Account
+		json.Unmarshal(response.Body.Bytes(), &acc)
+		if acc.Name != stored {
+			t.Errorf("Expected %q to be stored as %q. Got %q", name, stored, acc.Name)
+		}
+	}
+
+	invalid := []string{"   ", "Al", "th3nun", "-Budi", "Budi--Santoso", "O''Neil", "Budi_Santoso", "́Budi", strings.Repeat("a", 101)}
+	for _, name := range invalid {
+		payload, _ := json.Marshal(map[string]string{"idcardno": generateNIK(), "name": name, "email": "someone@mail.com"})
+		req, _ := http.NewRequest("POST", "/account", bytes.NewBuffer(payload))
+		response := executeRequest(req)
+		checkResponseCode(t, http.StatusBadRequest, response.Code)
+	}
+
+	req, _ := http.NewRequest("PATCH", "/account/1", bytes.NewBufferString(`{"name":"   "}`))
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusBadRequest, response.Code)
+}
+
+func TestSearchAccountsByFoldedName(t *testing.T) {
+	clearTable()
+	a.Store.CreateAccount(&Account{IDCard: "3171093101900001", Name: "Johann Strauß", Email: "strauss@mail.com"}, nil, nil)
+	a.Store.CreateAccount(&Account{IDCard: "3171095205920002", Name: "José Rizal", Email: "jose@mail.com"}, nil, nil)
+
+	cases := map[string]uint32{
+		"JOHANN STRAUSS": 1,
+		"johann strauß":  1,
+		"JOSÉ":           2,
+		"José":          2,
+	}
+	for prefix, id := range cases {
+		req, _ := http.NewRequest("GET", "/account?name="+strings.ReplaceAll(prefix, " ", "%20"), nil)
+		response := executeRequest(req)
+		checkResponseCode(t, http.StatusOK, response.Code)
+
+		var page AccountPage
+		json.Unmarshal(response.Body.Bytes(), &page)
+		if len(page.Accounts) != 1 || page.Accounts[0].AccountID != id {
+			t.Errorf("Expected %q to find account %d. Got %+v", prefix, id, page.Accounts)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/csv"
+	"strings"
+	"time"
+)
+
+// A NIK (Nomor Induk Kependudukan), the number on an Indonesian ID card,
+// is 16 digits: a six digit region code (province, regency or city, and
+// district), the holder's date of birth as DDMMYY with 40 added to the
+// day for women, and a four digit serial number.
+type NIK struct {
+	// RegionCode is the district code as "PP.RR.DD". The names are those
+	// in regions.csv, and empty where it does not list the region.
+	RegionCode string `json:"regioncode"`
+	Province   string `json:"province"`
+	Regency    string `json:"regency,omitempty"`
+	District   string `json:"district,omitempty"`
+
+	BirthDate string `json:"birthdate"`
+	Sex       string `json:"sex"`
+}
+
+// Sexes encoded in a NIK.
+const (
+	SexMale   = "male"
+	SexFemale = "female"
+)
+
+// NIKError explains why a NIK was rejected. Code is one of the NIK*
+// constants.
+type NIKError struct {
+	Code   string
+	Reason string
+}
+
+func (e *NIKError) Error() string {
+	return e.Reason
+}
+
+// Codes of NIKError.
+const (
+	NIKFormat    = "nik_format"
+	NIKProvince  = "nik_province"
+	NIKRegency   = "nik_regency"
+	NIKDistrict  = "nik_district"
+	NIKBirthDate = "nik_birth_date"
+	NIKSerial    = "nik_serial"
+)
+
+//go:embed regions.csv
+var regionData string
+
+// regions maps region codes to names, and regionParents holds the codes
+// that have regions listed under them.
+var regions, regionParents = loadRegions(regionData)
+
+func loadRegions(data string) (map[string]string, map[string]bool) {
+	r := csv.NewReader(strings.NewReader(data))
+	r.Comment = '#'
+	records, err := r.ReadAll()
+	if err != nil {
+		panic("regions.csv: " + err.Error())
+	}
+
+	names := map[string]string{}
+	parents := map[string]bool{}
+	for _, rec := range records[1:] {
+		code := rec[0]
+		names[code] = rec[1]
+		if i := strings.LastIndexByte(code, '.'); i >= 0 {
+			parents[code[:i]] = true
+		}
+	}
+	return names, parents
+}
+
+// ParseNIK checks the structure of a NIK and returns what it encodes. The
+// error is a *NIKError.
+func ParseNIK(s string) (NIK, error) {
+	if len(s) != 16 || strings.Trim(s, "0123456789") != "" {
+		return NIK{}, &NIKError{NIKFormat, "must be 16 digits"}
+	}
+
+	province, regency, district := s[0:2], s[0:2]+"."+s[2:4], s[0:2]+"."+s[2:4]+"."+s[4:6]
+	nik := NIK{RegionCode: district, Province: regions[province], Regency: regions[regency], District: regions[district]}
+	if nik.Province == "" {
+		return NIK{}, &NIKError{NIKProvince, "unknown province code " + province}
+	}
+	if s[2:4] == "00" || regionParents[province] && nik.Regency == "" {
+		return NIK{}, &NIKError{NIKRegency, "unknown regency code " + regency}
+	}
+	if s[4:6] == "00" || regionParents[regency] && nik.District == "" {
+		return NIK{}, &NIKError{NIKDistrict, "unknown district code " + district}
+	}
+
+	birth, sex, ok := nikBirthDate(s[6:12], time.Now())
+	if !ok {
+		return NIK{}, &NIKError{NIKBirthDate, "invalid date of birth " + s[6:12]}
+	}
+	nik.BirthDate = birth.Format(DateLayout)
+	nik.Sex = sex
+
+	if s[12:] == "0000" {
+		return NIK{}, &NIKError{NIKSerial, "invalid serial number 0000"}
+	}
+	return nik, nil
+}
+
+// nikBirthDate decodes DDMMYY, where women have 40 added to the day. The
+// century is the latest one that does not put the date after now.
+func nikBirthDate(ddmmyy string, now time.Time) (time.Time, string, bool) {
+	day, month, year := atoi2(ddmmyy[0:2]), atoi2(ddmmyy[2:4]), atoi2(ddmmyy[4:6])
+
+	sex := SexMale
+	if day > 40 {
+		day -= 40
+		sex = SexFemale
+	}
+
+	date := time.Date(2000+year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	if date.After(now) {
+		date = date.AddDate(-100, 0, 0)
+	}
+	if date.Day() != day || int(date.Month()) != month {
+		return time.Time{}, "", false
+	}
+	return date, sex, true
+}
+
+// atoi2 converts two ASCII digits.
+func atoi2(s string) int {
+	return int(s[0]-'0')*10 + int(s[1]-'0')
+}
+
+// describeNIK returns what the ID card number encodes, or nil if it is not
+// a valid NIK, as may be the case for records stored before NIKs were
+// checked.
+func describeNIK(s string) *NIK {
+	nik, err := ParseNIK(s)
+	if err != nil {
+		return nil
+	}
+	return &nik
+}
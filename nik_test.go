@@ -0,0 +1,93 @@
+package main_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	. "github.com/mikeadityas/simple-cash-deposit-be"
+)
+
+func TestParseNIK(t *testing.T) {
+	nik, err := ParseNIK("3171095205920002")
+	if err != nil {
+		t.Fatalf("Expected a valid NIK. Got %v", err)
+	}
+	expected := NIK{RegionCode: "31.71.09", Province: "DKI Jakarta", Regency: "Kota Jakarta Selatan", District: "Tebet", BirthDate: "1992-05-12", Sex: SexFemale}
+	if nik != expected {
+		t.Errorf("Expected %+v. Got %+v", expected, nik)
+	}
+
+	// Regencies and districts are only checked where the table lists them.
+	nik, err = ParseNIK("3273013101900001")
+	if err != nil || nik.Province != "Jawa Barat" || nik.Regency != "" || nik.Sex != SexMale {
+		t.Errorf("Expected a valid NIK from Jawa Barat. Got %+v, %v", nik, err)
+	}
+
+	// The century is the latest one that does not put the birth date in
+	// the future.
+	yy := time.Now().Year() % 100
+	nik, err = ParseNIK("3171090101010001")
+	if err != nil || nik.BirthDate != "2001-01-01" {
+		t.Errorf("Expected a birth date in 2001. Got %+v, %v", nik, err)
+	}
+	future := strconv.Itoa(100 + (yy+1)%100)[1:]
+	nik, err = ParseNIK("3171090101" + future + "0001")
+	if err != nil || nik.BirthDate[:2] != "19" {
+		t.Errorf("Expected a birth date in the 1900s. Got %+v, %v", nik, err)
+	}
+
+	cases := map[string]string{
+		"31710931019000":   NIKFormat,
+		"317109310190000A": NIKFormat,
+		"9971093101900001": NIKProvince,
+		"3100093101900001": NIKRegency,
+		"3199093101900001": NIKRegency,
+		"3171003101900001": NIKDistrict,
+		"3171993101900001": NIKDistrict,
+		"3171093202900001": NIKBirthDate,
+		"3171097102900001": NIKBirthDate,
+		"3171093513900001": NIKBirthDate,
+		"3171090001900001": NIKBirthDate,
+		"3171093101900000": NIKSerial,
+	}
+	for s, code := range cases {
+		_, err := ParseNIK(s)
+		var nikErr *NIKError
+		if !errors.As(err, &nikErr) || nikErr.Code != code {
+			t.Errorf("Expected %s to be rejected with %s. Got %v", s, code, err)
+		}
+	}
+}
+
+func TestCreateAccountNIK(t *testing.T) {
+	clearTable()
+
+	req, _ := http.NewRequest("POST", "/account", bytes.NewBufferString(`{"idcardno":"9971093101900001","name":"Michael","email":"michaeladityas@live.com"}`))
+	response := executeRequest(req)
+	checkProblem(t, response, map[string]string{"idcardno": NIKProvince})
+
+	var p Problem
+	json.Unmarshal(response.Body.Bytes(), &p)
+	if p.Errors[0].Message != "unknown province code 99" {
+		t.Errorf("Expected the unknown province to be reported. Got %+v", p)
+	}
+
+	req, _ = http.NewRequest("POST", "/account", bytes.NewBufferString(`{"idcardno":"3171095205920002","name":"Siti","email":"siti@mail.com"}`))
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusCreated, response.Code)
+
+	req, _ = http.NewRequest("GET", "/account/1", nil)
+	response = executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+
+	var acc Account
+	json.Unmarshal(response.Body.Bytes(), &acc)
+	if acc.IDCardInfo == nil || acc.IDCardInfo.District != "Tebet" || acc.IDCardInfo.BirthDate != "1992-05-12" || acc.IDCardInfo.Sex != SexFemale {
+		t.Errorf("Expected the ID card details on the account. Got %+v", acc.IDCardInfo)
+	}
+}
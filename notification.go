@@ -0,0 +1,107 @@
+package main
+
+import (
+	"strconv"
+	"time"
+)
+
+// Notification is a message for a customer, such as a deposit receipt.
+type Notification struct {
+	Kind      string
+	Recipient string
+	Subject   string
+	Body      string
+
+	// Unverified is set when Recipient is a customer's address that has
+	// not been verified yet. The outbox holds such notifications until it
+	// is.
+	Unverified bool
+}
+
+// depositNotifications renders the email telling the depositor that their
+// deposit went through, and the one telling the destination account's
+// holder that it was credited, as their accounts' preferences allow.
+func depositNotifications(trans Transaction) []Notification {
+	dest := strconv.Itoa(int(trans.DepositDest))
+	ref := strconv.Itoa(int(trans.TransactionID))
+	notes := []Notification{}
+
+	// Depositors who are not customers give an address that cannot be
+	// verified, so it is used as it is, and have no preferences.
+	made := Notification{
+		Kind:      "deposit_made",
+		Recipient: trans.ExternalSource,
+		Subject:   "Cash Deposit Notification",
+		Body:      "You have successfully deposited " + trans.Amount.String() + " to account number " + dest + ". Ref No. #" + ref,
+	}
+	if trans.InternalSourceEmail != "" {
+		made.Recipient = trans.InternalSourceEmail
+		made.Unverified = !trans.InternalSourceEmailVerified
+	}
+	if trans.InternalSource == 0 || trans.InternalSourceNotifications.notifiesMade(trans.Amount) {
+		notes = append(notes, made)
+	}
+
+	if trans.DepositDestNotifications.notifiesReceived(trans.Amount) {
+		notes = append(notes, Notification{
+			Kind:       "deposit_received",
+			Recipient:  trans.DepositDestEmail,
+			Subject:    "Cash Deposit Notification",
+			Body:       "Your account number " + dest + " has received a deposit of " + trans.Amount.String() + ". Your new balance is " + trans.DepositDestBalance.String() + ". Ref No. #" + ref,
+			Unverified: !trans.DepositDestEmailVerified,
+		})
+	}
+	return notes
+}
+
+// transferNotifications renders the email to the sender of a transfer and,
+// as the destination account's deposit preferences allow, the one telling
+// the recipient their new balance.
+func transferNotifications(trans Transaction) []Notification {
+	amount := trans.Amount.String()
+	src := strconv.Itoa(int(trans.InternalSource))
+	dest := strconv.Itoa(int(trans.DepositDest))
+	ref := strconv.Itoa(int(trans.TransactionID))
+
+	notes := []Notification{{
+		Kind:       "transfer_sent",
+		Recipient:  trans.InternalSourceEmail,
+		Subject:    "Transfer Notification",
+		Body:       "You have successfully transferred " + amount + " from account number " + src + " to account number " + dest + ". Ref No. #" + ref,
+		Unverified: !trans.InternalSourceEmailVerified,
+	}}
+	if trans.DepositDestNotifications.notifiesReceived(trans.Amount) {
+		notes = append(notes, Notification{
+			Kind:       "transfer_received",
+			Recipient:  trans.DepositDestEmail,
+			Subject:    "Transfer Notification",
+			Body:       "You have received " + amount + " from account number " + src + " to account number " + dest + ". Your new balance is " + trans.DepositDestBalance.String() + ". Ref No. #" + ref,
+			Unverified: !trans.DepositDestEmailVerified,
+		})
+	}
+	return notes
+}
+
+// withdrawalNotifications renders the email telling the account holder
+// that cash was withdrawn from their account.
+func withdrawalNotifications(trans Transaction) []Notification {
+	return []Notification{{
+		Kind:       "withdrawal_made",
+		Recipient:  trans.DepositDestEmail,
+		Subject:    "Cash Withdrawal Notification",
+		Body:       "You have successfully withdrawn " + trans.Amount.String() + " from account number " + strconv.Itoa(int(trans.DepositDest)) + ". Ref No. #" + strconv.Itoa(int(trans.TransactionID)),
+		Unverified: !trans.DepositDestEmailVerified,
+	}}
+}
+
+// verificationNotification renders the email with the link that verifies
+// a customer's address. It goes out whether or not the address is
+// verified.
+func verificationNotification(email, link string, expires time.Time) Notification {
+	return Notification{
+		Kind:      "email_verification",
+		Recipient: email,
+		Subject:   "Verify your email address",
+		Body:      "Please confirm that this is your email address by opening " + link + " before " + expires.UTC().Format(time.RFC1123) + ". You will not receive account notifications until you do.",
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Notifier delivers a notification to its recipient. The outbox dispatcher
+// retries deliveries that return an error.
+type Notifier interface {
+	Notify(n Notification) error
+}
+
+// formatEmail renders n as an RFC 5322 message with "\n" line endings.
+func formatEmail(from string, n Notification, date time.Time) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\n", from)
+	fmt.Fprintf(&b, "To: %s\n", n.Recipient)
+	fmt.Fprintf(&b, "Subject: %s\n", n.Subject)
+	fmt.Fprintf(&b, "Date: %s\n", date.Format(time.RFC1123Z))
+	fmt.Fprintf(&b, "X-Notification-Kind: %s\n", n.Kind)
+	b.WriteString("\n")
+	b.WriteString(n.Body)
+	b.WriteString("\n")
+	return b.Bytes()
+}
+
+// SMTPNotifier sends notifications as email through an SMTP server using
+// PLAIN authentication.
+type SMTPNotifier struct {
+	Server   string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func (sn *SMTPNotifier) Notify(n Notification) error {
+	auth := smtp.PlainAuth("", sn.Username, sn.Password, sn.Server)
+	msg := formatEmail(sn.From, n, time.Now())
+	return smtp.SendMail(sn.Server+":"+sn.Port, auth, sn.From, []string{n.Recipient}, msg)
+}
+
+// MaildirNotifier writes every notification as a new message into a
+// Maildir, for reading with any mail client during local development.
+type MaildirNotifier struct {
+	Dir  string
+	From string
+
+	mu  sync.Mutex
+	seq int
+}
+
+func (mn *MaildirNotifier) Notify(n Notification) error {
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		if err := os.MkdirAll(filepath.Join(mn.Dir, sub), 0700); err != nil {
+			return err
+		}
+	}
+
+	mn.mu.Lock()
+	mn.seq++
+	seq := mn.seq
+	mn.mu.Unlock()
+
+	host, _ := os.Hostname()
+	now := time.Now()
+	name := fmt.Sprintf("%d.M%dP%dQ%d.%s", now.Unix(), now.Nanosecond()/1000, os.Getpid(), seq, strings.Replace(host, "/", "_", -1))
+
+	// Deliver through tmp/ so readers never see a partial message.
+	tmp := filepath.Join(mn.Dir, "tmp", name)
+	if err := os.WriteFile(tmp, formatEmail(mn.From, n, now), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(mn.Dir, "new", name))
+}
+
+// MboxNotifier appends every notification to a single mbox file.
+type MboxNotifier struct {
+	Path string
+	From string
+
+	mu sync.Mutex
+}
+
+func (mn *MboxNotifier) Notify(n Notification) error {
+	mn.mu.Lock()
+	defer mn.mu.Unlock()
+
+	f, err := os.OpenFile(mn.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From %s %s\n", mboxSender(mn.From), now.UTC().Format(time.ANSIC))
+	for _, line := range strings.SplitAfter(string(formatEmail(mn.From, n, now)), "\n") {
+		// mboxrd quoting keeps body lines from starting a new message.
+		if strings.HasPrefix(strings.TrimLeft(line, ">"), "From ") {
+			b.WriteString(">")
+		}
+		b.WriteString(line)
+	}
+	b.WriteString("\n")
+
+	if _, err := f.Write(b.Bytes()); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func mboxSender(from string) string {
+	if from == "" {
+		return "MAILER-DAEMON"
+	}
+	return strings.Fields(from)[0]
+}
+
+// LogNotifier writes every notification as a single JSON log line instead
+// of delivering it.
+type LogNotifier struct {
+	// Logger defaults to the standard logger.
+	Logger *log.Logger
+}
+
+func (ln *LogNotifier) Notify(n Notification) error {
+	line, err := json.Marshal(map[string]string{
+		"event":     "notification",
+		"kind":      n.Kind,
+		"recipient": n.Recipient,
+		"subject":   n.Subject,
+		"body":      n.Body,
+	})
+	if err != nil {
+		return err
+	}
+
+	if ln.Logger == nil {
+		log.Print(string(line))
+	} else {
+		ln.Logger.Print(string(line))
+	}
+	return nil
+}
+
+// RecorderNotifier keeps notifications in memory so tests can assert on
+// exactly what was sent.
+type RecorderNotifier struct {
+	mu   sync.Mutex
+	sent []Notification
+	err  error
+}
+
+func (rn *RecorderNotifier) Notify(n Notification) error {
+	rn.mu.Lock()
+	defer rn.mu.Unlock()
+
+	if rn.err != nil {
+		return rn.err
+	}
+	rn.sent = append(rn.sent, n)
+	return nil
+}
+
+// Sent returns the notifications delivered so far, oldest first.
+func (rn *RecorderNotifier) Sent() []Notification {
+	rn.mu.Lock()
+	defer rn.mu.Unlock()
+
+	return append([]Notification(nil), rn.sent...)
+}
+
+// FailWith makes every following Notify call return err, or succeed again
+// when err is nil.
+func (rn *RecorderNotifier) FailWith(err error) {
+	rn.mu.Lock()
+	defer rn.mu.Unlock()
+
+	rn.err = err
+}
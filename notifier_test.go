@@ -0,0 +1,71 @@
+package main_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/mikeadityas/simple-cash-deposit-be"
+)
+
+var testNotification = Notification{
+	Kind:      "deposit_made",
+	Recipient: "james@mail.com",
+	Subject:   "Cash Deposit Notification",
+	Body:      "From now on, your balance is 10.\nRef No. #1",
+}
+
+func TestMaildirNotifier(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "maildir")
+	defer os.RemoveAll(dir)
+
+	n := &MaildirNotifier{Dir: dir, From: "bank@mail.com"}
+	if err := n.Notify(testNotification); err != nil {
+		t.Fatal(err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "new", "*"))
+	if len(files) != 1 {
+		t.Fatalf("Expected 1 message in new/. Got %d", len(files))
+	}
+
+	msg, _ := ioutil.ReadFile(files[0])
+	for _, want := range []string{"From: bank@mail.com\n", "To: james@mail.com\n", "Subject: Cash Deposit Notification\n", "\n\nFrom now on, your balance is 10.\n"} {
+		if !strings.Contains(string(msg), want) {
+			t.Errorf("Expected message to contain %q. Got %s", want, msg)
+		}
+	}
+}
+
+func TestMboxNotifier(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "mbox")
+	defer os.RemoveAll(dir)
+
+	n := &MboxNotifier{Path: filepath.Join(dir, "mbox"), From: "bank@mail.com"}
+	n.Notify(testNotification)
+	n.Notify(testNotification)
+
+	mbox, _ := ioutil.ReadFile(n.Path)
+	if c := strings.Count(string(mbox), "\nFrom bank@mail.com "); c != 1 || !strings.HasPrefix(string(mbox), "From bank@mail.com ") {
+		t.Errorf("Expected 2 messages in the mbox. Got %s", mbox)
+	}
+
+	if !strings.Contains(string(mbox), "\n>From now on") {
+		t.Errorf("Expected body lines starting with 'From ' to be quoted. Got %s", mbox)
+	}
+}
+
+func TestLogNotifier(t *testing.T) {
+	var buf bytes.Buffer
+	n := &LogNotifier{Logger: log.New(&buf, "", 0)}
+	n.Notify(testNotification)
+
+	want := `{"body":"From now on, your balance is 10.\nRef No. #1","event":"notification","kind":"deposit_made","recipient":"james@mail.com","subject":"Cash Deposit Notification"}` + "\n"
+	if buf.String() != want {
+		t.Errorf("Expected log line %s. Got %s", want, buf.String())
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+// Outbox message statuses. Held messages are for an unverified address
+// and become pending once it is verified.
+const (
+	OutboxPending = "pending"
+	OutboxSent    = "sent"
+	OutboxDead    = "dead"
+	OutboxHeld    = "held"
+)
+
+// OutboxMessage is a notification written alongside the change that caused
+// it and delivered later by the outbox dispatcher.
+type OutboxMessage struct {
+	MessageID uint64
+	Notification
+	Status        string
+	Attempts      int
+	LastError     string
+	NextAttemptAt time.Time
+	CreatedAt     time.Time
+}
+
+const (
+	outboxBatchSize   = 20
+	outboxLease       = 5 * time.Minute
+	outboxBaseDelay   = 30 * time.Second
+	outboxMaxDelay    = time.Hour
+	outboxMaxAttempts = 10
+)
+
+// outboxBackoff is the delay before retrying a message that has failed
+// attempts times: 30s, 1m, 2m, ... capped at an hour.
+func outboxBackoff(attempts int) time.Duration {
+	delay := outboxBaseDelay
+	for i := 1; i < attempts && delay < outboxMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > outboxMaxDelay {
+		delay = outboxMaxDelay
+	}
+	return delay
+}
+
+// runOutboxDispatcher delivers due outbox messages once per interval,
+// forever.
+func (a *App) runOutboxDispatcher(interval time.Duration) {
+	for range time.Tick(interval) {
+		if err := a.DispatchOutbox(); err != nil {
+			log.Printf("outbox: %v", err)
+		}
+	}
+}
+
+// DispatchOutbox makes one delivery attempt for every due outbox message.
+// Failed messages are retried with exponential backoff and marked dead
+// after outboxMaxAttempts attempts.
+func (a *App) DispatchOutbox() error {
+	for {
+		now := time.Now().UTC().Truncate(time.Second)
+		msgs, err := a.Store.ClaimOutboxMessages(now, outboxBatchSize, outboxLease)
+		if err != nil {
+			return err
+		}
+
+		for _, msg := range msgs {
+			msg.Attempts++
+			err := a.Notifier.Notify(msg.Notification)
+			switch {
+			case err == nil:
+				msg.Status = OutboxSent
+				msg.LastError = ""
+			case msg.Attempts >= outboxMaxAttempts:
+				msg.Status = OutboxDead
+				msg.LastError = err.Error()
+				log.Printf("outbox: message %d to %s is dead after %d attempts: %v", msg.MessageID, msg.Recipient, msg.Attempts, err)
+			default:
+				msg.LastError = err.Error()
+				msg.NextAttemptAt = now.Add(outboxBackoff(msg.Attempts))
+			}
+
+			if err := a.Store.UpdateOutboxMessage(msg); err != nil {
+				return err
+			}
+		}
+
+		if len(msgs) < outboxBatchSize {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// encodeCursor packs the sort key of the last row on a page into an opaque
+// token. Clients must hand it back unchanged.
+func encodeCursor(values ...string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strings.Join(values, "\x00")))
+}
+
+// decodeCursor unpacks a token made by encodeCursor with n values.
+func decodeCursor(cursor string, n int) ([]string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+	values := strings.Split(string(raw), "\x00")
+	if len(values) != n {
+		return nil, errInvalidCursor
+	}
+	return values, nil
+}
+
+// pageSize reads the "limit" query parameter.
+func pageSize(r *http.Request, v *validator) int {
+	s := r.URL.Query().Get("limit")
+	if s == "" {
+		return defaultPageSize
+	}
+	limit, err := strconv.Atoi(s)
+	if err != nil || limit < 1 || limit > maxPageSize {
+		v.add("limit", FieldInvalid, "must be an integer from 1 to "+strconv.Itoa(maxPageSize))
+	}
+	return limit
+}
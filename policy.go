@@ -0,0 +1,110 @@
+package main
+
+import (
+	"time"
+)
+
+// DepositPolicy limits what a single deposit may be and how much may be
+// deposited per calendar day and month. Zero values mean no limit. Days and
+// months start at midnight in Location, which defaults to UTC.
+//
+// Account limits count deposits into the destination account; depositor
+// limits count deposits by the same external email address, across all
+// accounts. Reversed deposits do not count.
+type DepositPolicy struct {
+	MinAmount Money
+	MaxAmount Money
+
+	DailyAccountLimit   Money
+	MonthlyAccountLimit Money
+
+	DailyDepositorLimit   Money
+	MonthlyDepositorLimit Money
+
+	Location *time.Location
+}
+
+// Deposit policy rule names, reported in PolicyViolation.Rule.
+const (
+	RuleMinAmount             = "min_amount"
+	RuleMaxAmount             = "max_amount"
+	RuleDailyAccountLimit     = "daily_account_limit"
+	RuleMonthlyAccountLimit   = "monthly_account_limit"
+	RuleDailyDepositorLimit   = "daily_depositor_limit"
+	RuleMonthlyDepositorLimit = "monthly_depositor_limit"
+)
+
+// PolicyViolation is returned when a deposit breaks a DepositPolicy rule.
+// Used is what was already deposited in the rule's period, and is zero for
+// the per-deposit rules.
+type PolicyViolation struct {
+	Rule    string
+	Message string
+	Limit   Money
+	Used    Money
+}
+
+func (v *PolicyViolation) Error() string {
+	return v.Message
+}
+
+// DepositUsage is what has already been deposited in the current periods.
+type DepositUsage struct {
+	AccountDay     Money
+	AccountMonth   Money
+	DepositorDay   Money
+	DepositorMonth Money
+}
+
+// Periods returns the start of the day and of the month containing now.
+func (p *DepositPolicy) Periods(now time.Time) (day, month time.Time) {
+	loc := p.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	local := now.In(loc)
+	day = time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc).UTC()
+	month = time.Date(local.Year(), local.Month(), 1, 0, 0, 0, 0, loc).UTC()
+	return day, month
+}
+
+// needsUsage reports whether Check looks at DepositUsage at all, so stores
+// can skip summing the log when no cumulative limit is set.
+func (p *DepositPolicy) needsUsage() bool {
+	return p.DailyAccountLimit > 0 || p.MonthlyAccountLimit > 0 || p.DailyDepositorLimit > 0 || p.MonthlyDepositorLimit > 0
+}
+
+type cumulativeLimit struct {
+	rule    string
+	limit   Money
+	used    Money
+	message string
+}
+
+// Check returns a *PolicyViolation for the first rule trans breaks, or
+// nil. Depositor limits only apply to deposits with an external source.
+func (p *DepositPolicy) Check(trans Transaction, usage DepositUsage) error {
+	if p.MinAmount > 0 && trans.Amount < p.MinAmount {
+		return &PolicyViolation{Rule: RuleMinAmount, Message: "Amount is below the minimum deposit of " + p.MinAmount.String(), Limit: p.MinAmount}
+	}
+	if p.MaxAmount > 0 && trans.Amount > p.MaxAmount {
+		return &PolicyViolation{Rule: RuleMaxAmount, Message: "Amount is above the maximum deposit of " + p.MaxAmount.String(), Limit: p.MaxAmount}
+	}
+
+	limits := []cumulativeLimit{
+		{RuleDailyAccountLimit, p.DailyAccountLimit, usage.AccountDay, "Deposit exceeds the daily limit of the destination account"},
+		{RuleMonthlyAccountLimit, p.MonthlyAccountLimit, usage.AccountMonth, "Deposit exceeds the monthly limit of the destination account"},
+	}
+	if trans.InternalSource == 0 {
+		limits = append(limits,
+			cumulativeLimit{RuleDailyDepositorLimit, p.DailyDepositorLimit, usage.DepositorDay, "Deposit exceeds the daily limit of the depositor"},
+			cumulativeLimit{RuleMonthlyDepositorLimit, p.MonthlyDepositorLimit, usage.DepositorMonth, "Deposit exceeds the monthly limit of the depositor"})
+	}
+
+	for _, l := range limits {
+		if l.limit > 0 && l.used+trans.Amount > l.limit {
+			return &PolicyViolation{Rule: l.rule, Message: l.message, Limit: l.limit, Used: l.used}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package main_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/mikeadityas/simple-cash-deposit-be"
+)
+
+func TestDepositPolicyPeriods(t *testing.T) {
+	// 2018-09-30 23:30 UTC is already October 1st in Jakarta (UTC+7), so a
+	// September deposit made the hour before counts for neither period.
+	jakarta := time.FixedZone("WIB", 7*60*60)
+	p := DepositPolicy{DailyAccountLimit: 100, MonthlyAccountLimit: 100, Location: jakarta}
+
+	trans := Transaction{DepositDest: 1, Amount: 60, TransactionTime: time.Date(2018, 9, 30, 23, 30, 0, 0, time.UTC)}
+	if err := p.Check(trans, DepositUsage{}); err != nil {
+		t.Errorf("Expected no violation. Got %v", err)
+	}
+
+	err := p.Check(trans, DepositUsage{AccountDay: 50, AccountMonth: 50})
+	v, ok := err.(*PolicyViolation)
+	if !ok || v.Rule != RuleDailyAccountLimit || v.Limit != 100 || v.Used != 50 {
+		t.Errorf("Expected the daily account limit to be broken. Got %#v", err)
+	}
+
+	day, month := p.Periods(trans.TransactionTime)
+	if want := time.Date(2018, 9, 30, 17, 0, 0, 0, time.UTC); !day.Equal(want) || !month.Equal(want) {
+		t.Errorf("Expected both periods to start at %v. Got %v and %v", want, day, month)
+	}
+}
+
+func TestDepositPolicyDepositorLimitsSkipCustomers(t *testing.T) {
+	p := DepositPolicy{DailyDepositorLimit: 100}
+
+	trans := Transaction{DepositDest: 1, InternalSource: 2, Amount: 60}
+	if err := p.Check(trans, DepositUsage{DepositorDay: 100}); err != nil {
+		t.Errorf("Expected depositor limits to ignore account holders. Got %v", err)
+	}
+
+	trans = Transaction{DepositDest: 1, ExternalSource: "michaeladityas@live.com", Amount: 60}
+	if err := p.Check(trans, DepositUsage{DepositorDay: 50}); err == nil {
+		t.Errorf("Expected the daily depositor limit to be broken")
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+)
+
+// getNotificationPreferences shows which deposit notifications are sent
+// for an account. The preferences for deposits received apply to incoming
+// transfers too.
+func (a *App) getNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+	accountid, ok := pathID(w, r, "accountid", 32)
+	if !ok {
+		return
+	}
+
+	acc := Account{AccountID: uint32(accountid)}
+	if err := a.Store.GetAccount(&acc); err != nil {
+		if errors.Is(err, ErrAccountNotFound) {
+			respondWithError(w, http.StatusNotFound, "Account not found")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, acc.Notifications)
+}
+
+// updateNotificationPreferences changes which deposit notifications are
+// sent for an account. Fields left out of the request keep their value.
+func (a *App) updateNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+	accountid, ok := pathID(w, r, "accountid", 32)
+	if !ok {
+		return
+	}
+
+	var payload struct {
+		DepositReceived      *bool  `json:"depositreceived"`
+		DepositMade          *bool  `json:"depositmade"`
+		LargeAmountThreshold *Money `json:"largeamountthreshold"`
+	}
+	if !decodeRequest(w, r, &payload) {
+		return
+	}
+
+	var v validator
+	if payload.LargeAmountThreshold != nil {
+		v.check(*payload.LargeAmountThreshold >= 0, "largeamountthreshold", FieldInvalid, "must not be negative")
+	}
+	if !v.valid(w) {
+		return
+	}
+
+	acc := Account{AccountID: uint32(accountid)}
+	err := a.Store.GetAccount(&acc)
+	if err == nil {
+		p := &acc.Notifications
+		if payload.DepositReceived != nil {
+			p.DepositReceived = *payload.DepositReceived
+		}
+		if payload.DepositMade != nil {
+			p.DepositMade = *payload.DepositMade
+		}
+		if payload.LargeAmountThreshold != nil {
+			p.LargeAmountThreshold = *payload.LargeAmountThreshold
+		}
+		err = a.Store.UpdateNotificationPreferences(&acc, newAuditEntry(r, AuditAccountNotifications))
+	}
+	if err != nil {
+		if errors.Is(err, ErrAccountNotFound) {
+			respondWithError(w, http.StatusNotFound, "Account not found")
+			return
+		}
+		if respondWithAccountError(w, err) {
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, acc.Notifications)
+}
@@ -0,0 +1,175 @@
+package main_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	. "github.com/mikeadityas/simple-cash-deposit-be"
+)
+
+// deposit posts a deposit and returns the kinds of the notifications it
+// queued.
+func deposit(t *testing.T, payload string) []string {
+	before, _ := a.Store.GetOutboxMessages(OutboxPending)
+
+	req, _ := http.NewRequest("POST", "/transaction", bytes.NewBufferString(payload))
+	checkResponseCode(t, http.StatusCreated, executeRequest(req).Code)
+
+	msgs, _ := a.Store.GetOutboxMessages(OutboxPending)
+	kinds := []string{}
+	for _, m := range msgs[len(before):] {
+		kinds = append(kinds, m.Kind)
+	}
+	return kinds
+}
+
+func setNotifications(t *testing.T, accountID, payload string) NotificationPreferences {
+	req, _ := http.NewRequest("PATCH", "/account/"+accountID+"/notifications", bytes.NewBufferString(payload))
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+
+	var p NotificationPreferences
+	json.Unmarshal(response.Body.Bytes(), &p)
+	return p
+}
+
+func TestDepositNotifiesDestinationHolder(t *testing.T) {
+	clearTable()
+	addAccount(1)
+
+	deposit(t, `{"depositdest":1,"externalsource":"michaeladityas@live.com","amount":"100.25"}`)
+	deposit(t, `{"depositdest":1,"externalsource":"michaeladityas@live.com","amount":"50"}`)
+
+	acc := Account{AccountID: 1}
+	a.Store.GetAccount(&acc)
+	msgs, _ := a.Store.GetOutboxMessages(OutboxPending)
+	last := msgs[len(msgs)-1]
+	if last.Kind != "deposit_received" || last.Recipient != acc.Email || last.Body != "Your account number 1 has received a deposit of 50. Your new balance is 150.25. Ref No. #2" {
+		t.Errorf("Expected the holder to be told the new balance. Got %+v", last.Notification)
+	}
+}
+
+func TestNotificationPreferences(t *testing.T) {
+	clearTable()
+	addAccount(2)
+
+	req, _ := http.NewRequest("GET", "/account/1/notifications", nil)
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	var p NotificationPreferences
+	json.Unmarshal(response.Body.Bytes(), &p)
+	if p != DefaultNotificationPreferences {
+		t.Errorf("Expected new accounts to have every notification. Got %+v", p)
+	}
+
+	// Account 1 only hears about deposits of 1000 or more.
+	p = setNotifications(t, "1", `{"largeamountthreshold":"1000"}`)
+	if p != (NotificationPreferences{DepositReceived: true, DepositMade: true, LargeAmountThreshold: 1000 * MinorUnits}) {
+		t.Errorf("Expected only the threshold to change. Got %+v", p)
+	}
+	kinds := deposit(t, `{"depositdest":1,"externalsource":"michaeladityas@live.com","amount":"999.99"}`)
+	if len(kinds) != 1 || kinds[0] != "deposit_made" {
+		t.Errorf("Expected only the depositor to be notified of a small deposit. Got %v", kinds)
+	}
+	kinds = deposit(t, `{"depositdest":1,"externalsource":"michaeladityas@live.com","amount":"1000"}`)
+	if len(kinds) != 2 {
+		t.Errorf("Expected both notifications for a large deposit. Got %v", kinds)
+	}
+
+	// Account 2 wants nothing about deposits it makes, account 1 nothing
+	// about deposits it receives.
+	setNotifications(t, "2", `{"depositmade":false}`)
+	setNotifications(t, "1", `{"depositreceived":false}`)
+	if kinds := deposit(t, `{"depositdest":1,"internalsource":2,"amount":"5000"}`); len(kinds) != 0 {
+		t.Errorf("Expected no notifications. Got %v", kinds)
+	}
+
+	// Depositors who are not customers are always told.
+	kinds = deposit(t, `{"depositdest":1,"externalsource":"michaeladityas@live.com","amount":"5000"}`)
+	if len(kinds) != 1 || kinds[0] != "deposit_made" {
+		t.Errorf("Expected the external depositor to be notified. Got %v", kinds)
+	}
+
+	if page := getAuditPage(t, "?action="+AuditAccountNotifications); len(page.Entries) != 3 {
+		t.Errorf("Expected 3 %s audit entries. Got %+v", AuditAccountNotifications, page.Entries)
+	}
+}
+
+func TestUpdateNotificationPreferencesRejected(t *testing.T) {
+	clearTable()
+	addAccount(2)
+
+	req, _ := http.NewRequest("PATCH", "/account/1/notifications", bytes.NewBufferString(`{"largeamountthreshold":-1,"sms":true}`))
+	checkProblem(t, executeRequest(req), map[string]string{"sms": FieldUnknown})
+
+	req, _ = http.NewRequest("PATCH", "/account/1/notifications", bytes.NewBufferString(`{"largeamountthreshold":-1}`))
+	checkProblem(t, executeRequest(req), map[string]string{"largeamountthreshold": FieldInvalid})
+
+	req, _ = http.NewRequest("PATCH", "/account/3/notifications", bytes.NewBufferString(`{"depositmade":false}`))
+	checkResponseCode(t, http.StatusNotFound, executeRequest(req).Code)
+
+	// Customers choose the notifications of their own account only.
+	req, _ = http.NewRequest("PATCH", "/account/1/notifications", bytes.NewBufferString(`{"depositmade":false}`))
+	req.Header.Set("Authorization", "Bearer "+mintToken(RoleCustomer, "michael", 1))
+	checkResponseCode(t, http.StatusOK, executeRequest(req).Code)
+
+	req, _ = http.NewRequest("PATCH", "/account/2/notifications", bytes.NewBufferString(`{"depositmade":false}`))
+	req.Header.Set("Authorization", "Bearer "+mintToken(RoleCustomer, "michael", 1))
+	checkResponseCode(t, http.StatusForbidden, executeRequest(req).Code)
+
+	req, _ = http.NewRequest("PATCH", "/account/2/notifications", bytes.NewBufferString(`{"depositmade":false}`))
+	req.Header.Set("Authorization", "Bearer "+mintToken(RoleTeller, "teller-07", 0))
+	checkResponseCode(t, http.StatusForbidden, executeRequest(req).Code)
+
+	req, _ = http.NewRequest("POST", "/account/2/close", nil)
+	checkResponseCode(t, http.StatusOK, executeRequest(req).Code)
+	req, _ = http.NewRequest("PATCH", "/account/2/notifications", bytes.NewBufferString(`{"depositmade":false}`))
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusUnprocessableEntity, response.Code)
+	checkErrorCode(t, response.Body.Bytes(), "account_closed")
+}
+
+func TestTransferNotificationPreferences(t *testing.T) {
+	clearTable()
+	addAccount(2)
+	deposit(t, `{"depositdest":1,"externalsource":"michaeladityas@live.com","amount":"5000"}`)
+
+	transfer := func(amount string) []string {
+		before, _ := a.Store.GetOutboxMessages(OutboxPending)
+		req, _ := http.NewRequest("POST", "/transfer", bytes.NewBufferString(`{"internalsource":1,"depositdest":2,"amount":"`+amount+`"}`))
+		checkResponseCode(t, http.StatusCreated, executeRequest(req).Code)
+
+		msgs, _ := a.Store.GetOutboxMessages(OutboxPending)
+		bodies := []string{}
+		for _, m := range msgs[len(before):] {
+			bodies = append(bodies, m.Kind+": "+m.Body)
+		}
+		return bodies
+	}
+
+	// The recipient is told their new balance.
+	got := transfer("100.50")
+	if len(got) != 2 || got[1] != "transfer_received: You have received 100.50 from account number 1 to account number 2. Your new balance is 100.50. Ref No. #2" {
+		t.Errorf("Expected the recipient to be told the new balance. Got %v", got)
+	}
+
+	// Small incoming transfers are left out like small deposits.
+	setNotifications(t, "2", `{"largeamountthreshold":"1000"}`)
+	if got := transfer("999.99"); len(got) != 1 || !strings.HasPrefix(got[0], "transfer_sent:") {
+		t.Errorf("Expected only the sender to be notified of a small transfer. Got %v", got)
+	}
+	if got := transfer("1000"); len(got) != 2 {
+		t.Errorf("Expected both notifications for a large transfer. Got %v", got)
+	}
+
+	// The sender is told even when neither account wants deposit
+	// notifications.
+	setNotifications(t, "1", `{"depositmade":false,"depositreceived":false}`)
+	setNotifications(t, "2", `{"depositreceived":false}`)
+	if got := transfer("2000"); len(got) != 1 || !strings.HasPrefix(got[0], "transfer_sent:") {
+		t.Errorf("Expected only the sender to be notified. Got %v", got)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"time"
+)
+
+// apiKey returns the stored key with the given ID, or nil. The caller must
+// hold s.mu.
+func (s *MemoryStore) apiKey(id uint64) *APIKey {
+	if id == 0 || id > uint64(len(s.apiKeys)) {
+		return nil
+	}
+	return &s.apiKeys[id-1]
+}
+
+// copyAPIKey returns a copy of key that shares no slices or pointers with
+// it.
+func copyAPIKey(key APIKey) *APIKey {
+	key.Scopes = append([]string(nil), key.Scopes...)
+	key.AllowedIPs = append([]string(nil), key.AllowedIPs...)
+	if key.RotatedAt != nil {
+		t := *key.RotatedAt
+		key.RotatedAt = &t
+	}
+	if key.RevokedAt != nil {
+		t := *key.RevokedAt
+		key.RevokedAt = &t
+	}
+	return &key
+}
+
+func (s *MemoryStore) CreateAPIKey(key *APIKey, audit *AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key.KeyID = uint64(len(s.apiKeys) + 1)
+	key.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	s.apiKeys = append(s.apiKeys, *copyAPIKey(*key))
+	return s.appendAudit(audit, apiKeyTarget(key.KeyID), nil, key)
+}
+
+func (s *MemoryStore) GetAPIKey(key *APIKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := s.apiKey(key.KeyID)
+	if stored == nil {
+		return ErrAPIKeyNotFound
+	}
+	*key = *copyAPIKey(*stored)
+	return nil
+}
+
+func (s *MemoryStore) FindAPIKey(prefix string) (*APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, key := range s.apiKeys {
+		if key.Prefix == prefix {
+			return copyAPIKey(key), nil
+		}
+	}
+	return nil, ErrAPIKeyNotFound
+}
+
+func (s *MemoryStore) GetAPIKeys() ([]APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := []APIKey{}
+	for _, key := range s.apiKeys {
+		keys = append(keys, *copyAPIKey(key))
+	}
+	return keys, nil
+}
+
+func (s *MemoryStore) RevokeAPIKey(key *APIKey, audit *AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := s.apiKey(key.KeyID)
+	if stored == nil {
+		return ErrAPIKeyNotFound
+	}
+	before := copyAPIKey(*stored)
+	if stored.RevokedAt == nil {
+		now := time.Now().UTC().Truncate(time.Second)
+		stored.RevokedAt = &now
+	}
+	*key = *copyAPIKey(*stored)
+	return s.appendAudit(audit, apiKeyTarget(key.KeyID), before, key)
+}
+
+func (s *MemoryStore) RotateAPIKey(key *APIKey, audit *AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := s.apiKey(key.KeyID)
+	if stored == nil {
+		return ErrAPIKeyNotFound
+	}
+	if stored.RevokedAt != nil {
+		*key = *copyAPIKey(*stored)
+		return ErrAPIKeyRevoked
+	}
+	before := copyAPIKey(*stored)
+	now := time.Now().UTC().Truncate(time.Second)
+	stored.Prefix = key.Prefix
+	stored.Hash = key.Hash
+	stored.RotatedAt = &now
+	*key = *copyAPIKey(*stored)
+	return s.appendAudit(audit, apiKeyTarget(key.KeyID), before, key)
+}
@@ -0,0 +1,37 @@
+package main
+
+// appendAudit fills in e for a change to target and appends it to the
+// log. A nil e is ignored. The caller must hold s.mu.
+func (s *MemoryStore) appendAudit(e *AuditEntry, target string, before, after interface{}) error {
+	if e == nil {
+		return nil
+	}
+	if err := e.record(target, before, after); err != nil {
+		return err
+	}
+	e.AuditID = uint64(len(s.audit) + 1)
+	s.audit = append(s.audit, *e)
+	return nil
+}
+
+func (s *MemoryStore) GetAuditEntries(f AuditFilter) ([]AuditEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries := []AuditEntry{}
+	for i := len(s.audit) - 1; i >= 0 && len(entries) < f.Limit; i-- {
+		e := s.audit[i]
+		switch {
+		case f.BeforeID != 0 && e.AuditID >= f.BeforeID,
+			f.Actor != "" && e.Actor != f.Actor,
+			f.Action != "" && e.Action != f.Action,
+			f.Target != "" && e.Target != f.Target,
+			f.RequestID != "" && e.RequestID != f.RequestID,
+			!f.From.IsZero() && e.Time.Before(f.From),
+			!f.To.IsZero() && !e.Time.Before(f.To):
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
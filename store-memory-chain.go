@@ -0,0 +1,58 @@
+package main
+
+// link adds the stored transaction t, just appended to s.transactions, to
+// the hash chain. The caller must hold s.mu.
+func (s *MemoryStore) link(t Transaction) {
+	hash := chainHash(s.chainHead.Hash, t)
+	s.hashes = append(s.hashes, hash)
+	s.chainHead = ChainHead{TransactionID: t.TransactionID, Hash: hash}
+}
+
+func (s *MemoryStore) GetChainLinks(afterID uint64, limit int) ([]ChainLink, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	links := []ChainLink{}
+	for i := int(afterID); i < len(s.transactions) && len(links) < limit; i++ {
+		l := ChainLink{Transaction: s.transactions[i], Hash: s.hashes[i]}
+		if i > 0 {
+			l.PrevHash = s.hashes[i-1]
+		}
+		links = append(links, l)
+	}
+	if len(links) == 0 {
+		return links, nil
+	}
+
+	first, last := links[0].TransactionID, links[len(links)-1].TransactionID
+	for _, p := range s.postings {
+		if p.TransactionID >= first && p.TransactionID <= last {
+			l := &links[p.TransactionID-first]
+			l.Postings = append(l.Postings, p)
+		}
+	}
+	return links, nil
+}
+
+func (s *MemoryStore) GetChainHead() (ChainHead, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.chainHead, nil
+}
+
+func (s *MemoryStore) CreateCheckpoint(c *Checkpoint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c.CheckpointID = uint64(len(s.checkpoints) + 1)
+	s.checkpoints = append(s.checkpoints, *c)
+	return nil
+}
+
+func (s *MemoryStore) GetCheckpoints() ([]Checkpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Checkpoint{}, s.checkpoints...), nil
+}
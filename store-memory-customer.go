@@ -0,0 +1,126 @@
+package main
+
+import (
+	"time"
+)
+
+// customer returns the stored customer with the given ID, or nil. The
+// caller must hold s.mu.
+func (s *MemoryStore) customer(id uint32) *Customer {
+	if id == 0 || int(id) > len(s.customers) {
+		return nil
+	}
+	return &s.customers[id-1]
+}
+
+func (s *MemoryStore) GetCustomer(c *Customer) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := s.customer(c.CustomerID)
+	if stored == nil {
+		return ErrCustomerNotFound
+	}
+	*c = *stored
+	return nil
+}
+
+func (s *MemoryStore) CreateCustomer(c *Customer, notify CustomerNotifyFunc, audit *AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.customers {
+		if existing.IDCard == c.IDCard {
+			return ErrDuplicateCustomer
+		}
+	}
+
+	c.CustomerID = uint32(len(s.customers) + 1)
+	c.Registered = time.Now().UTC().Truncate(time.Second)
+	c.IDCardInfo = describeNIK(c.IDCard)
+	s.customers = append(s.customers, *c)
+	s.enqueueOutbox(notify.render(*c))
+	return s.appendAudit(audit, customerTarget(c.CustomerID), nil, c)
+}
+
+func (s *MemoryStore) GetCustomerAccounts(customerID uint32) ([]Account, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.customer(customerID) == nil {
+		return nil, ErrCustomerNotFound
+	}
+
+	accounts := []Account{}
+	for _, acc := range s.accounts {
+		if acc.CustomerID == customerID || holds(acc, customerID) {
+			accounts = append(accounts, acc)
+		}
+	}
+	return accounts, nil
+}
+
+// holds reports whether the customer is a joint holder of the account.
+func holds(acc Account, customerID uint32) bool {
+	for _, id := range acc.JointHolders {
+		if id == customerID {
+			return true
+		}
+	}
+	return false
+}
+
+// syncOwner copies the identity of a customer onto the accounts they own.
+// The caller must hold s.mu.
+func (s *MemoryStore) syncOwner(owner *Customer) {
+	for i := range s.accounts {
+		if acc := &s.accounts[i]; acc.CustomerID == owner.CustomerID {
+			acc.Name, acc.Email, acc.EmailVerified = owner.Name, owner.Email, owner.EmailVerified
+		}
+	}
+}
+
+func (s *MemoryStore) VerifyCustomerEmail(customerID uint32, email string, audit *AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := s.customer(customerID)
+	if c == nil {
+		return ErrCustomerNotFound
+	}
+	if c.Email != email {
+		return ErrEmailChanged
+	}
+	if c.EmailVerified {
+		return nil
+	}
+
+	before := *c
+	c.EmailVerified = true
+	s.syncOwner(c)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	for i := range s.outbox {
+		if m := &s.outbox[i]; m.Status == OutboxHeld && m.Recipient == email {
+			m.Status = OutboxPending
+			m.NextAttemptAt = now
+		}
+	}
+	return s.appendAudit(audit, customerTarget(customerID), before, c)
+}
+
+func (s *MemoryStore) ResendVerificationEmail(customerID uint32, notify CustomerNotifyFunc, audit *AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := s.customer(customerID)
+	if c == nil {
+		return ErrCustomerNotFound
+	}
+	if c.EmailVerified {
+		return ErrEmailVerified
+	}
+
+	s.enqueueOutbox(notify.render(*c))
+	return s.appendAudit(audit, customerTarget(customerID), c, c)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"time"
+)
+
+func (s *MemoryStore) ReserveIdempotencyKey(rec IdempotencyRecord, notBefore time.Time) (*IdempotencyRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.idempotency == nil {
+		s.idempotency = map[string]IdempotencyRecord{}
+	}
+
+	if existing, ok := s.idempotency[rec.Key]; ok && !existing.CreatedAt.Before(notBefore) {
+		return &existing, nil
+	}
+
+	rec.StatusCode = 0
+	rec.Response = nil
+	s.idempotency[rec.Key] = rec
+	return nil, nil
+}
+
+func (s *MemoryStore) CompleteIdempotencyKey(key string, statusCode int, body []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if rec, ok := s.idempotency[key]; ok {
+		rec.StatusCode = statusCode
+		rec.Response = append([]byte(nil), body...)
+		s.idempotency[key] = rec
+	}
+	return nil
+}
+
+func (s *MemoryStore) ReleaseIdempotencyKey(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.idempotency, key)
+	return nil
+}
+
+func (s *MemoryStore) PurgeIdempotencyKeys(before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, rec := range s.idempotency {
+		if rec.CreatedAt.Before(before) {
+			delete(s.idempotency, key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package main
+
+// post records the postings of a journal entry and applies them to the
+// balances of the customer accounts involved. The caller must hold s.mu.
+func (s *MemoryStore) post(transactionID uint64, postings []Posting) error {
+	if err := checkBalanced(postings); err != nil {
+		return err
+	}
+
+	for _, p := range postings {
+		if p.AccountID != 0 {
+			if s.account(p.AccountID) == nil {
+				return ErrUnknownAccount
+			}
+		}
+	}
+
+	for _, p := range postings {
+		p.PostingID = uint64(len(s.postings) + 1)
+		p.TransactionID = transactionID
+		s.postings = append(s.postings, p)
+		if p.AccountID != 0 {
+			s.account(p.AccountID).Balance += p.Amount
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) GetPostings(transactionID uint64) ([]Posting, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if transactionID == 0 || transactionID > uint64(len(s.transactions)) {
+		return nil, ErrTransactionNotFound
+	}
+
+	postings := []Posting{}
+	for _, p := range s.postings {
+		if p.TransactionID == transactionID {
+			postings = append(postings, p)
+		}
+	}
+	return postings, nil
+}
+
+func (s *MemoryStore) FindUnbalancedEntries() ([]uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sums := map[uint64]Money{}
+	counts := map[uint64]int{}
+	for _, p := range s.postings {
+		sums[p.TransactionID] += p.Amount
+		counts[p.TransactionID]++
+	}
+
+	ids := []uint64{}
+	for _, t := range s.transactions {
+		if counts[t.TransactionID] < 2 || sums[t.TransactionID] != 0 {
+			ids = append(ids, t.TransactionID)
+		}
+	}
+	return ids, nil
+}
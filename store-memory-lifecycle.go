@@ -0,0 +1,86 @@
+package main
+
+import (
+	"time"
+)
+
+func (s *MemoryStore) UpdateAccount(acc *Account, notify CustomerNotifyFunc, audit *AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := s.account(acc.AccountID)
+	if stored == nil {
+		return ErrAccountNotFound
+	}
+	if stored.Status == AccountClosed {
+		return ErrAccountClosed
+	}
+
+	before := *stored
+	owner := s.customer(stored.CustomerID)
+	// A new address has to be verified again.
+	changed := acc.Email != owner.Email
+	owner.EmailVerified = owner.EmailVerified && !changed
+	owner.Name, owner.Email = acc.Name, acc.Email
+	s.syncOwner(owner)
+	if changed {
+		s.enqueueOutbox(notify.render(*owner))
+	}
+	*acc = *stored
+	return s.appendAudit(audit, accountTarget(acc.AccountID), before, acc)
+}
+
+func (s *MemoryStore) UpdateNotificationPreferences(acc *Account, audit *AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := s.account(acc.AccountID)
+	if stored == nil {
+		return ErrAccountNotFound
+	}
+	if stored.Status == AccountClosed {
+		return ErrAccountClosed
+	}
+
+	before := *stored
+	stored.Notifications = acc.Notifications
+	*acc = *stored
+	return s.appendAudit(audit, accountTarget(acc.AccountID), before, acc)
+}
+
+func (s *MemoryStore) ChangeAccountStatus(change *AccountStatusChange, acc *Account, audit *AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := s.account(change.AccountID)
+	if stored == nil {
+		return ErrAccountNotFound
+	}
+	if err := stored.checkStatusChange(change.Status); err != nil {
+		return err
+	}
+
+	before := *stored
+	change.ChangedAt = time.Now().UTC().Truncate(time.Second)
+	stored.Status = change.Status
+	s.statusHistory = append(s.statusHistory, *change)
+	*acc = *stored
+	return s.appendAudit(audit, accountTarget(acc.AccountID), before, acc)
+}
+
+func (s *MemoryStore) GetAccountStatusHistory(accountID uint32) ([]AccountStatusChange, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.account(accountID) == nil {
+		return nil, ErrAccountNotFound
+	}
+
+	history := []AccountStatusChange{}
+	for _, c := range s.statusHistory {
+		if c.AccountID == accountID {
+			history = append(history, c)
+		}
+	}
+	return history, nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+// enqueueOutbox queues notifications, holding those for unverified
+// addresses. The caller must hold s.mu.
+func (s *MemoryStore) enqueueOutbox(notes []Notification) {
+	now := time.Now().UTC().Truncate(time.Second)
+	for _, n := range notes {
+		if n.Recipient == "" {
+			continue
+		}
+		status := OutboxPending
+		if n.Unverified {
+			status = OutboxHeld
+		}
+		s.outbox = append(s.outbox, OutboxMessage{
+			MessageID:     uint64(len(s.outbox) + 1),
+			Notification:  n,
+			Status:        status,
+			NextAttemptAt: now,
+			CreatedAt:     now,
+		})
+	}
+}
+
+func (s *MemoryStore) ClaimOutboxMessages(now time.Time, limit int, lease time.Duration) ([]OutboxMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	due := []*OutboxMessage{}
+	for i := range s.outbox {
+		if m := &s.outbox[i]; m.Status == OutboxPending && !m.NextAttemptAt.After(now) {
+			due = append(due, m)
+		}
+	}
+	sort.SliceStable(due, func(i, j int) bool {
+		return due[i].NextAttemptAt.Before(due[j].NextAttemptAt)
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	msgs := []OutboxMessage{}
+	for _, m := range due {
+		msgs = append(msgs, *m)
+		m.NextAttemptAt = now.Add(lease)
+	}
+	return msgs, nil
+}
+
+func (s *MemoryStore) UpdateOutboxMessage(msg OutboxMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if msg.MessageID == 0 || int(msg.MessageID) > len(s.outbox) {
+		return nil
+	}
+	m := &s.outbox[msg.MessageID-1]
+	m.Status = msg.Status
+	m.Attempts = msg.Attempts
+	m.LastError = msg.LastError
+	m.NextAttemptAt = msg.NextAttemptAt
+	return nil
+}
+
+func (s *MemoryStore) GetOutboxMessages(status string) ([]OutboxMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	msgs := []OutboxMessage{}
+	for _, m := range s.outbox {
+		if m.Status == status {
+			msgs = append(msgs, m)
+		}
+	}
+	return msgs, nil
+}
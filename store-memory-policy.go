@@ -0,0 +1,32 @@
+package main
+
+import (
+	"strings"
+)
+
+// depositUsage sums the deposits that count towards policy's cumulative
+// limits for trans. The caller must hold s.mu.
+func (s *MemoryStore) depositUsage(trans Transaction, policy *DepositPolicy) DepositUsage {
+	day, month := policy.Periods(trans.TransactionTime)
+
+	var usage DepositUsage
+	for _, t := range s.transactions {
+		if t.Kind != KindDeposit || t.TransactionTime.Before(month) || s.reversalOf(t.TransactionID) != nil {
+			continue
+		}
+		today := !t.TransactionTime.Before(day)
+		if t.DepositDest == trans.DepositDest {
+			usage.AccountMonth += t.Amount
+			if today {
+				usage.AccountDay += t.Amount
+			}
+		}
+		if trans.ExternalSource != "" && strings.EqualFold(t.ExternalSource, trans.ExternalSource) {
+			usage.DepositorMonth += t.Amount
+			if today {
+				usage.DepositorDay += t.Amount
+			}
+		}
+	}
+	return usage
+}
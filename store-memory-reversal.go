@@ -0,0 +1,61 @@
+package main
+
+import (
+	"time"
+)
+
+// reversalOf returns the reversal of the given transaction, or nil. The
+// caller must hold s.mu.
+func (s *MemoryStore) reversalOf(id uint64) *Transaction {
+	for i := range s.transactions {
+		if s.transactions[i].ReversalOf == id {
+			return &s.transactions[i]
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) ReverseTransaction(trans *Transaction, audit *AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := trans.ReversalOf
+	if id == 0 || id > uint64(len(s.transactions)) {
+		return ErrTransactionNotFound
+	}
+	original := s.transactions[id-1]
+	if original.Kind == KindReversal {
+		return ErrNotReversible
+	}
+	if s.reversalOf(id) != nil {
+		return ErrAlreadyReversed
+	}
+
+	legs := []Posting{}
+	for _, p := range s.postings {
+		if p.TransactionID == id {
+			legs = append(legs, p)
+		}
+	}
+
+	stored := Transaction{
+		TransactionID:   uint64(len(s.transactions) + 1),
+		Kind:            KindReversal,
+		DepositDest:     original.DepositDest,
+		Amount:          original.Amount,
+		TransactionTime: time.Now().UTC().Truncate(time.Second),
+		ReversalOf:      id,
+		ReasonCode:      trans.ReasonCode,
+		Operator:        trans.Operator,
+		CreatedBy:       trans.CreatedBy,
+	}
+	if err := s.post(stored.TransactionID, reversalPostings(legs)); err != nil {
+		return err
+	}
+	s.transactions = append(s.transactions, stored)
+	s.link(stored)
+
+	*trans = stored
+	trans.Status = StatusPosted
+	return s.appendAudit(audit, transactionTarget(trans.TransactionID), nil, trans)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"time"
+)
+
+func (s *MemoryStore) CreateTransfer(trans *Transaction, notify NotifyFunc, audit *AuditEntry) error {
+	if trans.InternalSource == trans.DepositDest {
+		return ErrSameAccount
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	src, dest := s.account(trans.InternalSource), s.account(trans.DepositDest)
+	if src == nil || dest == nil {
+		return ErrUnknownAccount
+	}
+	if err := src.checkOpen(); err != nil {
+		return err
+	}
+	if err := dest.checkOpen(); err != nil {
+		return err
+	}
+	if src.Available() < trans.Amount {
+		return ErrInsufficientFunds
+	}
+
+	stored := Transaction{
+		TransactionID:   uint64(len(s.transactions) + 1),
+		Kind:            KindTransfer,
+		DepositDest:     trans.DepositDest,
+		InternalSource:  trans.InternalSource,
+		Amount:          trans.Amount,
+		CreatedBy:       trans.CreatedBy,
+		TransactionTime: time.Now().UTC().Truncate(time.Second),
+	}
+	if err := s.post(stored.TransactionID, transferPostings(stored)); err != nil {
+		return err
+	}
+	s.transactions = append(s.transactions, stored)
+	s.link(stored)
+
+	trans.TransactionID = stored.TransactionID
+	trans.Kind = stored.Kind
+	trans.Status = StatusPosted
+	trans.ExternalSource = ""
+	trans.Name = src.Name
+	trans.InternalSourceEmail = src.Email
+	trans.InternalSourceEmailVerified = src.EmailVerified
+	trans.DepositDestEmail = dest.Email
+	trans.DepositDestEmailVerified = dest.EmailVerified
+	trans.DepositDestBalance = dest.Balance
+	trans.DepositDestNotifications = dest.Notifications
+	trans.TransactionTime = stored.TransactionTime
+
+	if notify != nil {
+		s.enqueueOutbox(notify(*trans))
+	}
+	return s.appendAudit(audit, transactionTarget(trans.TransactionID), nil, trans)
+}
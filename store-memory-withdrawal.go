@@ -0,0 +1,45 @@
+package main
+
+import (
+	"time"
+)
+
+func (s *MemoryStore) CreateWithdrawal(trans *Transaction, notify NotifyFunc, audit *AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	acc := s.account(trans.DepositDest)
+	if acc == nil {
+		return ErrUnknownAccount
+	}
+	if err := acc.checkOpen(); err != nil {
+		return err
+	}
+	if acc.Available() < trans.Amount {
+		return ErrInsufficientFunds
+	}
+
+	stored := Transaction{
+		TransactionID:   uint64(len(s.transactions) + 1),
+		Kind:            KindWithdrawal,
+		DepositDest:     trans.DepositDest,
+		Amount:          trans.Amount,
+		CreatedBy:       trans.CreatedBy,
+		TransactionTime: time.Now().UTC().Truncate(time.Second),
+	}
+	if err := s.post(stored.TransactionID, withdrawalPostings(stored)); err != nil {
+		return err
+	}
+	s.transactions = append(s.transactions, stored)
+	s.link(stored)
+
+	*trans = stored
+	trans.Status = StatusPosted
+	trans.DepositDestEmail = acc.Email
+	trans.DepositDestEmailVerified = acc.EmailVerified
+
+	if notify != nil {
+		s.enqueueOutbox(notify(*trans))
+	}
+	return s.appendAudit(audit, transactionTarget(trans.TransactionID), nil, trans)
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStore is a Store that keeps everything in process memory. It is
+// meant for tests and local development; nothing survives a restart.
+type MemoryStore struct {
+	mu           sync.Mutex
+	accounts     []Account
+	customers    []Customer
+	transactions []Transaction
+	postings     []Posting
+	idempotency  map[string]IdempotencyRecord
+	outbox       []OutboxMessage
+	apiKeys      []APIKey
+	audit        []AuditEntry
+
+	statusHistory []AccountStatusChange
+
+	// hashes holds the chain hash of each transaction, by index.
+	hashes      []string
+	chainHead   ChainHead
+	checkpoints []Checkpoint
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+// account returns the stored account with the given ID, or nil. The caller
+// must hold s.mu.
+func (s *MemoryStore) account(id uint32) *Account {
+	if id == 0 || int(id) > len(s.accounts) {
+		return nil
+	}
+	return &s.accounts[id-1]
+}
+
+// ledgerBalance recomputes an account balance from its postings. The
+// caller must hold s.mu.
+func (s *MemoryStore) ledgerBalance(id uint32) Money {
+	var total Money
+	for _, p := range s.postings {
+		if p.AccountID == id {
+			total += p.Amount
+		}
+	}
+	return total
+}
+
+func (s *MemoryStore) GetAccount(acc *Account) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := s.account(acc.AccountID)
+	if stored == nil {
+		return ErrAccountNotFound
+	}
+	*acc = *stored
+	return nil
+}
+
+func (s *MemoryStore) GetAccounts(f AccountFilter) ([]Account, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	accounts := []Account{}
+	for _, acc := range s.accounts {
+		if matchesAccountFilter(acc, f) {
+			accounts = append(accounts, acc)
+		}
+	}
+	total := len(accounts)
+
+	less := func(x, y Account) bool {
+		switch f.Sort {
+		case AccountSortName:
+			if x.Name != y.Name {
+				return x.Name < y.Name
+			}
+		case AccountSortBalance:
+			if x.Balance != y.Balance {
+				return x.Balance < y.Balance
+			}
+		default:
+			if !x.Registered.Equal(y.Registered) {
+				return x.Registered.Before(y.Registered)
+			}
+		}
+		return x.AccountID < y.AccountID
+	}
+	if f.Desc {
+		asc := less
+		less = func(x, y Account) bool { return asc(y, x) }
+	}
+	sort.SliceStable(accounts, func(i, j int) bool { return less(accounts[i], accounts[j]) })
+
+	page := []Account{}
+	for _, acc := range accounts {
+		if f.After != nil && !less(*f.After, acc) {
+			continue
+		}
+		if len(page) == f.Limit {
+			break
+		}
+		page = append(page, acc)
+	}
+	return page, total, nil
+}
+
+func matchesAccountFilter(acc Account, f AccountFilter) bool {
+	if f.NamePrefix != "" && !strings.HasPrefix(nameSearchKey(acc.Name), nameSearchKey(f.NamePrefix)) {
+		return false
+	}
+	if f.Email != "" && !strings.EqualFold(acc.Email, f.Email) {
+		return false
+	}
+	if f.IDCard != "" && acc.IDCard != f.IDCard {
+		return false
+	}
+	if !f.RegisteredFrom.IsZero() && acc.Registered.Before(f.RegisteredFrom) {
+		return false
+	}
+	if !f.RegisteredTo.IsZero() && !acc.Registered.Before(f.RegisteredTo) {
+		return false
+	}
+	return true
+}
+
+func (s *MemoryStore) CreateAccount(acc *Account, notify CustomerNotifyFunc, audit *AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	var owner Customer
+	if acc.CustomerID == 0 {
+		for _, existing := range s.customers {
+			if existing.IDCard == acc.IDCard {
+				return ErrDuplicateAccount
+			}
+		}
+		owner = Customer{CustomerID: uint32(len(s.customers) + 1), IDCard: acc.IDCard, Name: acc.Name, Email: acc.Email, EmailVerified: acc.EmailVerified, Registered: now, IDCardInfo: describeNIK(acc.IDCard)}
+	} else if c := s.customer(acc.CustomerID); c != nil {
+		owner = *c
+	} else {
+		return ErrCustomerNotFound
+	}
+	for _, id := range acc.JointHolders {
+		if s.customer(id) == nil {
+			return ErrCustomerNotFound
+		}
+	}
+	if acc.CustomerID == 0 {
+		s.customers = append(s.customers, owner)
+		s.enqueueOutbox(notify.render(owner))
+	}
+
+	acc.AccountID = uint32(len(s.accounts) + 1)
+	acc.CustomerID = owner.CustomerID
+	acc.IDCard, acc.Name, acc.Email, acc.EmailVerified, acc.IDCardInfo = owner.IDCard, owner.Name, owner.Email, owner.EmailVerified, owner.IDCardInfo
+	acc.JointHolders = append([]uint32{}, acc.JointHolders...)
+	acc.Registered = now
+	acc.Balance = 0
+	acc.Status = AccountActive
+	acc.Notifications = DefaultNotificationPreferences
+	stored := *acc
+	s.accounts = append(s.accounts, stored)
+	s.statusHistory = append(s.statusHistory, AccountStatusChange{AccountID: acc.AccountID, Status: AccountActive, ChangedBy: actorOf(audit), ChangedAt: acc.Registered})
+	return s.appendAudit(audit, accountTarget(acc.AccountID), nil, acc)
+}
+
+// fill sets the depositor's name and email for internal deposits, as the
+// SQL join on source_internal does, and the transaction status. The caller
+// must hold s.mu.
+func (s *MemoryStore) fill(t *Transaction) {
+	if src := s.account(t.InternalSource); src != nil {
+		t.Name = src.Name
+		t.InternalSourceEmail = src.Email
+	}
+	t.Status = StatusPosted
+	if s.reversalOf(t.TransactionID) != nil {
+		t.Status = StatusReversed
+	}
+}
+
+// newestFirst orders transactions like "ORDER BY transaction_time DESC",
+// breaking ties by ID so the order is deterministic.
+func newestFirst(transactions []Transaction) {
+	sort.SliceStable(transactions, func(i, j int) bool {
+		ti, tj := transactions[i], transactions[j]
+		if !ti.TransactionTime.Equal(tj.TransactionTime) {
+			return ti.TransactionTime.After(tj.TransactionTime)
+		}
+		return ti.TransactionID > tj.TransactionID
+	})
+}
+
+func (s *MemoryStore) GetHistory(accountID uint32) ([]Transaction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	net := map[uint64]Money{}
+	for _, p := range s.postings {
+		if p.AccountID == accountID {
+			net[p.TransactionID] += p.Amount
+		}
+	}
+
+	transactions := []Transaction{}
+	for _, t := range s.transactions {
+		if amount, ok := net[t.TransactionID]; ok {
+			s.fill(&t)
+			t.Direction = direction(amount)
+			transactions = append(transactions, t)
+		}
+	}
+	newestFirst(transactions)
+	return transactions, nil
+}
+
+func (s *MemoryStore) GetTransactions(f TransactionFilter) ([]Transaction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	transactions := []Transaction{}
+	for _, t := range s.transactions {
+		if matchesTransactionFilter(t, f) {
+			s.fill(&t)
+			transactions = append(transactions, t)
+		}
+	}
+	newestFirst(transactions)
+	if len(transactions) > f.Limit {
+		transactions = transactions[:f.Limit]
+	}
+	return transactions, nil
+}
+
+func matchesTransactionFilter(t Transaction, f TransactionFilter) bool {
+	if f.BeforeID != 0 {
+		if t.TransactionTime.After(f.BeforeTime) {
+			return false
+		}
+		if t.TransactionTime.Equal(f.BeforeTime) && t.TransactionID >= f.BeforeID {
+			return false
+		}
+	}
+	if !f.From.IsZero() && t.TransactionTime.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !t.TransactionTime.Before(f.To) {
+		return false
+	}
+	if f.MinAmount != nil && t.Amount < *f.MinAmount {
+		return false
+	}
+	if f.MaxAmount != nil && t.Amount > *f.MaxAmount {
+		return false
+	}
+	if f.Source == SourceInternal && t.InternalSource == 0 {
+		return false
+	}
+	// Only deposits by non-customers carry an external source.
+	if f.Source == SourceExternal && (t.Kind != KindDeposit || t.InternalSource != 0) {
+		return false
+	}
+	if f.Destination != 0 && t.DepositDest != f.Destination {
+		return false
+	}
+	return true
+}
+
+func (s *MemoryStore) CreateTransaction(trans *Transaction, policy *DepositPolicy, notify NotifyFunc, audit *AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dest := s.account(trans.DepositDest)
+	if dest == nil {
+		return ErrUnknownAccount
+	}
+	if err := dest.checkOpen(); err != nil {
+		return err
+	}
+	trans.Kind = KindDeposit
+	trans.Status = StatusPosted
+	trans.DepositDestEmail = dest.Email
+	trans.DepositDestEmailVerified = dest.EmailVerified
+	trans.DepositDestNotifications = dest.Notifications
+
+	stored := Transaction{
+		Kind:        KindDeposit,
+		DepositDest: trans.DepositDest,
+		Amount:      trans.Amount,
+		CreatedBy:   trans.CreatedBy,
+	}
+	if trans.InternalSource == 0 {
+		stored.ExternalSource = trans.ExternalSource
+	} else {
+		src := s.account(trans.InternalSource)
+		if src == nil {
+			return ErrUnknownAccount
+		}
+		stored.InternalSource = trans.InternalSource
+		trans.InternalSourceEmail = src.Email
+		trans.InternalSourceEmailVerified = src.EmailVerified
+		trans.InternalSourceNotifications = src.Notifications
+	}
+
+	stored.TransactionID = uint64(len(s.transactions) + 1)
+	stored.TransactionTime = time.Now().UTC().Truncate(time.Second)
+
+	if policy != nil {
+		if err := policy.Check(stored, s.depositUsage(stored, policy)); err != nil {
+			return err
+		}
+	}
+
+	if err := s.post(stored.TransactionID, depositPostings(stored)); err != nil {
+		return err
+	}
+	s.transactions = append(s.transactions, stored)
+	s.link(stored)
+
+	trans.TransactionID = stored.TransactionID
+	trans.TransactionTime = stored.TransactionTime
+	trans.DepositDestBalance = dest.Balance
+
+	if notify != nil {
+		s.enqueueOutbox(notify(*trans))
+	}
+	return s.appendAudit(audit, transactionTarget(trans.TransactionID), nil, trans)
+}
+
+func (s *MemoryStore) CheckBalances(repair bool) ([]BalanceDrift, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	drifts := []BalanceDrift{}
+	for i := range s.accounts {
+		acc := &s.accounts[i]
+		computed := s.ledgerBalance(acc.AccountID)
+		if acc.Balance != computed {
+			drifts = append(drifts, BalanceDrift{AccountID: acc.AccountID, Stored: acc.Balance, Computed: computed})
+			if repair {
+				acc.Balance = computed
+			}
+		}
+	}
+	return drifts, nil
+}
+
+var _ Store = (*MemoryStore)(nil)
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+func init() {
+	registerDialect(dialect{
+		name:     "mysql",
+		driver:   "mysql",
+		classify: classifyMySQLError,
+	})
+}
+
+// MySQL server error numbers, see
+// https://dev.mysql.com/doc/mysql-errors/8.0/en/server-error-reference.html
+const (
+	mysqlErrDupEntry        = 1062
+	mysqlErrNoReferencedRow = 1452
+)
+
+func classifyMySQLError(err error) error {
+	var myErr *mysql.MySQLError
+	if !errors.As(err, &myErr) {
+		return err
+	}
+
+	switch myErr.Number {
+	case mysqlErrDupEntry:
+		return errUniqueViolation
+	case mysqlErrNoReferencedRow:
+		return errForeignKeyViolation
+	}
+	return err
+}
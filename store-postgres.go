@@ -0,0 +1,38 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+func init() {
+	registerDialect(dialect{
+		name:         "postgres",
+		driver:       "postgres",
+		dollarParams: true,
+		returningID:  true,
+		classify:     classifyPostgresError,
+	})
+}
+
+// SQLSTATE codes, see https://www.postgresql.org/docs/current/errcodes-appendix.html
+const (
+	pgUniqueViolation     = "23505"
+	pgForeignKeyViolation = "23503"
+)
+
+func classifyPostgresError(err error) error {
+	var pgErr *pq.Error
+	if !errors.As(err, &pgErr) {
+		return err
+	}
+
+	switch pgErr.Code {
+	case pgUniqueViolation:
+		return errUniqueViolation
+	case pgForeignKeyViolation:
+		return errForeignKeyViolation
+	}
+	return err
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+const apiKeyColumns = `key_id, name, prefix, secret_hash, scopes, allowed_ips, created_by, created_at, rotated_at, revoked_at`
+
+func scanAPIKey(row interface{ Scan(...interface{}) error }, key *APIKey) error {
+	var scopes, ips string
+	var rotated, revoked sql.NullTime
+	err := row.Scan(&key.KeyID, &key.Name, &key.Prefix, &key.Hash, &scopes, &ips, &key.CreatedBy, &key.CreatedAt, &rotated, &revoked)
+	if err != nil {
+		return err
+	}
+	key.Scopes = strings.Fields(scopes)
+	key.AllowedIPs = strings.Fields(ips)
+	key.RotatedAt, key.RevokedAt = nil, nil
+	if rotated.Valid {
+		key.RotatedAt = &rotated.Time
+	}
+	if revoked.Valid {
+		key.RevokedAt = &revoked.Time
+	}
+	return nil
+}
+
+func (s *sqlStore) CreateAPIKey(key *APIKey, audit *AuditEntry) error {
+	key.CreatedAt = time.Now().UTC().Truncate(time.Second)
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var q string = `INSERT INTO api_key
+									(name, prefix, secret_hash, scopes, allowed_ips, created_by, created_at)
+									VALUES
+									(?,?,?,?,?,?,?)`
+	id, err := s.insert(tx, q, "key_id", key.Name, key.Prefix, key.Hash,
+		strings.Join(key.Scopes, " "), strings.Join(key.AllowedIPs, " "), key.CreatedBy, key.CreatedAt)
+	if err != nil {
+		return err
+	}
+	key.KeyID = uint64(id)
+
+	if err := s.appendAudit(tx, audit, apiKeyTarget(key.KeyID), nil, key); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqlStore) GetAPIKey(key *APIKey) error {
+	return s.getAPIKey(s.db, key, "")
+}
+
+// getAPIKey fills in the key with key.KeyID, appending suffix to the
+// query, such as s.forUpdate().
+func (s *sqlStore) getAPIKey(db querier, key *APIKey, suffix string) error {
+	row := db.QueryRow(s.rebind(`SELECT `+apiKeyColumns+` FROM api_key WHERE key_id = ?`+suffix), key.KeyID)
+	err := scanAPIKey(row, key)
+	if err == sql.ErrNoRows {
+		return ErrAPIKeyNotFound
+	}
+	return err
+}
+
+func (s *sqlStore) FindAPIKey(prefix string) (*APIKey, error) {
+	var key APIKey
+	row := s.db.QueryRow(s.rebind(`SELECT `+apiKeyColumns+` FROM api_key WHERE prefix = ?`), prefix)
+	err := scanAPIKey(row, &key)
+	if err == sql.ErrNoRows {
+		return nil, ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (s *sqlStore) GetAPIKeys() ([]APIKey, error) {
+	rows, err := s.db.Query(`SELECT ` + apiKeyColumns + ` FROM api_key ORDER BY key_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		var key APIKey
+		if err := scanAPIKey(rows, &key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func (s *sqlStore) RevokeAPIKey(key *APIKey, audit *AuditEntry) error {
+	return s.updateAPIKey(key, audit, func(tx *sql.Tx, before APIKey, now time.Time) error {
+		if before.Revoked() {
+			return nil
+		}
+		_, err := tx.Exec(s.rebind(`UPDATE api_key SET revoked_at = ? WHERE key_id = ?`), now, key.KeyID)
+		return err
+	})
+}
+
+func (s *sqlStore) RotateAPIKey(key *APIKey, audit *AuditEntry) error {
+	prefix, hash := key.Prefix, key.Hash
+	return s.updateAPIKey(key, audit, func(tx *sql.Tx, before APIKey, now time.Time) error {
+		if before.Revoked() {
+			return ErrAPIKeyRevoked
+		}
+		var q string = `UPDATE api_key
+										SET prefix = ?, secret_hash = ?, rotated_at = ?
+										WHERE key_id = ?`
+		_, err := tx.Exec(s.rebind(q), prefix, hash, now, key.KeyID)
+		return err
+	})
+}
+
+// updateAPIKey locks the key with key.KeyID, applies update to it and
+// fills in key with the result, auditing the change.
+func (s *sqlStore) updateAPIKey(key *APIKey, audit *AuditEntry, update func(tx *sql.Tx, before APIKey, now time.Time) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before := APIKey{KeyID: key.KeyID}
+	if err := s.getAPIKey(tx, &before, s.forUpdate()); err != nil {
+		return err
+	}
+	if err := update(tx, before, time.Now().UTC().Truncate(time.Second)); err != nil {
+		*key = before
+		return err
+	}
+	if err := s.getAPIKey(tx, key, ""); err != nil {
+		return err
+	}
+
+	if err := s.appendAudit(tx, audit, apiKeyTarget(key.KeyID), before, key); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"database/sql"
+	"strings"
+)
+
+// appendAudit fills in e for a change to target and inserts it within tx.
+// A nil e is ignored.
+func (s *sqlStore) appendAudit(tx querier, e *AuditEntry, target string, before, after interface{}) error {
+	if e == nil {
+		return nil
+	}
+	if err := e.record(target, before, after); err != nil {
+		return err
+	}
+
+	var q string = `INSERT INTO audit_log
+									(created_at, actor, action, target, request_id, client_ip, before_state, after_state)
+									VALUES
+									(?,?,?,?,?,?,?,?)`
+	id, err := s.insert(tx, q, "audit_id", e.Time, e.Actor, e.Action, e.Target, e.RequestID, e.ClientIP, nullableJSON(e.Before), nullableJSON(e.After))
+	if err != nil {
+		return err
+	}
+	e.AuditID = uint64(id)
+	return nil
+}
+
+// nullableJSON stores a missing snapshot as NULL rather than "null".
+func nullableJSON(data []byte) interface{} {
+	if data == nil {
+		return nil
+	}
+	return string(data)
+}
+
+func (s *sqlStore) GetAuditEntries(f AuditFilter) ([]AuditEntry, error) {
+	where := []string{"1=1"}
+	args := []interface{}{}
+
+	if f.BeforeID != 0 {
+		where = append(where, "audit_id < ?")
+		args = append(args, f.BeforeID)
+	}
+	for column, value := range map[string]string{"actor": f.Actor, "action": f.Action, "target": f.Target, "request_id": f.RequestID} {
+		if value != "" {
+			where = append(where, column+" = ?")
+			args = append(args, value)
+		}
+	}
+	if !f.From.IsZero() {
+		where = append(where, "created_at >= ?")
+		args = append(args, f.From)
+	}
+	if !f.To.IsZero() {
+		where = append(where, "created_at < ?")
+		args = append(args, f.To)
+	}
+	args = append(args, f.Limit)
+
+	var q string = `SELECT audit_id, created_at, actor, action, target, request_id, client_ip, before_state, after_state
+									FROM audit_log
+									WHERE ` + strings.Join(where, " AND ") + `
+									ORDER BY audit_id DESC
+									LIMIT ?`
+	rows, err := s.db.Query(s.rebind(q), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []AuditEntry{}
+	for rows.Next() {
+		var e AuditEntry
+		var before, after sql.NullString
+		if err := rows.Scan(&e.AuditID, &e.Time, &e.Actor, &e.Action, &e.Target, &e.RequestID, &e.ClientIP, &before, &after); err != nil {
+			return nil, err
+		}
+		if before.Valid {
+			e.Before = []byte(before.String)
+		}
+		if after.Valid {
+			e.After = []byte(after.String)
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
@@ -0,0 +1,48 @@
+package main
+
+func (s *sqlStore) CheckBalances(repair bool) ([]BalanceDrift, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Lock every account so no deposit lands between reading the stored
+	// balance and recomputing it.
+	var q string = `SELECT acc.account_id, acc.balance,
+									COALESCE((SELECT SUM(p.amount) FROM posting p WHERE p.account_id = acc.account_id),0)
+									FROM account acc
+									ORDER BY acc.account_id` + s.forUpdate()
+	rows, err := tx.Query(s.rebind(q))
+	if err != nil {
+		return nil, err
+	}
+
+	drifts := []BalanceDrift{}
+	for rows.Next() {
+		var d BalanceDrift
+		if err := rows.Scan(&d.AccountID, &d.Stored, &d.Computed); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if d.Stored != d.Computed {
+			drifts = append(drifts, d)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if !repair {
+		return drifts, nil
+	}
+
+	for _, d := range drifts {
+		_, err := tx.Exec(s.rebind(`UPDATE account SET balance = ? WHERE account_id = ?`), d.Computed, d.AccountID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return drifts, tx.Commit()
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"database/sql"
+)
+
+// ledgerChainID is the primary key of the single ledger_chain row.
+const ledgerChainID = 1
+
+const chainColumns = `transaction_id, kind, COALESCE(source_external,''), COALESCE(source_internal,0), destination, amount, transaction_time,
+									COALESCE(reversal_of,0), COALESCE(reason_code,''), COALESCE(operator,''), COALESCE(created_by,''),
+									COALESCE(prev_hash,''), COALESCE(row_hash,'')`
+
+func scanChainLink(row interface{ Scan(...interface{}) error }, l *ChainLink) error {
+	return row.Scan(&l.TransactionID, &l.Kind, &l.ExternalSource, &l.InternalSource, &l.DepositDest, &l.Amount, &l.TransactionTime,
+		&l.ReversalOf, &l.ReasonCode, &l.Operator, &l.CreatedBy, &l.PrevHash, &l.Hash)
+}
+
+// initChain starts the hash chain the first time the store is opened on a
+// schema that has it, hashing any rows written before.
+func (s *sqlStore) initChain() error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var n int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM ledger_chain`).Scan(&n); err != nil {
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+
+	rows, err := tx.Query(`SELECT ` + chainColumns + ` FROM transaction_log ORDER BY transaction_id`)
+	if err != nil {
+		return err
+	}
+	links := []ChainLink{}
+	for rows.Next() {
+		var l ChainLink
+		if err := scanChainLink(rows, &l); err != nil {
+			rows.Close()
+			return err
+		}
+		links = append(links, l)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	head := ChainHead{}
+	for _, l := range links {
+		if err := s.saveLink(tx, &head, l.Transaction); err != nil {
+			return err
+		}
+	}
+
+	var q string = `INSERT INTO ledger_chain
+									(chain_id, last_transaction_id, last_hash)
+									VALUES
+									(?,?,?)`
+	if _, err := tx.Exec(s.rebind(q), ledgerChainID, head.TransactionID, head.Hash); err != nil {
+		if s.classify(err) == errUniqueViolation {
+			// Another process started the chain first.
+			return nil
+		}
+		return err
+	}
+	return tx.Commit()
+}
+
+// lockChainHead reads the chain head inside a write transaction and locks
+// it until the transaction ends. Writers take it after their account locks
+// and before inserting into transaction_log, so rows join the chain in ID
+// order.
+func (s *sqlStore) lockChainHead(tx querier) (ChainHead, error) {
+	var head ChainHead
+	err := tx.QueryRow(s.rebind(`SELECT last_transaction_id, last_hash FROM ledger_chain WHERE chain_id = ?`+s.forUpdate()), ledgerChainID).Scan(&head.TransactionID, &head.Hash)
+	return head, err
+}
+
+// linkChain adds the transaction log row with the given ID to the chain
+// after head, which must have been locked by lockChainHead, and saves the
+// new head. The row is read back so that exactly what was stored is
+// hashed.
+func (s *sqlStore) linkChain(tx querier, head *ChainHead, id uint64) error {
+	var l ChainLink
+	if err := scanChainLink(tx.QueryRow(s.rebind(`SELECT `+chainColumns+` FROM transaction_log WHERE transaction_id = ?`), id), &l); err != nil {
+		return err
+	}
+	if err := s.saveLink(tx, head, l.Transaction); err != nil {
+		return err
+	}
+
+	_, err := tx.Exec(s.rebind(`UPDATE ledger_chain SET last_transaction_id = ?, last_hash = ? WHERE chain_id = ?`), head.TransactionID, head.Hash, ledgerChainID)
+	return err
+}
+
+// saveLink hashes the stored row t onto head, saves the hashes with the
+// row and moves head to it.
+func (s *sqlStore) saveLink(tx querier, head *ChainHead, t Transaction) error {
+	hash := chainHash(head.Hash, t)
+	_, err := tx.Exec(s.rebind(`UPDATE transaction_log SET prev_hash = ?, row_hash = ? WHERE transaction_id = ?`), head.Hash, hash, t.TransactionID)
+	if err != nil {
+		return err
+	}
+	*head = ChainHead{TransactionID: t.TransactionID, Hash: hash}
+	return nil
+}
+
+func (s *sqlStore) GetChainLinks(afterID uint64, limit int) ([]ChainLink, error) {
+	var q string = `SELECT ` + chainColumns + `
+									FROM transaction_log
+									WHERE transaction_id > ?
+									ORDER BY transaction_id
+									LIMIT ?`
+	rows, err := s.db.Query(s.rebind(q), afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	links := []ChainLink{}
+	for rows.Next() {
+		var l ChainLink
+		if err := scanChainLink(rows, &l); err != nil {
+			return nil, err
+		}
+		links = append(links, l)
+	}
+	if err := rows.Err(); err != nil || len(links) == 0 {
+		return links, err
+	}
+	return links, s.loadChainPostings(links)
+}
+
+// loadChainPostings fills in the postings of a batch of chain links.
+func (s *sqlStore) loadChainPostings(links []ChainLink) error {
+	var q string = `SELECT posting_id, transaction_id, COALESCE(account_id,0), COALESCE(system_account,''), amount
+									FROM posting
+									WHERE transaction_id >= ? AND transaction_id <= ?
+									ORDER BY posting_id`
+	rows, err := s.db.Query(s.rebind(q), links[0].TransactionID, links[len(links)-1].TransactionID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	byID := make(map[uint64]*ChainLink, len(links))
+	for i := range links {
+		byID[links[i].TransactionID] = &links[i]
+	}
+	for rows.Next() {
+		var p Posting
+		if err := rows.Scan(&p.PostingID, &p.TransactionID, &p.AccountID, &p.SystemAccount, &p.Amount); err != nil {
+			return err
+		}
+		if l := byID[p.TransactionID]; l != nil {
+			l.Postings = append(l.Postings, p)
+		}
+	}
+	return rows.Err()
+}
+
+func (s *sqlStore) GetChainHead() (ChainHead, error) {
+	var head ChainHead
+	err := s.db.QueryRow(s.rebind(`SELECT last_transaction_id, last_hash FROM ledger_chain WHERE chain_id = ?`), ledgerChainID).Scan(&head.TransactionID, &head.Hash)
+	if err == sql.ErrNoRows {
+		return ChainHead{}, nil
+	}
+	return head, err
+}
+
+func (s *sqlStore) CreateCheckpoint(c *Checkpoint) error {
+	var q string = `INSERT INTO ledger_checkpoint
+									(transaction_id, hash, created_at, signature)
+									VALUES
+									(?,?,?,?)`
+	id, err := s.insert(s.db, q, "checkpoint_id", c.TransactionID, c.Hash, c.CreatedAt, c.Signature)
+	if err != nil {
+		return err
+	}
+	c.CheckpointID = uint64(id)
+	return nil
+}
+
+func (s *sqlStore) GetCheckpoints() ([]Checkpoint, error) {
+	rows, err := s.db.Query(`SELECT checkpoint_id, transaction_id, hash, created_at, signature FROM ledger_checkpoint ORDER BY checkpoint_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	checkpoints := []Checkpoint{}
+	for rows.Next() {
+		var c Checkpoint
+		if err := rows.Scan(&c.CheckpointID, &c.TransactionID, &c.Hash, &c.CreatedAt, &c.Signature); err != nil {
+			return nil, err
+		}
+		checkpoints = append(checkpoints, c)
+	}
+	return checkpoints, rows.Err()
+}
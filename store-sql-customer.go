@@ -0,0 +1,184 @@
+package main
+
+import (
+	"database/sql"
+	"time"
+)
+
+const customerColumns = `customer_id, id_card_number, name, email, email_verified, phone, date_of_birth, registration_time`
+
+func scanCustomer(row interface{ Scan(...interface{}) error }, c *Customer) error {
+	var dob sql.NullTime
+	if err := row.Scan(&c.CustomerID, &c.IDCard, &c.Name, &c.Email, &c.EmailVerified, &c.Phone, &dob, &c.Registered); err != nil {
+		return err
+	}
+	c.DateOfBirth = ""
+	if dob.Valid {
+		c.DateOfBirth = dob.Time.Format(DateLayout)
+	}
+	c.IDCardInfo = describeNIK(c.IDCard)
+	return nil
+}
+
+// insertCustomer stores c and sets c.CustomerID. It returns
+// ErrDuplicateCustomer if the ID card number is taken.
+func (s *sqlStore) insertCustomer(tx querier, c *Customer) error {
+	var dob interface{}
+	if c.DateOfBirth != "" {
+		dob = c.DateOfBirth
+	}
+
+	var q string = `INSERT INTO customer
+									(id_card_number, name, name_key, email, email_verified, phone, date_of_birth, registration_time)
+									VALUES
+									(?,?,?,?,?,?,?,?)`
+	id, err := s.insert(tx, q, "customer_id", c.IDCard, c.Name, nameSearchKey(c.Name), c.Email, c.EmailVerified, c.Phone, dob, c.Registered)
+	if err != nil {
+		if err == errUniqueViolation {
+			return ErrDuplicateCustomer
+		}
+		return err
+	}
+	c.CustomerID = uint32(id)
+	c.IDCardInfo = describeNIK(c.IDCard)
+	return nil
+}
+
+func (s *sqlStore) GetCustomer(c *Customer) error {
+	err := scanCustomer(s.db.QueryRow(s.rebind(`SELECT `+customerColumns+` FROM customer WHERE customer_id = ?`), c.CustomerID), c)
+	if err == sql.ErrNoRows {
+		return ErrCustomerNotFound
+	}
+	return err
+}
+
+func (s *sqlStore) CreateCustomer(c *Customer, notify CustomerNotifyFunc, audit *AuditEntry) error {
+	c.Registered = time.Now().UTC().Truncate(time.Second)
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := s.insertCustomer(tx, c); err != nil {
+		return err
+	}
+
+	if err := s.enqueueOutbox(tx, notify.render(*c)); err != nil {
+		return err
+	}
+
+	if err := s.appendAudit(tx, audit, customerTarget(c.CustomerID), nil, c); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqlStore) GetCustomerAccounts(customerID uint32) ([]Account, error) {
+	if err := s.GetCustomer(&Customer{CustomerID: customerID}); err != nil {
+		return nil, err
+	}
+
+	var q string = accountQuery + `
+									WHERE customer_id = ?
+									OR account_id IN (SELECT account_id FROM account_holder WHERE customer_id = ?)
+									ORDER BY account_id`
+	rows, err := s.db.Query(s.rebind(q), customerID, customerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	accounts := []Account{}
+	for rows.Next() {
+		var acc Account
+		if err := scanAccount(rows, &acc); err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, acc)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	return accounts, s.loadJointHolders(s.db, accountPointers(accounts))
+}
+
+// lockCustomer locks the customer with the given ID and fills in c. It
+// returns ErrCustomerNotFound if there is no such customer.
+func (s *sqlStore) lockCustomer(tx querier, customerID uint32, c *Customer) error {
+	err := scanCustomer(tx.QueryRow(s.rebind(`SELECT `+customerColumns+` FROM customer WHERE customer_id = ?`+s.forUpdate()), customerID), c)
+	if err == sql.ErrNoRows {
+		return ErrCustomerNotFound
+	}
+	return err
+}
+
+func (s *sqlStore) VerifyCustomerEmail(customerID uint32, email string, audit *AuditEntry) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var before Customer
+	if err := s.lockCustomer(tx, customerID, &before); err != nil {
+		return err
+	}
+	if before.Email != email {
+		return ErrEmailChanged
+	}
+	if before.EmailVerified {
+		return nil
+	}
+
+	if _, err := tx.Exec(s.rebind(`UPDATE customer SET email_verified = ? WHERE customer_id = ?`), true, customerID); err != nil {
+		return err
+	}
+
+	// Notifications held for the address can go out now.
+	var q string = `UPDATE outbox
+									SET status = ?, next_attempt_at = ?
+									WHERE status = ? AND recipient = ?`
+	now := time.Now().UTC().Truncate(time.Second)
+	if _, err := tx.Exec(s.rebind(q), OutboxPending, now, OutboxHeld, email); err != nil {
+		return err
+	}
+
+	after := before
+	after.EmailVerified = true
+	if err := s.appendAudit(tx, audit, customerTarget(customerID), before, after); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqlStore) ResendVerificationEmail(customerID uint32, notify CustomerNotifyFunc, audit *AuditEntry) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var c Customer
+	if err := s.lockCustomer(tx, customerID, &c); err != nil {
+		return err
+	}
+	if c.EmailVerified {
+		return ErrEmailVerified
+	}
+
+	if err := s.enqueueOutbox(tx, notify.render(c)); err != nil {
+		return err
+	}
+
+	if err := s.appendAudit(tx, audit, customerTarget(customerID), c, c); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+func (s *sqlStore) ReserveIdempotencyKey(rec IdempotencyRecord, notBefore time.Time) (*IdempotencyRecord, error) {
+	var q string = `INSERT INTO idempotency_key
+									(idempotency_key, request_hash, created_at)
+									VALUES
+									(?,?,?)`
+
+	// Two rounds: the first insert may collide with an expired record that
+	// has to be deleted before the key can be reused.
+	for i := 0; i < 2; i++ {
+		_, err := s.db.Exec(s.rebind(q), rec.Key, rec.RequestHash, rec.CreatedAt)
+		if err == nil {
+			return nil, nil
+		}
+		if s.classify(err) != errUniqueViolation {
+			return nil, err
+		}
+
+		existing, err := s.getIdempotencyRecord(rec.Key)
+		if err == sql.ErrNoRows {
+			// Released between our insert and select; try again.
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !existing.CreatedAt.Before(notBefore) {
+			return existing, nil
+		}
+
+		_, err = s.db.Exec(s.rebind(`DELETE FROM idempotency_key WHERE idempotency_key = ? AND created_at < ?`), rec.Key, notBefore)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return nil, errors.New("could not reserve idempotency key " + rec.Key)
+}
+
+func (s *sqlStore) getIdempotencyRecord(key string) (*IdempotencyRecord, error) {
+	var q string = `SELECT idempotency_key, request_hash, status_code, response_body, created_at
+									FROM idempotency_key
+									WHERE idempotency_key = ?`
+
+	var rec IdempotencyRecord
+	var status sql.NullInt64
+	err := s.db.QueryRow(s.rebind(q), key).Scan(&rec.Key, &rec.RequestHash, &status, &rec.Response, &rec.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	rec.StatusCode = int(status.Int64)
+	return &rec, nil
+}
+
+func (s *sqlStore) CompleteIdempotencyKey(key string, statusCode int, body []byte) error {
+	var q string = `UPDATE idempotency_key
+									SET status_code = ?, response_body = ?
+									WHERE idempotency_key = ?`
+	_, err := s.db.Exec(s.rebind(q), statusCode, body, key)
+	return err
+}
+
+func (s *sqlStore) ReleaseIdempotencyKey(key string) error {
+	_, err := s.db.Exec(s.rebind(`DELETE FROM idempotency_key WHERE idempotency_key = ?`), key)
+	return err
+}
+
+func (s *sqlStore) PurgeIdempotencyKeys(before time.Time) error {
+	_, err := s.db.Exec(s.rebind(`DELETE FROM idempotency_key WHERE created_at < ?`), before)
+	return err
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"database/sql"
+)
+
+// post writes the postings of a journal entry and applies them to the
+// stored balances of the customer accounts involved, which must have been
+// locked with lockAccount in the same transaction.
+func (s *sqlStore) post(tx querier, transactionID uint64, postings []Posting) error {
+	if err := checkBalanced(postings); err != nil {
+		return err
+	}
+
+	for _, p := range postings {
+		var account, system interface{}
+		if p.AccountID != 0 {
+			account = p.AccountID
+		} else {
+			system = p.SystemAccount
+		}
+
+		var q string = `INSERT INTO posting
+										(transaction_id, account_id, system_account, amount)
+										VALUES
+										(?,?,?,?)`
+		if _, err := tx.Exec(s.rebind(q), transactionID, account, system, p.Amount); err != nil {
+			return err
+		}
+
+		if p.AccountID != 0 {
+			_, err := tx.Exec(s.rebind(`UPDATE account SET balance = balance + ? WHERE account_id = ?`), p.Amount, p.AccountID)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *sqlStore) GetPostings(transactionID uint64) ([]Posting, error) {
+	var exists int
+	err := s.db.QueryRow(s.rebind(`SELECT 1 FROM transaction_log WHERE transaction_id = ?`), transactionID).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return nil, ErrTransactionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var q string = `SELECT posting_id, transaction_id, COALESCE(account_id,0), COALESCE(system_account,''), amount
+									FROM posting
+									WHERE transaction_id = ?
+									ORDER BY posting_id`
+	rows, err := s.db.Query(s.rebind(q), transactionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	postings := []Posting{}
+	for rows.Next() {
+		var p Posting
+		if err := rows.Scan(&p.PostingID, &p.TransactionID, &p.AccountID, &p.SystemAccount, &p.Amount); err != nil {
+			return nil, err
+		}
+		postings = append(postings, p)
+	}
+	return postings, rows.Err()
+}
+
+func (s *sqlStore) FindUnbalancedEntries() ([]uint64, error) {
+	var q string = `SELECT tl.transaction_id
+									FROM transaction_log tl
+									LEFT JOIN posting p ON p.transaction_id = tl.transaction_id
+									GROUP BY tl.transaction_id
+									HAVING COUNT(p.posting_id) < 2 OR SUM(p.amount) <> 0
+									ORDER BY tl.transaction_id`
+	rows, err := s.db.Query(q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []uint64{}
+	for rows.Next() {
+		var id uint64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"time"
+)
+
+func (s *sqlStore) insertStatusChange(tx querier, c AccountStatusChange) error {
+	var q string = `INSERT INTO account_status_history
+									(account_id, status, reason, changed_by, changed_at)
+									VALUES
+									(?,?,?,?,?)`
+	_, err := tx.Exec(s.rebind(q), c.AccountID, c.Status, c.Reason, c.ChangedBy, c.ChangedAt)
+	return err
+}
+
+// lockFullAccount locks the account with acc.AccountID and fills in acc.
+// It returns ErrAccountNotFound if there is no such account.
+func (s *sqlStore) lockFullAccount(tx querier, acc *Account) error {
+	if _, err := s.lockAccount(tx, acc.AccountID); err != nil {
+		if err == ErrUnknownAccount {
+			return ErrAccountNotFound
+		}
+		return err
+	}
+	return s.getAccount(tx, acc)
+}
+
+func (s *sqlStore) UpdateAccount(acc *Account, notify CustomerNotifyFunc, audit *AuditEntry) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before := Account{AccountID: acc.AccountID}
+	if err := s.lockFullAccount(tx, &before); err != nil {
+		return err
+	}
+	if before.Status == AccountClosed {
+		return ErrAccountClosed
+	}
+
+	// A new address has to be verified again.
+	verified := before.EmailVerified && acc.Email == before.Email
+	var q string = `UPDATE customer
+									SET name = ?, name_key = ?, email = ?, email_verified = ?
+									WHERE customer_id = ?`
+	_, err = tx.Exec(s.rebind(q), acc.Name, nameSearchKey(acc.Name), acc.Email, verified, before.CustomerID)
+	if err != nil {
+		return err
+	}
+	if err := s.getAccount(tx, acc); err != nil {
+		return err
+	}
+
+	if acc.Email != before.Email {
+		owner := Customer{CustomerID: acc.CustomerID, Name: acc.Name, Email: acc.Email}
+		if err := s.enqueueOutbox(tx, notify.render(owner)); err != nil {
+			return err
+		}
+	}
+
+	if err := s.appendAudit(tx, audit, accountTarget(acc.AccountID), before, acc); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqlStore) UpdateNotificationPreferences(acc *Account, audit *AuditEntry) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before := Account{AccountID: acc.AccountID}
+	if err := s.lockFullAccount(tx, &before); err != nil {
+		return err
+	}
+	if before.Status == AccountClosed {
+		return ErrAccountClosed
+	}
+
+	p := acc.Notifications
+	var q string = `UPDATE account
+									SET notify_deposit_received = ?, notify_deposit_made = ?, notify_large_amount_threshold = ?
+									WHERE account_id = ?`
+	_, err = tx.Exec(s.rebind(q), p.DepositReceived, p.DepositMade, p.LargeAmountThreshold, acc.AccountID)
+	if err != nil {
+		return err
+	}
+	if err := s.getAccount(tx, acc); err != nil {
+		return err
+	}
+
+	if err := s.appendAudit(tx, audit, accountTarget(acc.AccountID), before, acc); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqlStore) ChangeAccountStatus(change *AccountStatusChange, acc *Account, audit *AuditEntry) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before := Account{AccountID: change.AccountID}
+	if err := s.lockFullAccount(tx, &before); err != nil {
+		return err
+	}
+	if err := before.checkStatusChange(change.Status); err != nil {
+		return err
+	}
+
+	change.ChangedAt = time.Now().UTC().Truncate(time.Second)
+	_, err = tx.Exec(s.rebind(`UPDATE account SET status = ? WHERE account_id = ?`), change.Status, change.AccountID)
+	if err != nil {
+		return err
+	}
+	if err := s.insertStatusChange(tx, *change); err != nil {
+		return err
+	}
+
+	acc.AccountID = change.AccountID
+	if err := s.getAccount(tx, acc); err != nil {
+		return err
+	}
+
+	if err := s.appendAudit(tx, audit, accountTarget(acc.AccountID), before, acc); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqlStore) GetAccountStatusHistory(accountID uint32) ([]AccountStatusChange, error) {
+	if err := s.GetAccount(&Account{AccountID: accountID}); err != nil {
+		return nil, err
+	}
+
+	var q string = `SELECT account_id, status, reason, changed_by, changed_at
+									FROM account_status_history
+									WHERE account_id = ?
+									ORDER BY history_id`
+	rows, err := s.db.Query(s.rebind(q), accountID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := []AccountStatusChange{}
+	for rows.Next() {
+		var c AccountStatusChange
+		if err := rows.Scan(&c.AccountID, &c.Status, &c.Reason, &c.ChangedBy, &c.ChangedAt); err != nil {
+			return nil, err
+		}
+		history = append(history, c)
+	}
+	return history, rows.Err()
+}
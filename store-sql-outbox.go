@@ -0,0 +1,101 @@
+package main
+
+import (
+	"database/sql"
+	"time"
+)
+
+// enqueueOutbox queues notifications inside the caller's transaction,
+// holding those for unverified addresses.
+func (s *sqlStore) enqueueOutbox(tx querier, notes []Notification) error {
+	var q string = `INSERT INTO outbox
+									(kind, recipient, subject, body, status, attempts, next_attempt_at, created_at)
+									VALUES
+									(?,?,?,?,?,0,?,?)`
+
+	now := time.Now().UTC().Truncate(time.Second)
+	for _, n := range notes {
+		if n.Recipient == "" {
+			continue
+		}
+		status := OutboxPending
+		if n.Unverified {
+			status = OutboxHeld
+		}
+		_, err := tx.Exec(s.rebind(q), n.Kind, n.Recipient, n.Subject, n.Body, status, now, now)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const outboxColumns = `message_id, kind, recipient, subject, body, status, attempts, COALESCE(last_error,''), next_attempt_at, created_at`
+
+func (s *sqlStore) ClaimOutboxMessages(now time.Time, limit int, lease time.Duration) ([]OutboxMessage, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var q string = `SELECT ` + outboxColumns + `
+									FROM outbox
+									WHERE status = ? AND next_attempt_at <= ?
+									ORDER BY next_attempt_at, message_id
+									LIMIT ?` + s.forUpdate()
+	rows, err := tx.Query(s.rebind(q), OutboxPending, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	msgs, err := scanOutboxMessages(rows)
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	leaseUntil := now.Add(lease)
+	for _, msg := range msgs {
+		_, err := tx.Exec(s.rebind(`UPDATE outbox SET next_attempt_at = ? WHERE message_id = ?`), leaseUntil, msg.MessageID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return msgs, tx.Commit()
+}
+
+func (s *sqlStore) UpdateOutboxMessage(msg OutboxMessage) error {
+	var q string = `UPDATE outbox
+									SET status = ?, attempts = ?, last_error = ?, next_attempt_at = ?
+									WHERE message_id = ?`
+	_, err := s.db.Exec(s.rebind(q), msg.Status, msg.Attempts, msg.LastError, msg.NextAttemptAt, msg.MessageID)
+	return err
+}
+
+func (s *sqlStore) GetOutboxMessages(status string) ([]OutboxMessage, error) {
+	var q string = `SELECT ` + outboxColumns + `
+									FROM outbox
+									WHERE status = ?
+									ORDER BY message_id`
+	rows, err := s.db.Query(s.rebind(q), status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanOutboxMessages(rows)
+}
+
+func scanOutboxMessages(rows *sql.Rows) ([]OutboxMessage, error) {
+	msgs := []OutboxMessage{}
+	for rows.Next() {
+		var m OutboxMessage
+		err := rows.Scan(&m.MessageID, &m.Kind, &m.Recipient, &m.Subject, &m.Body, &m.Status, &m.Attempts, &m.LastError, &m.NextAttemptAt, &m.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, m)
+	}
+	return msgs, rows.Err()
+}
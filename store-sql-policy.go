@@ -0,0 +1,30 @@
+package main
+
+// usageQuery sums today's and this month's unreversed deposits matching
+// the match condition. Its parameters are the day start, the deposit kind,
+// the month start and then those of match.
+func usageQuery(match string) string {
+	return `SELECT COALESCE(SUM(CASE WHEN tl.transaction_time >= ? THEN tl.amount ELSE 0 END),0), COALESCE(SUM(tl.amount),0)
+					FROM transaction_log tl
+					WHERE tl.kind = ? AND tl.transaction_time >= ? AND ` + match + `
+					AND NOT EXISTS (SELECT 1 FROM transaction_log r WHERE r.reversal_of = tl.transaction_id)`
+}
+
+// depositUsage sums the deposits that count towards policy's cumulative
+// limits for trans, inside the transaction that will record it. The caller
+// must hold the chain head lock, which keeps concurrent deposits into
+// other accounts from changing the depositor's totals.
+func (s *sqlStore) depositUsage(tx querier, trans Transaction, policy *DepositPolicy) (DepositUsage, error) {
+	day, month := policy.Periods(trans.TransactionTime)
+
+	var usage DepositUsage
+	err := tx.QueryRow(s.rebind(usageQuery("tl.destination = ?")), day, KindDeposit, month, trans.DepositDest).Scan(&usage.AccountDay, &usage.AccountMonth)
+	if err != nil {
+		return usage, err
+	}
+
+	if trans.ExternalSource != "" {
+		err = tx.QueryRow(s.rebind(usageQuery("LOWER(tl.source_external) = LOWER(?)")), day, KindDeposit, month, trans.ExternalSource).Scan(&usage.DepositorDay, &usage.DepositorMonth)
+	}
+	return usage, err
+}
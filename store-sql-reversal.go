@@ -0,0 +1,102 @@
+package main
+
+import (
+	"database/sql"
+	"sort"
+	"time"
+)
+
+func (s *sqlStore) ReverseTransaction(trans *Transaction, audit *AuditEntry) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var q string = `SELECT kind, destination, amount
+									FROM transaction_log
+									WHERE transaction_id = ?`
+	var kind string
+	var dest uint32
+	var amount Money
+	err = tx.QueryRow(s.rebind(q), trans.ReversalOf).Scan(&kind, &dest, &amount)
+	if err == sql.ErrNoRows {
+		return ErrTransactionNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if kind == KindReversal {
+		return ErrNotReversible
+	}
+
+	rows, err := tx.Query(s.rebind(`SELECT COALESCE(account_id,0), COALESCE(system_account,''), amount FROM posting WHERE transaction_id = ? ORDER BY posting_id`), trans.ReversalOf)
+	if err != nil {
+		return err
+	}
+	original := []Posting{}
+	for rows.Next() {
+		var p Posting
+		if err := rows.Scan(&p.AccountID, &p.SystemAccount, &p.Amount); err != nil {
+			rows.Close()
+			return err
+		}
+		original = append(original, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// Lock in account ID order, as transfers do.
+	ids := []uint32{}
+	for _, p := range original {
+		if p.AccountID != 0 {
+			ids = append(ids, p.AccountID)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		if _, err := s.lockAccount(tx, id); err != nil {
+			return err
+		}
+	}
+
+	trans.Kind = KindReversal
+	trans.Status = StatusPosted
+	trans.DepositDest = dest
+	trans.Amount = amount
+	trans.TransactionTime = time.Now().UTC().Truncate(time.Second)
+
+	head, err := s.lockChainHead(tx)
+	if err != nil {
+		return err
+	}
+
+	q = `INSERT INTO transaction_log
+				(kind, destination, amount, transaction_time, reversal_of, reason_code, operator, created_by)
+				VALUES
+				(?,?,?,?,?,?,?,?)`
+	id, err := s.insert(tx, q, "transaction_id", KindReversal, trans.DepositDest, trans.Amount, trans.TransactionTime, trans.ReversalOf, trans.ReasonCode, trans.Operator, trans.CreatedBy)
+	if err != nil {
+		if err == errUniqueViolation {
+			return ErrAlreadyReversed
+		}
+		return err
+	}
+	trans.TransactionID = uint64(id)
+
+	if err := s.linkChain(tx, &head, trans.TransactionID); err != nil {
+		return err
+	}
+
+	if err := s.post(tx, trans.TransactionID, reversalPostings(original)); err != nil {
+		return err
+	}
+
+	if err := s.appendAudit(tx, audit, transactionTarget(trans.TransactionID), nil, trans); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
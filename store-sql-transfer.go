@@ -0,0 +1,89 @@
+package main
+
+import (
+	"time"
+)
+
+func (s *sqlStore) CreateTransfer(trans *Transaction, notify NotifyFunc, audit *AuditEntry) error {
+	if trans.InternalSource == trans.DepositDest {
+		return ErrSameAccount
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Lock in account ID order so two opposite transfers cannot deadlock.
+	first, second := trans.InternalSource, trans.DepositDest
+	if second < first {
+		first, second = second, first
+	}
+	locked := map[uint32]Account{}
+	for _, id := range []uint32{first, second} {
+		acc, err := s.lockAccount(tx, id)
+		if err != nil {
+			return err
+		}
+		locked[id] = acc
+	}
+
+	src, dest := locked[trans.InternalSource], locked[trans.DepositDest]
+	if err := src.checkOpen(); err != nil {
+		return err
+	}
+	if err := dest.checkOpen(); err != nil {
+		return err
+	}
+	if src.Available() < trans.Amount {
+		return ErrInsufficientFunds
+	}
+
+	trans.Kind = KindTransfer
+	trans.Status = StatusPosted
+	trans.ExternalSource = ""
+	trans.Name = src.Name
+	trans.InternalSourceEmail = src.Email
+	trans.InternalSourceEmailVerified = src.EmailVerified
+	trans.DepositDestEmail = dest.Email
+	trans.DepositDestEmailVerified = dest.EmailVerified
+	trans.DepositDestBalance = dest.Balance + trans.Amount
+	trans.DepositDestNotifications = dest.Notifications
+	trans.TransactionTime = time.Now().UTC().Truncate(time.Second)
+
+	head, err := s.lockChainHead(tx)
+	if err != nil {
+		return err
+	}
+
+	var q string = `INSERT INTO transaction_log
+									(kind, source_internal, destination, amount, transaction_time, created_by)
+									VALUES
+									(?,?,?,?,?,?)`
+	id, err := s.insert(tx, q, "transaction_id", KindTransfer, trans.InternalSource, trans.DepositDest, trans.Amount, trans.TransactionTime, trans.CreatedBy)
+	if err != nil {
+		return err
+	}
+	trans.TransactionID = uint64(id)
+
+	if err := s.linkChain(tx, &head, trans.TransactionID); err != nil {
+		return err
+	}
+
+	if err := s.post(tx, trans.TransactionID, transferPostings(*trans)); err != nil {
+		return err
+	}
+
+	if notify != nil {
+		if err := s.enqueueOutbox(tx, notify(*trans)); err != nil {
+			return err
+		}
+	}
+
+	if err := s.appendAudit(tx, audit, transactionTarget(trans.TransactionID), nil, trans); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"time"
+)
+
+func (s *sqlStore) CreateWithdrawal(trans *Transaction, notify NotifyFunc, audit *AuditEntry) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	acc, err := s.lockAccount(tx, trans.DepositDest)
+	if err != nil {
+		return err
+	}
+	if err := acc.checkOpen(); err != nil {
+		return err
+	}
+	if acc.Available() < trans.Amount {
+		return ErrInsufficientFunds
+	}
+
+	trans.Kind = KindWithdrawal
+	trans.Status = StatusPosted
+	trans.ExternalSource = ""
+	trans.InternalSource = 0
+	trans.DepositDestEmail = acc.Email
+	trans.DepositDestEmailVerified = acc.EmailVerified
+	trans.TransactionTime = time.Now().UTC().Truncate(time.Second)
+
+	head, err := s.lockChainHead(tx)
+	if err != nil {
+		return err
+	}
+
+	var q string = `INSERT INTO transaction_log
+									(kind, destination, amount, transaction_time, created_by)
+									VALUES
+									(?,?,?,?,?)`
+	id, err := s.insert(tx, q, "transaction_id", KindWithdrawal, trans.DepositDest, trans.Amount, trans.TransactionTime, trans.CreatedBy)
+	if err != nil {
+		return err
+	}
+	trans.TransactionID = uint64(id)
+
+	if err := s.linkChain(tx, &head, trans.TransactionID); err != nil {
+		return err
+	}
+
+	if err := s.post(tx, trans.TransactionID, withdrawalPostings(*trans)); err != nil {
+		return err
+	}
+
+	if notify != nil {
+		if err := s.enqueueOutbox(tx, notify(*trans)); err != nil {
+			return err
+		}
+	}
+
+	if err := s.appendAudit(tx, audit, transactionTarget(trans.TransactionID), nil, trans); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
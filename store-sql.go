@@ -0,0 +1,629 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dialect captures what differs between the SQL databases sqlStore runs on.
+type dialect struct {
+	// name is the migrations/<name> directory holding the schema.
+	name string
+
+	// driver is the database/sql driver name.
+	driver string
+
+	// open, when set, replaces sql.Open for drivers that need connection
+	// settings applied.
+	open func(dsn string) (*sql.DB, error)
+
+	// dollarParams rewrites "?" placeholders to "$1", "$2", ...
+	dollarParams bool
+
+	// returningID fetches generated keys with INSERT ... RETURNING instead
+	// of sql.Result.LastInsertId.
+	returningID bool
+
+	// noRowLocks is set for databases without SELECT ... FOR UPDATE. They
+	// must serialize write transactions some other way.
+	noRowLocks bool
+
+	// classify maps a driver error to errUniqueViolation or
+	// errForeignKeyViolation, or returns it unchanged.
+	classify func(err error) error
+}
+
+var (
+	errUniqueViolation     = errors.New("unique constraint violation")
+	errForeignKeyViolation = errors.New("foreign key constraint violation")
+)
+
+var dialects = map[string]dialect{}
+
+func registerDialect(d dialect) {
+	dialects[d.name] = d
+}
+
+// querier is satisfied by both *sql.DB and *sql.Tx.
+type querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// sqlStore implements Store on any registered SQL dialect. Queries are
+// written with "?" placeholders and rebound for the dialect.
+type sqlStore struct {
+	db      *sql.DB
+	dialect dialect
+}
+
+// openSQLStore connects to the database, brings its schema up to date and
+// returns a store on top of it.
+func openSQLStore(name, dsn string) (*sqlStore, error) {
+	d, ok := dialects[name]
+	if !ok {
+		return nil, errors.New("unsupported database driver " + strconv.Quote(name))
+	}
+
+	var db *sql.DB
+	var err error
+	if d.open != nil {
+		db, err = d.open(dsn)
+	} else {
+		db, err = sql.Open(d.driver, dsn)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s := &sqlStore{db: db, dialect: d}
+	if err := migrate(db, s.rebind, d.name); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := s.initChain(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *sqlStore) rebind(q string) string {
+	if !s.dialect.dollarParams {
+		return q
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, r := range q {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// forUpdate returns the row locking suffix for SELECTs inside a write
+// transaction.
+func (s *sqlStore) forUpdate() string {
+	if s.dialect.noRowLocks {
+		return ""
+	}
+	return " FOR UPDATE"
+}
+
+func (s *sqlStore) classify(err error) error {
+	if err == nil || s.dialect.classify == nil {
+		return err
+	}
+	return s.dialect.classify(err)
+}
+
+// insert runs an INSERT and returns the generated value of idColumn.
+func (s *sqlStore) insert(db querier, q, idColumn string, args ...interface{}) (int64, error) {
+	var id int64
+	if s.dialect.returningID {
+		err := db.QueryRow(s.rebind(q+" RETURNING "+idColumn), args...).Scan(&id)
+		return id, s.classify(err)
+	}
+
+	res, err := db.Exec(s.rebind(q), args...)
+	if err != nil {
+		return 0, s.classify(err)
+	}
+	return res.LastInsertId()
+}
+
+// accountQuery selects every account with its balance and its owner's
+// identity; callers add WHERE and ORDER BY clauses on the "a" derived
+// table. Joint holders are loaded separately by loadJointHolders.
+const accountQuery = `SELECT account_id, customer_id, id_card_number, name, email, email_verified, balance, registration_time, overdraft_limit, status, product_type,
+											notify_deposit_received, notify_deposit_made, notify_large_amount_threshold
+									FROM (
+										SELECT acc.account_id, acc.customer_id, c.id_card_number, c.name, c.name_key, c.email, c.email_verified, acc.registration_time, acc.balance, acc.overdraft_limit, acc.status, acc.product_type,
+											acc.notify_deposit_received, acc.notify_deposit_made, acc.notify_large_amount_threshold
+										FROM account acc
+										JOIN customer c ON c.customer_id = acc.customer_id
+									) a`
+
+func scanAccount(row interface{ Scan(...interface{}) error }, acc *Account) error {
+	if err := row.Scan(&acc.AccountID, &acc.CustomerID, &acc.IDCard, &acc.Name, &acc.Email, &acc.EmailVerified, &acc.Balance, &acc.Registered, &acc.OverdraftLimit, &acc.Status, &acc.ProductType,
+		&acc.Notifications.DepositReceived, &acc.Notifications.DepositMade, &acc.Notifications.LargeAmountThreshold); err != nil {
+		return err
+	}
+	acc.IDCardInfo = describeNIK(acc.IDCard)
+	return nil
+}
+
+func (s *sqlStore) GetAccount(acc *Account) error {
+	return s.getAccount(s.db, acc)
+}
+
+// getAccount fills in the account with acc.AccountID using db, which may
+// be a transaction.
+func (s *sqlStore) getAccount(db querier, acc *Account) error {
+	var q string = accountQuery + ` WHERE account_id = ?`
+	err := scanAccount(db.QueryRow(s.rebind(q), acc.AccountID), acc)
+	if err == sql.ErrNoRows {
+		return ErrAccountNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return s.loadJointHolders(db, []*Account{acc})
+}
+
+func (s *sqlStore) CreateAccount(acc *Account, notify CustomerNotifyFunc, audit *AuditEntry) error {
+	acc.Registered = time.Now().UTC().Truncate(time.Second)
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if acc.CustomerID == 0 {
+		owner := Customer{IDCard: acc.IDCard, Name: acc.Name, Email: acc.Email, EmailVerified: acc.EmailVerified, Registered: acc.Registered}
+		if err := s.insertCustomer(tx, &owner); err != nil {
+			if err == ErrDuplicateCustomer {
+				return ErrDuplicateAccount
+			}
+			return err
+		}
+		acc.CustomerID = owner.CustomerID
+
+		if err := s.enqueueOutbox(tx, notify.render(owner)); err != nil {
+			return err
+		}
+	}
+
+	var q string = `INSERT INTO account
+									(customer_id, registration_time, overdraft_limit, product_type)
+									VALUES
+									(?,?,?,?)`
+	id, err := s.insert(tx, q, "account_id", acc.CustomerID, acc.Registered, acc.OverdraftLimit, acc.ProductType)
+	if err != nil {
+		if err == errForeignKeyViolation {
+			return ErrCustomerNotFound
+		}
+		return err
+	}
+	acc.AccountID = uint32(id)
+
+	for _, holder := range acc.JointHolders {
+		_, err := tx.Exec(s.rebind(`INSERT INTO account_holder (account_id, customer_id) VALUES (?,?)`), acc.AccountID, holder)
+		if err != nil {
+			if err = s.classify(err); err == errForeignKeyViolation {
+				return ErrCustomerNotFound
+			}
+			return err
+		}
+	}
+
+	if err := s.getAccount(tx, acc); err != nil {
+		return err
+	}
+
+	registration := AccountStatusChange{AccountID: acc.AccountID, Status: AccountActive, ChangedBy: actorOf(audit), ChangedAt: acc.Registered}
+	if err := s.insertStatusChange(tx, registration); err != nil {
+		return err
+	}
+
+	if err := s.appendAudit(tx, audit, accountTarget(acc.AccountID), nil, acc); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+var accountSortColumns = map[string]string{
+	AccountSortName:       "name",
+	AccountSortRegistered: "registration_time",
+	AccountSortBalance:    "balance",
+}
+
+func (s *sqlStore) GetAccounts(f AccountFilter) ([]Account, int, error) {
+	where := []string{"1=1"}
+	args := []interface{}{}
+
+	if f.NamePrefix != "" {
+		// "!" escapes LIKE wildcards the same way on every dialect.
+		prefix := strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(nameSearchKey(f.NamePrefix))
+		where = append(where, "name_key LIKE ? ESCAPE '!'")
+		args = append(args, prefix+"%")
+	}
+	if f.Email != "" {
+		where = append(where, "LOWER(email) = ?")
+		args = append(args, strings.ToLower(f.Email))
+	}
+	if f.IDCard != "" {
+		where = append(where, "id_card_number = ?")
+		args = append(args, f.IDCard)
+	}
+	if !f.RegisteredFrom.IsZero() {
+		where = append(where, "registration_time >= ?")
+		args = append(args, f.RegisteredFrom)
+	}
+	if !f.RegisteredTo.IsZero() {
+		where = append(where, "registration_time < ?")
+		args = append(args, f.RegisteredTo)
+	}
+
+	var total int
+	err := s.db.QueryRow(s.rebind(`SELECT COUNT(*) FROM (`+accountQuery+` WHERE `+strings.Join(where, " AND ")+`) c`), args...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	column, ok := accountSortColumns[f.Sort]
+	if !ok {
+		column = accountSortColumns[AccountSortRegistered]
+	}
+	dir, cmp := "ASC", ">"
+	if f.Desc {
+		dir, cmp = "DESC", "<"
+	}
+
+	if f.After != nil {
+		var key interface{}
+		switch column {
+		case "name":
+			key = f.After.Name
+		case "balance":
+			key = f.After.Balance
+		default:
+			key = f.After.Registered
+		}
+		where = append(where, "("+column+" "+cmp+" ? OR ("+column+" = ? AND account_id "+cmp+" ?))")
+		args = append(args, key, key, f.After.AccountID)
+	}
+	args = append(args, f.Limit)
+
+	var q string = accountQuery + `
+									WHERE ` + strings.Join(where, " AND ") + `
+									ORDER BY ` + column + ` ` + dir + `, account_id ` + dir + `
+									LIMIT ?`
+	rows, err := s.db.Query(s.rebind(q), args...)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	defer rows.Close()
+
+	accounts := []Account{}
+	for rows.Next() {
+		var accnt Account
+		if err := scanAccount(rows, &accnt); err != nil {
+			return nil, 0, err
+		}
+		accounts = append(accounts, accnt)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	rows.Close()
+
+	return accounts, total, s.loadJointHolders(s.db, accountPointers(accounts))
+}
+
+// accountPointers returns pointers to the elements of accounts.
+func accountPointers(accounts []Account) []*Account {
+	ptrs := make([]*Account, len(accounts))
+	for i := range accounts {
+		ptrs[i] = &accounts[i]
+	}
+	return ptrs
+}
+
+// loadJointHolders sets JointHolders on each of accounts.
+func (s *sqlStore) loadJointHolders(db querier, accounts []*Account) error {
+	if len(accounts) == 0 {
+		return nil
+	}
+
+	byID := map[uint32]*Account{}
+	args := make([]interface{}, len(accounts))
+	for i, acc := range accounts {
+		acc.JointHolders = []uint32{}
+		byID[acc.AccountID] = acc
+		args[i] = acc.AccountID
+	}
+
+	var q string = `SELECT account_id, customer_id
+									FROM account_holder
+									WHERE account_id IN (?` + strings.Repeat(",?", len(accounts)-1) + `)
+									ORDER BY account_id, customer_id`
+	rows, err := db.Query(s.rebind(q), args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var accountID, customerID uint32
+		if err := rows.Scan(&accountID, &customerID); err != nil {
+			return err
+		}
+		acc := byID[accountID]
+		acc.JointHolders = append(acc.JointHolders, customerID)
+	}
+	return rows.Err()
+}
+
+const transactionColumns = `tl.kind, tl.destination, tl.transaction_time, tl.transaction_id, COALESCE(tl.source_external,''), COALESCE(tl.source_internal,0), tl.amount, COALESCE(acc.name,''), COALESCE(acc.email,''),
+									CASE WHEN EXISTS (SELECT 1 FROM transaction_log r WHERE r.reversal_of = tl.transaction_id) THEN 'reversed' ELSE 'posted' END,
+									COALESCE(tl.reversal_of,0), COALESCE(tl.reason_code,''), COALESCE(tl.operator,''), COALESCE(tl.created_by,'')`
+
+// GetHistory lists the transactions that posted to the account, with the
+// net amount posted to it deciding the direction.
+func (s *sqlStore) GetHistory(accountID uint32) ([]Transaction, error) {
+	var q string = `SELECT ` + transactionColumns + `, h.net
+									FROM transaction_log tl
+									JOIN (
+										SELECT transaction_id, SUM(amount) AS net
+										FROM posting
+										WHERE account_id = ?
+										GROUP BY transaction_id
+									) h ON h.transaction_id = tl.transaction_id
+									LEFT JOIN account src ON src.account_id = tl.source_internal
+									LEFT JOIN customer acc ON acc.customer_id = src.customer_id
+									ORDER BY tl.transaction_time DESC, tl.transaction_id DESC`
+	rows, err := s.db.Query(s.rebind(q), accountID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	transactions := []Transaction{}
+	for rows.Next() {
+		var t Transaction
+		var net Money
+		if err := scanTransaction(rows, &t, &net); err != nil {
+			return nil, err
+		}
+		t.Direction = direction(net)
+		transactions = append(transactions, t)
+	}
+
+	return transactions, rows.Err()
+}
+
+// lockAccount reads an account's stored balance, overdraft limit, status
+// and owner's name and email inside a write transaction, locking the
+// account row until the transaction ends. It returns ErrUnknownAccount if
+// there is no such account.
+//
+// The owner is read without a lock: a customer's accounts are locked
+// independently, and locking the shared customer row as well could
+// deadlock transfers between them.
+func (s *sqlStore) lockAccount(tx querier, id uint32) (Account, error) {
+	acc := Account{AccountID: id}
+	var q string = `SELECT customer_id, balance, overdraft_limit, status, notify_deposit_received, notify_deposit_made, notify_large_amount_threshold
+									FROM account WHERE account_id = ?` + s.forUpdate()
+	err := tx.QueryRow(s.rebind(q), id).Scan(&acc.CustomerID, &acc.Balance, &acc.OverdraftLimit, &acc.Status,
+		&acc.Notifications.DepositReceived, &acc.Notifications.DepositMade, &acc.Notifications.LargeAmountThreshold)
+	if err == sql.ErrNoRows {
+		return acc, ErrUnknownAccount
+	}
+	if err != nil {
+		return acc, err
+	}
+	err = tx.QueryRow(s.rebind(`SELECT name, email, email_verified FROM customer WHERE customer_id = ?`), acc.CustomerID).Scan(&acc.Name, &acc.Email, &acc.EmailVerified)
+	return acc, err
+}
+
+func (s *sqlStore) CreateTransaction(trans *Transaction, policy *DepositPolicy, notify NotifyFunc, audit *AuditEntry) error {
+	// The depositor limits sum deposits into every account, so they are
+	// only checked once the chain head lock has serialized deposits. Read
+	// committed lets those sums see what the deposits before this one
+	// committed while it waited; under MySQL's default repeatable read they
+	// would come from a snapshot taken before.
+	tx, err := s.db.BeginTx(context.Background(), &sql.TxOptions{Isolation: sql.LevelReadCommitted})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var q string
+	var id int64
+
+	dest, err := s.lockAccount(tx, trans.DepositDest)
+	if err != nil {
+		return err
+	}
+	if err := dest.checkOpen(); err != nil {
+		return err
+	}
+	trans.Kind = KindDeposit
+	trans.Status = StatusPosted
+	trans.DepositDestEmail = dest.Email
+	trans.DepositDestEmailVerified = dest.EmailVerified
+	trans.DepositDestBalance = dest.Balance + trans.Amount
+	trans.DepositDestNotifications = dest.Notifications
+
+	// The time is set here rather than by the column default so every
+	// backend stores it in the same form and keyset pagination compares
+	// like with like.
+	trans.TransactionTime = time.Now().UTC().Truncate(time.Second)
+
+	head, err := s.lockChainHead(tx)
+	if err != nil {
+		return err
+	}
+
+	if policy != nil {
+		var usage DepositUsage
+		if policy.needsUsage() {
+			usage, err = s.depositUsage(tx, *trans, policy)
+			if err != nil {
+				return err
+			}
+		}
+		if err := policy.Check(*trans, usage); err != nil {
+			return err
+		}
+	}
+
+	if trans.InternalSource == 0 {
+		q = `INSERT INTO transaction_log
+				(kind, source_external, destination, amount, transaction_time, created_by)
+				VALUES
+				(?,?,?,?,?,?)`
+		id, err = s.insert(tx, q, "transaction_id", KindDeposit, trans.ExternalSource, trans.DepositDest, trans.Amount, trans.TransactionTime, trans.CreatedBy)
+	} else {
+		q = `INSERT INTO transaction_log
+				(kind, source_internal, destination, amount, transaction_time, created_by)
+				VALUES
+				(?,?,?,?,?,?)`
+		id, err = s.insert(tx, q, "transaction_id", KindDeposit, trans.InternalSource, trans.DepositDest, trans.Amount, trans.TransactionTime, trans.CreatedBy)
+	}
+	if err != nil {
+		if err == errForeignKeyViolation {
+			return ErrUnknownAccount
+		}
+		return err
+	}
+	trans.TransactionID = uint64(id)
+
+	if err := s.linkChain(tx, &head, trans.TransactionID); err != nil {
+		return err
+	}
+
+	if err := s.post(tx, trans.TransactionID, depositPostings(*trans)); err != nil {
+		return err
+	}
+
+	if trans.InternalSource != 0 {
+		q = `SELECT c.email, c.email_verified, acc.notify_deposit_received, acc.notify_deposit_made, acc.notify_large_amount_threshold
+				 FROM account acc
+				 JOIN customer c ON c.customer_id = acc.customer_id
+				 WHERE acc.account_id = ?`
+		prefs := &trans.InternalSourceNotifications
+		err = tx.QueryRow(s.rebind(q), trans.InternalSource).Scan(&trans.InternalSourceEmail, &trans.InternalSourceEmailVerified, &prefs.DepositReceived, &prefs.DepositMade, &prefs.LargeAmountThreshold)
+		if err != nil {
+			return err
+		}
+	}
+
+	if notify != nil {
+		if err := s.enqueueOutbox(tx, notify(*trans)); err != nil {
+			return err
+		}
+	}
+
+	if err := s.appendAudit(tx, audit, transactionTarget(trans.TransactionID), nil, trans); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqlStore) GetTransactions(f TransactionFilter) ([]Transaction, error) {
+	where := []string{"1=1"}
+	args := []interface{}{}
+
+	if f.BeforeID != 0 {
+		where = append(where, "(tl.transaction_time < ? OR (tl.transaction_time = ? AND tl.transaction_id < ?))")
+		args = append(args, f.BeforeTime, f.BeforeTime, f.BeforeID)
+	}
+	if !f.From.IsZero() {
+		where = append(where, "tl.transaction_time >= ?")
+		args = append(args, f.From)
+	}
+	if !f.To.IsZero() {
+		where = append(where, "tl.transaction_time < ?")
+		args = append(args, f.To)
+	}
+	if f.MinAmount != nil {
+		where = append(where, "tl.amount >= ?")
+		args = append(args, *f.MinAmount)
+	}
+	if f.MaxAmount != nil {
+		where = append(where, "tl.amount <= ?")
+		args = append(args, *f.MaxAmount)
+	}
+	switch f.Source {
+	case SourceInternal:
+		where = append(where, "tl.source_internal IS NOT NULL")
+	case SourceExternal:
+		where = append(where, "tl.source_external IS NOT NULL")
+	}
+	if f.Destination != 0 {
+		where = append(where, "tl.destination = ?")
+		args = append(args, f.Destination)
+	}
+	args = append(args, f.Limit)
+
+	var q string = `SELECT ` + transactionColumns + `
+									FROM transaction_log tl
+									LEFT JOIN account src ON src.account_id = tl.source_internal
+									LEFT JOIN customer acc ON acc.customer_id = src.customer_id
+									WHERE ` + strings.Join(where, " AND ") + `
+									ORDER BY tl.transaction_time DESC, tl.transaction_id DESC
+									LIMIT ?`
+	rows, err := s.db.Query(s.rebind(q), args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	return scanTransactions(rows)
+}
+
+// scanTransaction reads the transactionColumns of one row into t, followed
+// by any extra columns the query selects.
+func scanTransaction(row interface{ Scan(...interface{}) error }, t *Transaction, extra ...interface{}) error {
+	dest := []interface{}{&t.Kind, &t.DepositDest, &t.TransactionTime, &t.TransactionID, &t.ExternalSource, &t.InternalSource, &t.Amount, &t.Name, &t.InternalSourceEmail,
+		&t.Status, &t.ReversalOf, &t.ReasonCode, &t.Operator, &t.CreatedBy}
+	return row.Scan(append(dest, extra...)...)
+}
+
+func scanTransactions(rows *sql.Rows) ([]Transaction, error) {
+	transactions := []Transaction{}
+	for rows.Next() {
+		var t Transaction
+		err := scanTransaction(rows, &t)
+
+		if err != nil {
+			return nil, err
+		}
+		transactions = append(transactions, t)
+	}
+
+	return transactions, rows.Err()
+}
+
+var _ Store = (*sqlStore)(nil)
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+func init() {
+	registerDialect(dialect{
+		name:       "sqlite",
+		driver:     "sqlite3",
+		open:       openSQLite,
+		noRowLocks: true,
+		classify:   classifySQLiteError,
+	})
+}
+
+func openSQLite(dsn string) (*sql.DB, error) {
+	// Foreign keys are off by default in SQLite.
+	sep := "?"
+	if strings.Contains(dsn, "?") {
+		sep = "&"
+	}
+	db, err := sql.Open("sqlite3", dsn+sep+"_foreign_keys=1")
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite allows a single writer; one connection avoids "database is
+	// locked" errors and keeps ":memory:" databases alive.
+	db.SetMaxOpenConns(1)
+	return db, nil
+}
+
+func classifySQLiteError(err error) error {
+	var liteErr sqlite3.Error
+	if !errors.As(err, &liteErr) {
+		return err
+	}
+
+	switch liteErr.ExtendedCode {
+	case sqlite3.ErrConstraintUnique, sqlite3.ErrConstraintPrimaryKey:
+		return errUniqueViolation
+	case sqlite3.ErrConstraintForeignKey:
+		return errForeignKeyViolation
+	}
+	return err
+}
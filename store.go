@@ -0,0 +1,320 @@
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+// AccountStore persists customer accounts.
+type AccountStore interface {
+	GetAccount(acc *Account) error
+	// GetAccounts returns a page of accounts and the number of accounts
+	// matching the filter on all pages.
+	GetAccounts(f AccountFilter) ([]Account, int, error)
+	// CreateAccount opens an account for the customer acc.CustomerID, or
+	// registers a new customer from acc.IDCard, acc.Name and acc.Email when
+	// it is zero. ErrCustomerNotFound is returned if the owner or a joint
+	// holder does not exist. The notifications notify renders for a newly
+	// registered owner are queued with the account.
+	CreateAccount(acc *Account, notify CustomerNotifyFunc, audit *AuditEntry) error
+
+	// UpdateAccount saves the name and email of the owner of the account
+	// with acc.AccountID, which changes them on all of the owner's
+	// accounts, and fills in the rest of acc. Closed accounts cannot be
+	// updated. If the email address changed, the notifications notify
+	// renders for the owner are queued with the change.
+	UpdateAccount(acc *Account, notify CustomerNotifyFunc, audit *AuditEntry) error
+
+	// UpdateNotificationPreferences saves acc.Notifications for the account
+	// with acc.AccountID and fills in the rest of acc. Closed accounts
+	// cannot be updated.
+	UpdateNotificationPreferences(acc *Account, audit *AuditEntry) error
+
+	// ChangeAccountStatus moves the account change.AccountID to
+	// change.Status, records change in its status history and fills in acc
+	// with the result. The account is locked for the duration. It returns
+	// ErrAccountClosed, ErrInvalidStatusChange or ErrBalanceNotZero when
+	// the change is not allowed.
+	ChangeAccountStatus(change *AccountStatusChange, acc *Account, audit *AuditEntry) error
+
+	// GetAccountStatusHistory returns the status changes of an account,
+	// oldest first, starting with its registration.
+	GetAccountStatusHistory(accountID uint32) ([]AccountStatusChange, error)
+
+	// CheckBalances recomputes every account balance from its ledger
+	// postings and returns the accounts whose stored balance differs. With
+	// repair, the stored balances are corrected as well.
+	CheckBalances(repair bool) ([]BalanceDrift, error)
+}
+
+// CustomerStore persists customers.
+type CustomerStore interface {
+	GetCustomer(c *Customer) error
+	// CreateCustomer registers c and queues the notifications notify
+	// renders for it in the same transaction.
+	CreateCustomer(c *Customer, notify CustomerNotifyFunc, audit *AuditEntry) error
+
+	// GetCustomerAccounts returns the accounts a customer owns or jointly
+	// holds, in account ID order.
+	GetCustomerAccounts(customerID uint32) ([]Account, error)
+
+	// VerifyCustomerEmail marks the customer's address as verified and
+	// releases the notifications held for it. It returns ErrEmailChanged
+	// if email is no longer the customer's address, and does nothing if it
+	// is already verified.
+	VerifyCustomerEmail(customerID uint32, email string, audit *AuditEntry) error
+
+	// ResendVerificationEmail queues the notifications notify renders for
+	// a customer whose address is not verified yet. It returns
+	// ErrEmailVerified if it is.
+	ResendVerificationEmail(customerID uint32, notify CustomerNotifyFunc, audit *AuditEntry) error
+}
+
+// BalanceDrift is an account whose stored balance does not match the sum
+// of its postings.
+type BalanceDrift struct {
+	AccountID uint32 `json:"accountid"`
+	Stored    Money  `json:"stored"`
+	Computed  Money  `json:"computed"`
+}
+
+// TransactionStore persists deposits into the transaction log.
+type TransactionStore interface {
+	// GetHistory returns every transaction that credited or debited the
+	// account, newest first, with Direction set.
+	GetHistory(accountID uint32) ([]Transaction, error)
+	GetTransactions(f TransactionFilter) ([]Transaction, error)
+
+	// CreateTransaction records a deposit. The messages notify returns for
+	// the stored transaction are queued in the outbox within the same
+	// database transaction, so either both are saved or neither is. If
+	// policy is not nil, the deposit is checked against it while the
+	// destination account is locked and its *PolicyViolation is returned.
+	CreateTransaction(trans *Transaction, policy *DepositPolicy, notify NotifyFunc, audit *AuditEntry) error
+
+	// CreateTransfer moves trans.Amount from trans.InternalSource to
+	// trans.DepositDest. Both accounts are locked for the duration, and
+	// ErrInsufficientFunds is returned if the source balance does not
+	// cover the amount. ErrSameAccount is returned if source and
+	// destination are equal.
+	CreateTransfer(trans *Transaction, notify NotifyFunc, audit *AuditEntry) error
+
+	// CreateWithdrawal pays trans.Amount out of account trans.DepositDest
+	// in cash. The account is locked for the duration, and
+	// ErrInsufficientFunds is returned if the amount exceeds its balance
+	// plus overdraft limit.
+	CreateWithdrawal(trans *Transaction, notify NotifyFunc, audit *AuditEntry) error
+
+	// ReverseTransaction posts a reversal of the transaction trans.ReversalOf,
+	// recording trans.ReasonCode and trans.Operator, and fills in trans. It
+	// returns ErrTransactionNotFound, ErrNotReversible for reversals, and
+	// ErrAlreadyReversed if the transaction has been reversed before. The
+	// reversal is applied even if it takes a balance below zero.
+	ReverseTransaction(trans *Transaction, audit *AuditEntry) error
+
+	// GetPostings returns the ledger postings of a transaction. It returns
+	// ErrTransactionNotFound if there is no such transaction.
+	GetPostings(transactionID uint64) ([]Posting, error)
+
+	// FindUnbalancedEntries returns the IDs of transactions whose postings
+	// do not sum to zero.
+	FindUnbalancedEntries() ([]uint64, error)
+}
+
+// NotifyFunc renders the notifications for a stored transaction.
+type NotifyFunc func(trans Transaction) []Notification
+
+// CustomerNotifyFunc renders the notifications for a customer whose email
+// address was just registered or changed. A nil CustomerNotifyFunc sends
+// nothing.
+type CustomerNotifyFunc func(c Customer) []Notification
+
+// render returns the notifications for c, if any.
+func (f CustomerNotifyFunc) render(c Customer) []Notification {
+	if f == nil {
+		return nil
+	}
+	return f(c)
+}
+
+// Store is everything App needs from a storage backend.
+//
+// Methods that change data take an *AuditEntry with the actor, action and
+// request filled in. The store sets its time, target and snapshots and
+// appends it to the audit log in the same database transaction as the
+// change. A nil entry is not logged.
+type Store interface {
+	AccountStore
+	CustomerStore
+	TransactionStore
+	IdempotencyStore
+	OutboxStore
+	APIKeyStore
+	AuditStore
+	LedgerChainStore
+}
+
+// Backends map their driver errors to these, so handlers never need to
+// inspect database error codes or messages.
+var (
+	// ErrAccountNotFound is returned when looking up an account that does
+	// not exist.
+	ErrAccountNotFound = errors.New("account not found")
+
+	// ErrTransactionNotFound is returned when looking up a transaction that
+	// does not exist.
+	ErrTransactionNotFound = errors.New("transaction not found")
+
+	// ErrDuplicateAccount is returned when registering a customer with an
+	// account through CreateAccount and a customer with the same ID card
+	// number already exists.
+	ErrDuplicateAccount = errors.New("account exists")
+
+	// ErrCustomerNotFound is returned when looking up a customer that does
+	// not exist.
+	ErrCustomerNotFound = errors.New("customer not found")
+
+	// ErrDuplicateCustomer is returned when a customer with the same ID
+	// card number already exists.
+	ErrDuplicateCustomer = errors.New("customer exists")
+
+	// ErrEmailChanged is returned when verifying an email address the
+	// customer no longer has.
+	ErrEmailChanged = errors.New("email address changed")
+
+	// ErrEmailVerified is returned when asking to verify an email address
+	// that is verified already.
+	ErrEmailVerified = errors.New("email address already verified")
+
+	// ErrUnknownAccount is returned when a transaction refers to an account
+	// that does not exist.
+	ErrUnknownAccount = errors.New("unknown account")
+
+	// ErrInsufficientFunds is returned when a debit would take an account
+	// balance below what it is allowed to reach.
+	ErrInsufficientFunds = errors.New("insufficient funds")
+
+	// ErrAlreadyReversed is returned when reversing a transaction a second
+	// time.
+	ErrAlreadyReversed = errors.New("transaction already reversed")
+
+	// ErrNotReversible is returned when reversing a reversal.
+	ErrNotReversible = errors.New("transaction cannot be reversed")
+
+	// ErrSameAccount is returned for a transfer from an account to itself.
+	ErrSameAccount = errors.New("source and destination are the same account")
+
+	// ErrAccountFrozen is returned when moving money in or out of a frozen
+	// account.
+	ErrAccountFrozen = errors.New("account frozen")
+
+	// ErrAccountClosed is returned when moving money in or out of, or
+	// changing, a closed account.
+	ErrAccountClosed = errors.New("account closed")
+
+	// ErrInvalidStatusChange is returned when freezing an account that is
+	// not active or unfreezing one that is not frozen.
+	ErrInvalidStatusChange = errors.New("invalid account status change")
+
+	// ErrBalanceNotZero is returned when closing an account with money in
+	// it or owing money.
+	ErrBalanceNotZero = errors.New("account balance is not zero")
+
+	// ErrAPIKeyNotFound is returned when looking up an API key that does
+	// not exist.
+	ErrAPIKeyNotFound = errors.New("api key not found")
+
+	// ErrAPIKeyRevoked is returned when rotating a revoked API key.
+	ErrAPIKeyRevoked = errors.New("api key revoked")
+)
+
+// APIKeyStore persists API keys.
+type APIKeyStore interface {
+	// CreateAPIKey stores key and sets its KeyID and CreatedAt.
+	CreateAPIKey(key *APIKey, audit *AuditEntry) error
+
+	// GetAPIKey fills in the key with key.KeyID, revoked or not.
+	GetAPIKey(key *APIKey) error
+
+	// FindAPIKey returns the key with the given prefix, revoked or not, or
+	// ErrAPIKeyNotFound.
+	FindAPIKey(prefix string) (*APIKey, error)
+
+	GetAPIKeys() ([]APIKey, error)
+
+	// RevokeAPIKey marks the key with key.KeyID revoked, if it is not
+	// already, and fills in key.
+	RevokeAPIKey(key *APIKey, audit *AuditEntry) error
+
+	// RotateAPIKey replaces the prefix and hash of the key with key.KeyID
+	// and fills in key. It returns ErrAPIKeyRevoked for a revoked key.
+	RotateAPIKey(key *APIKey, audit *AuditEntry) error
+}
+
+// IdempotencyStore remembers responses to requests sent with an
+// Idempotency-Key header so retries can be answered without repeating the
+// request.
+type IdempotencyStore interface {
+	// ReserveIdempotencyKey stores rec as in flight. If the key is already
+	// held by a record created at or after notBefore, nothing is stored and
+	// that record is returned instead. Older records are replaced.
+	ReserveIdempotencyKey(rec IdempotencyRecord, notBefore time.Time) (*IdempotencyRecord, error)
+
+	// CompleteIdempotencyKey stores the response for a reserved key.
+	CompleteIdempotencyKey(key string, statusCode int, body []byte) error
+
+	// ReleaseIdempotencyKey forgets a reserved key so it can be retried.
+	ReleaseIdempotencyKey(key string) error
+
+	// PurgeIdempotencyKeys deletes records created before the given time.
+	PurgeIdempotencyKeys(before time.Time) error
+}
+
+// IdempotencyRecord is a stored Idempotency-Key. StatusCode is zero while
+// the original request is still being processed.
+type IdempotencyRecord struct {
+	Key         string
+	RequestHash string
+	StatusCode  int
+	Response    []byte
+	CreatedAt   time.Time
+}
+
+// OutboxStore holds notifications waiting to be delivered.
+type OutboxStore interface {
+	// ClaimOutboxMessages returns up to limit pending messages due at now
+	// and postpones them until now+lease, so a slow delivery is not picked
+	// up twice.
+	ClaimOutboxMessages(now time.Time, limit int, lease time.Duration) ([]OutboxMessage, error)
+
+	// UpdateOutboxMessage saves the status, attempts, last error and
+	// next attempt time of a claimed message.
+	UpdateOutboxMessage(msg OutboxMessage) error
+
+	// GetOutboxMessages lists messages with the given status, oldest first.
+	GetOutboxMessages(status string) ([]OutboxMessage, error)
+}
+
+// AuditStore reads the append-only audit log. Entries are only ever
+// written alongside the change they describe.
+type AuditStore interface {
+	GetAuditEntries(f AuditFilter) ([]AuditEntry, error)
+}
+
+// LedgerChainStore reads the hash chain over the transaction log, which
+// the TransactionStore methods extend as they add rows, and stores signed
+// checkpoints of it.
+type LedgerChainStore interface {
+	// GetChainLinks returns up to limit transaction log rows with IDs
+	// above afterID, in ID order, with their stored hashes and postings.
+	GetChainLinks(afterID uint64, limit int) ([]ChainLink, error)
+
+	// GetChainHead returns the last row added to the chain.
+	GetChainHead() (ChainHead, error)
+
+	// CreateCheckpoint stores c and sets its CheckpointID.
+	CreateCheckpoint(c *Checkpoint) error
+
+	// GetCheckpoints returns every checkpoint, oldest first.
+	GetCheckpoints() ([]Checkpoint, error)
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// problemContentType is the media type of RFC 7807 problem details.
+const problemContentType = "application/problem+json"
+
+// Problem is an RFC 7807 problem details body. Errors lists everything
+// wrong with the request, so a client can fix it all before resubmitting.
+type Problem struct {
+	Type   string       `json:"type"`
+	Title  string       `json:"title"`
+	Status int          `json:"status"`
+	Detail string       `json:"detail,omitempty"`
+	Errors []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError is a problem with one field of a request. Field is the path
+// of a body field, such as "jointholders.1", the name of a query parameter
+// or path variable, or empty for problems with the body as a whole.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Codes of FieldError, besides those of NIKError.
+const (
+	FieldRequired    = "required"
+	FieldInvalid     = "invalid"
+	FieldTooLong     = "too_long"
+	FieldDuplicate   = "duplicate"
+	FieldUnknown     = "unknown_field"
+	FieldWrongType   = "wrong_type"
+	BodyMalformed    = "malformed_json"
+	BodyTrailingData = "trailing_data"
+)
+
+// validator collects the problems with a request.
+type validator struct {
+	errs []FieldError
+}
+
+// add records a problem with field.
+func (v *validator) add(field, code, message string) {
+	v.errs = append(v.errs, FieldError{field, code, message})
+}
+
+// check records a problem with field unless ok.
+func (v *validator) check(ok bool, field, code, message string) {
+	if !ok {
+		v.add(field, code, message)
+	}
+}
+
+// required records that field is missing if s is empty, and otherwise
+// checks it with valid.
+func (v *validator) required(s, field string, valid func(string) bool, message string) {
+	if s == "" {
+		v.add(field, FieldRequired, "is required")
+		return
+	}
+	v.check(valid(s), field, FieldInvalid, message)
+}
+
+// idCard checks an ID card number with ParseNIK, recording its reason.
+func (v *validator) idCard(s, field string) {
+	if s == "" {
+		v.add(field, FieldRequired, "is required")
+		return
+	}
+	if _, err := ParseNIK(s); err != nil {
+		var nikErr *NIKError
+		if errors.As(err, &nikErr) {
+			v.add(field, nikErr.Code, nikErr.Reason)
+		} else {
+			v.add(field, FieldInvalid, err.Error())
+		}
+	}
+}
+
+// timeParam reads the RFC 3339 time in query parameter param into dst.
+func (v *validator) timeParam(q url.Values, param string, dst *time.Time) {
+	s := q.Get(param)
+	if s == "" {
+		return
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		v.add(param, FieldInvalid, "must be an RFC 3339 time")
+		return
+	}
+	*dst = t.UTC()
+}
+
+// valid reports whether no problems were recorded, and responds with them
+// otherwise.
+func (v *validator) valid(w http.ResponseWriter) bool {
+	if len(v.errs) == 0 {
+		return true
+	}
+	respondWithProblem(w, http.StatusBadRequest, v.errs)
+	return false
+}
+
+// pathID parses the path variable name as an ID of at most bits bits and
+// responds with the problem if it is not one.
+func pathID(w http.ResponseWriter, r *http.Request, name string, bits int) (uint64, bool) {
+	id, err := strconv.ParseUint(mux.Vars(r)[name], 10, bits)
+	if err != nil {
+		respondWithProblem(w, http.StatusBadRequest, []FieldError{{name, FieldInvalid, "is not a valid ID"}})
+		return 0, false
+	}
+	return id, true
+}
+
+var errTrailingData = errors.New("trailing data after the JSON value")
+
+// decodeJSON decodes a request body into dst. Unlike a plain
+// json.Decoder, it rejects fields dst does not have and anything after the
+// JSON value. An empty body is io.EOF.
+func decodeJSON(r io.Reader, dst interface{}) error {
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		return io.EOF
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(dst); err != nil {
+		return &bodyError{err, body}
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return errTrailingData
+	}
+	return nil
+}
+
+// bodyError keeps the body that failed to decode, to find the field at
+// fault when the decoder does not say.
+type bodyError struct {
+	err  error
+	body []byte
+}
+
+func (e *bodyError) Error() string { return e.err.Error() }
+func (e *bodyError) Unwrap() error { return e.err }
+
+// decodeError describes an error from decodeJSON.
+func decodeError(err error, dst interface{}) FieldError {
+	var typeErr *json.UnmarshalTypeError
+	var syntaxErr *json.SyntaxError
+	switch {
+	case err == io.EOF:
+		return FieldError{"", BodyMalformed, "must be a JSON object"}
+	case err == errTrailingData:
+		return FieldError{"", BodyTrailingData, "must hold a single JSON value"}
+	case errors.As(err, &syntaxErr), errors.Is(err, io.ErrUnexpectedEOF):
+		return FieldError{"", BodyMalformed, "is not valid JSON"}
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		return FieldError{typeErr.Field, FieldWrongType, "must be " + jsonKind(typeErr.Type)}
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		field, _ := strconv.Unquote(strings.TrimPrefix(err.Error(), "json: unknown field "))
+		return FieldError{field, FieldUnknown, "is not a known field"}
+	}
+
+	// Errors from types that decode themselves, such as Money, do not say
+	// which field they are in.
+	var be *bodyError
+	if errors.As(err, &be) {
+		if field := failingField(be.body, dst); field != "" {
+			return FieldError{field, FieldWrongType, "must be " + jsonKind(fieldType(dst, field))}
+		}
+	}
+	return FieldError{"", BodyMalformed, err.Error()}
+}
+
+// failingField returns the first top-level field of body that dst cannot
+// decode on its own.
+func failingField(body []byte, dst interface{}) string {
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(body, &fields) != nil {
+		return ""
+	}
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	t := reflect.TypeOf(dst).Elem()
+	for _, name := range names {
+		one, _ := json.Marshal(map[string]json.RawMessage{name: fields[name]})
+		if json.Unmarshal(one, reflect.New(t).Interface()) != nil {
+			return name
+		}
+	}
+	return ""
+}
+
+// fieldType returns the type of the field of *dst named name in JSON.
+func fieldType(dst interface{}, name string) reflect.Type {
+	t := reflect.TypeOf(dst).Elem()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if strings.Split(f.Tag.Get("json"), ",")[0] == name {
+			return f.Type
+		}
+	}
+	return nil
+}
+
+// jsonKind names the kind of JSON value that decodes into t.
+func jsonKind(t reflect.Type) string {
+	if t == reflect.TypeOf(Money(0)) {
+		return "an amount"
+	}
+	if t == nil {
+		return "a valid value"
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "true or false"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return "an integer"
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "a non-negative integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	case reflect.Ptr:
+		return jsonKind(t.Elem())
+	}
+	return "an object"
+}
+
+// decodeRequest decodes the request body into dst and responds with the
+// problem if it cannot.
+func decodeRequest(w http.ResponseWriter, r *http.Request, dst interface{}) bool {
+	defer r.Body.Close()
+	if err := decodeJSON(r.Body, dst); err != nil {
+		respondWithProblem(w, http.StatusBadRequest, []FieldError{decodeError(err, dst)})
+		return false
+	}
+	return true
+}
+
+// respondWithProblem responds with an RFC 7807 body listing errs.
+func respondWithProblem(w http.ResponseWriter, code int, errs []FieldError) {
+	details := make([]string, len(errs))
+	for i, e := range errs {
+		field := e.Field
+		if field == "" {
+			field = "request body"
+		}
+		details[i] = field + " " + e.Message
+	}
+
+	response, _ := json.Marshal(Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(code),
+		Status: code,
+		Detail: strings.Join(details, "; "),
+		Errors: errs,
+	})
+
+	w.Header().Set("Content-Type", problemContentType)
+	w.WriteHeader(code)
+	w.Write(response)
+}
@@ -0,0 +1,151 @@
+package main_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	. "github.com/mikeadityas/simple-cash-deposit-be"
+)
+
+func TestCreateAccountReportsEveryError(t *testing.T) {
+	clearTable()
+	addAccount(1)
+
+	payload := `{"idcardno":"9971093101900001","name":"th3nun","email":"","overdraftlimit":-1,"producttype":"deposito","jointholders":[2,0,2]}`
+	req, _ := http.NewRequest("POST", "/account", bytes.NewBufferString(payload))
+	response := executeRequest(req)
+	checkProblem(t, response, map[string]string{
+		"idcardno":       NIKProvince,
+		"name":           FieldInvalid,
+		"email":          FieldRequired,
+		"overdraftlimit": FieldInvalid,
+		"producttype":    FieldInvalid,
+		"jointholders.1": FieldInvalid,
+		"jointholders.2": FieldDuplicate,
+	})
+
+	var p Problem
+	json.Unmarshal(response.Body.Bytes(), &p)
+	if p.Type != "about:blank" || p.Title != "Bad Request" || !strings.Contains(p.Detail, "email is required") {
+		t.Errorf("Expected an RFC 7807 body. Got %+v", p)
+	}
+}
+
+func TestRejectMalformedBodies(t *testing.T) {
+	clearTable()
+	addAccount(1)
+
+	tests := []struct {
+		method, path, payload string
+		errors                map[string]string
+	}{
+		{"POST", "/account", ``, map[string]string{"": BodyMalformed}},
+		{"POST", "/account", `{"name":`, map[string]string{"": BodyMalformed}},
+		{"POST", "/account", `{"idcardno":"3171093101900001","name":"Michael","email":"michaeladityas@live.com","balance":1000}`, map[string]string{"balance": FieldUnknown}},
+		{"POST", "/account", `{"idcardno":"3171093101900001","name":"Michael","email":"michaeladityas@live.com"} {}`, map[string]string{"": BodyTrailingData}},
+		{"POST", "/account", `{"idcardno":"3171093101900001","name":"Michael","email":"michaeladityas@live.com"}x`, map[string]string{"": BodyTrailingData}},
+		{"POST", "/account", `{"customerid":1,"jointholders":[2,"3"]}`, map[string]string{"jointholders.1": FieldWrongType}},
+		{"POST", "/account", `{"customerid":1,"overdraftlimit":"lots"}`, map[string]string{"overdraftlimit": FieldWrongType}},
+		{"POST", "/customer", `{"idcardno":3171093101900001}`, map[string]string{"idcardno": FieldWrongType}},
+		{"PATCH", "/account/1", `{"name":"Michael","status":"closed"}`, map[string]string{"status": FieldUnknown}},
+		{"POST", "/account/1/freeze", `{"reason":"lost card"}]`, map[string]string{"": BodyTrailingData}},
+		{"POST", "/account/1/withdrawal", `{"amount":"1.2.3"}`, map[string]string{"amount": FieldWrongType}},
+		{"POST", "/apikey", `{"name":"kiosk","scopes":["deposits:create","everything"],"allowedips":["nowhere"]}`, map[string]string{"scopes.1": FieldInvalid, "allowedips.0": FieldInvalid}},
+	}
+
+	for _, tt := range tests {
+		req, _ := http.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.payload))
+		checkProblem(t, executeRequest(req), tt.errors)
+	}
+
+	// Freezing takes an optional body.
+	req, _ := http.NewRequest("POST", "/account/1/freeze", nil)
+	checkResponseCode(t, http.StatusOK, executeRequest(req).Code)
+}
+
+func TestIdempotencyKeyNotStoredForInvalidRequests(t *testing.T) {
+	clearTable()
+	addAccount(1)
+
+	deposit := func(payload string) int {
+		req, _ := http.NewRequest("POST", "/transaction", bytes.NewBufferString(payload))
+		req.Header.Set("Idempotency-Key", "retry-after-fixing")
+		return executeRequest(req).Code
+	}
+
+	checkResponseCode(t, http.StatusBadRequest, deposit(`{"depositdest":1,"externalsource":"michaeladityas@live.com","amount":0}`))
+	checkResponseCode(t, http.StatusCreated, deposit(`{"depositdest":1,"externalsource":"michaeladityas@live.com","amount":1}`))
+}
+
+func TestRejectInvalidQueryParameters(t *testing.T) {
+	clearTable()
+	addAccount(1)
+
+	tests := []struct {
+		path   string
+		errors map[string]string
+	}{
+		{"/account?limit=0&sort=age&order=up&registered_from=yesterday&registered_to=2018-09-17", map[string]string{
+			"limit":           FieldInvalid,
+			"sort":            FieldInvalid,
+			"order":           FieldInvalid,
+			"registered_from": FieldInvalid,
+			"registered_to":   FieldInvalid,
+		}},
+		// A cursor only continues the sort it was made for.
+		{"/account?sort=name&cursor=" + base64.RawURLEncoding.EncodeToString([]byte("balance\x00100\x001")), map[string]string{"cursor": FieldInvalid}},
+		{"/transaction?limit=501&cursor=nope&from=today&min_amount=1.2.3&max_amount=lots&source=bank&destination=-1", map[string]string{
+			"limit":       FieldInvalid,
+			"cursor":      FieldInvalid,
+			"from":        FieldInvalid,
+			"min_amount":  FieldInvalid,
+			"max_amount":  FieldInvalid,
+			"source":      FieldInvalid,
+			"destination": FieldInvalid,
+		}},
+		{"/audit?limit=x&cursor=%21&to=never", map[string]string{"limit": FieldInvalid, "cursor": FieldInvalid, "to": FieldInvalid}},
+	}
+
+	for _, tt := range tests {
+		req, _ := http.NewRequest("GET", tt.path, nil)
+		checkProblem(t, executeRequest(req), tt.errors)
+	}
+}
+
+func TestRejectInvalidPathIDs(t *testing.T) {
+	clearTable()
+	addAccount(1)
+
+	tests := []struct {
+		method, path, field string
+	}{
+		{"GET", "/account/4294967296", "accountid"},
+		{"GET", "/account/99999999999/history", "accountid"},
+		{"PATCH", "/account/4294967297/notifications", "accountid"},
+		{"GET", "/customer/4294967296", "customerid"},
+		{"GET", "/transaction/18446744073709551616/postings", "transid"},
+		{"DELETE", "/apikey/18446744073709551616", "keyid"},
+	}
+
+	for _, tt := range tests {
+		req, _ := http.NewRequest(tt.method, tt.path, bytes.NewBufferString(`{}`))
+		checkProblem(t, executeRequest(req), map[string]string{tt.field: FieldInvalid})
+	}
+}
+
+func TestRejectDuplicateIDCardNumbers(t *testing.T) {
+	clearTable()
+
+	payload := `{"idcardno":"3171093101900001","name":"Michael","email":"michaeladityas@live.com"}`
+	for _, path := range []string{"/customer", "/account"} {
+		req, _ := http.NewRequest("POST", "/customer", bytes.NewBufferString(payload))
+		executeRequest(req)
+
+		req, _ = http.NewRequest("POST", path, bytes.NewBufferString(payload))
+		checkProblem(t, executeRequest(req), map[string]string{"idcardno": FieldDuplicate})
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultEmailVerificationTTL is how long a verification link works when
+// EmailVerification.TTL is not set.
+const DefaultEmailVerificationTTL = 24 * time.Hour
+
+// What happens to notifications for addresses that are not verified yet.
+const (
+	// UnverifiedHold keeps them in the outbox until the address is
+	// verified, then sends them.
+	UnverifiedHold = "hold"
+	// UnverifiedSuppress drops them.
+	UnverifiedSuppress = "suppress"
+)
+
+// EmailVerification proves that customers own the email addresses they
+// register. Newly registered and changed addresses are sent a link with a
+// signed token; following it marks the address verified.
+type EmailVerification struct {
+	// Secret signs the tokens. A random one is generated if it is empty,
+	// so links stop working when the process restarts.
+	Secret []byte
+
+	// TTL is how long a token is valid. Defaults to
+	// DefaultEmailVerificationTTL.
+	TTL time.Duration
+
+	// Unverified is UnverifiedHold (the default) or UnverifiedSuppress.
+	Unverified string
+
+	// BaseURL is the public address of the API, such as
+	// "https://bank.example". Links are relative without it.
+	BaseURL string
+}
+
+// emailToken is what a verification token signs. It names the address as
+// well as the customer, so changing the address invalidates old links.
+type emailToken struct {
+	CustomerID uint32 `json:"cid"`
+	Email      string `json:"email"`
+	ExpiresAt  int64  `json:"exp"`
+}
+
+var errTokenExpired = errors.New("token expired")
+
+// token returns a token verifying email for the customer, and when it
+// expires.
+func (v *EmailVerification) token(customerID uint32, email string, now time.Time) (string, time.Time) {
+	expires := now.Add(v.TTL).Truncate(time.Second)
+	payload, _ := json.Marshal(emailToken{customerID, email, expires.Unix()})
+	signed := base64.RawURLEncoding.EncodeToString(payload)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(v.sign(signed)), expires
+}
+
+func (v *EmailVerification) sign(s string) []byte {
+	mac := hmac.New(sha256.New, v.Secret)
+	mac.Write([]byte(s))
+	return mac.Sum(nil)
+}
+
+// verify checks a token's signature and expiry and returns what it signs.
+func (v *EmailVerification) verify(token string, now time.Time) (emailToken, error) {
+	var t emailToken
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return t, errInvalidToken
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(sig, v.sign(parts[0])) {
+		return t, errInvalidToken
+	}
+	if err := decodeSegment(parts[0], &t); err != nil || t.CustomerID == 0 {
+		return t, errInvalidToken
+	}
+	if now.Unix() >= t.ExpiresAt {
+		return t, errTokenExpired
+	}
+	return t, nil
+}
+
+// link returns the URL that verifies email for the customer, and when it
+// stops working.
+func (v *EmailVerification) link(customerID uint32, email string) (string, time.Time) {
+	token, expires := v.token(customerID, email, time.Now())
+	return strings.TrimSuffix(v.BaseURL, "/") + "/account/verify-email?token=" + url.QueryEscape(token), expires
+}
+
+// setDefaults fills in the TTL, policy and, if needed, a random secret.
+func (v *EmailVerification) setDefaults() {
+	if v.TTL <= 0 {
+		v.TTL = DefaultEmailVerificationTTL
+	}
+	if v.Unverified == "" {
+		v.Unverified = UnverifiedHold
+	}
+	if len(v.Secret) == 0 {
+		v.Secret = make([]byte, 32)
+		if _, err := rand.Read(v.Secret); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// notify wraps render so that notifications for unverified addresses are
+// dropped when the policy is UnverifiedSuppress. Otherwise the outbox
+// holds them.
+func (a *App) notify(render NotifyFunc) NotifyFunc {
+	if a.EmailVerification.Unverified != UnverifiedSuppress {
+		return render
+	}
+	return func(trans Transaction) []Notification {
+		notes := []Notification{}
+		for _, n := range render(trans) {
+			if !n.Unverified {
+				notes = append(notes, n)
+			}
+		}
+		return notes
+	}
+}
+
+// verificationEmail renders the link that verifies the customer's address.
+// It is queued in the same transaction as the change that called for it.
+func (a *App) verificationEmail(c Customer) []Notification {
+	link, expires := a.EmailVerification.link(c.CustomerID, c.Email)
+	return []Notification{verificationNotification(c.Email, link, expires)}
+}
+
+// verifyEmail follows a verification link. It needs no credentials: the
+// token is proof enough.
+func (a *App) verifyEmail(w http.ResponseWriter, r *http.Request) {
+	t, err := a.EmailVerification.verify(r.URL.Query().Get("token"), time.Now())
+	if err == errTokenExpired {
+		respondWithErrorCode(w, http.StatusBadRequest, "Verification link has expired", "token_expired")
+		return
+	}
+	if err != nil {
+		respondWithErrorCode(w, http.StatusBadRequest, "Invalid verification link", "token_invalid")
+		return
+	}
+
+	audit := &AuditEntry{
+		Actor:     customerTarget(t.CustomerID),
+		Action:    AuditCustomerVerifyEmail,
+		RequestID: RequestIDFrom(r.Context()),
+		ClientIP:  clientIP(r),
+	}
+	err = a.Store.VerifyCustomerEmail(t.CustomerID, t.Email, audit)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrCustomerNotFound):
+			respondWithErrorCode(w, http.StatusBadRequest, "Invalid verification link", "token_invalid")
+		case errors.Is(err, ErrEmailChanged):
+			respondWithErrorCode(w, http.StatusConflict, "The email address has changed since the link was sent", "email_changed")
+		default:
+			respondWithError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"email": t.Email, "emailverified": true})
+}
+
+// resendVerificationEmail sends a new link to a customer whose address is
+// not verified yet.
+func (a *App) resendVerificationEmail(w http.ResponseWriter, r *http.Request) {
+	customerid, ok := pathID(w, r, "customerid", 32)
+	if !ok {
+		return
+	}
+
+	err := a.Store.ResendVerificationEmail(uint32(customerid), a.verificationEmail, newAuditEntry(r, AuditCustomerResendVerification))
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrCustomerNotFound):
+			respondWithError(w, http.StatusNotFound, "Customer not found")
+		case errors.Is(err, ErrEmailVerified):
+			respondWithErrorCode(w, http.StatusConflict, "Email address is already verified", "email_verified")
+		default:
+			respondWithError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
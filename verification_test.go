@@ -0,0 +1,269 @@
+package main_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+
+	. "github.com/mikeadityas/simple-cash-deposit-be"
+)
+
+var verificationLink = regexp.MustCompile(`/account/verify-email\?token=\S+`)
+
+// lastVerificationLink returns the path of the latest verification link
+// queued for recipient.
+func lastVerificationLink(t *testing.T, recipient string) string {
+	msgs, _ := a.Store.GetOutboxMessages(OutboxPending)
+	link := ""
+	for _, m := range msgs {
+		if m.Kind == "email_verification" && m.Recipient == recipient {
+			link = verificationLink.FindString(m.Body)
+		}
+	}
+	if link == "" {
+		t.Fatalf("Expected a verification email to %s. Got %+v", recipient, msgs)
+	}
+	return link
+}
+
+// followLink serves a GET of path without credentials, as a customer's
+// browser would.
+func followLink(path string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("GET", path, nil)
+	rr := httptest.NewRecorder()
+	a.Router.ServeHTTP(rr, req)
+	return rr
+}
+
+func openAccount(t *testing.T, email string) {
+	payload := `{"idcardno":"3171093101900002","name":"Michael","email":"` + email + `"}`
+	req, _ := http.NewRequest("POST", "/account", bytes.NewBufferString(payload))
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusCreated, response.Code)
+
+	var acc Account
+	json.Unmarshal(response.Body.Bytes(), &acc)
+	if acc.EmailVerified {
+		t.Errorf("Expected a new account's email to be unverified. Got %+v", acc)
+	}
+}
+
+func transferToAccount2(t *testing.T) {
+	req, _ := http.NewRequest("POST", "/transfer", bytes.NewBufferString(`{"internalsource":1,"depositdest":2,"amount":100}`))
+	checkResponseCode(t, http.StatusCreated, executeRequest(req).Code)
+}
+
+func TestVerifyEmail(t *testing.T) {
+	clearTable()
+	addAccount(1)
+	addTransaction(false, "michaeladityas@live.com", 1)
+	openAccount(t, "michaeladityas@live.com")
+
+	// The transfer is held for the unverified recipient.
+	transferToAccount2(t)
+	held, _ := a.Store.GetOutboxMessages(OutboxHeld)
+	if len(held) != 1 || held[0].Kind != "transfer_received" {
+		t.Fatalf("Expected the recipient's notification to be held. Got %+v", held)
+	}
+
+	// Verification needs no credentials.
+	response := followLink(lastVerificationLink(t, "michaeladityas@live.com"))
+	checkResponseCode(t, http.StatusOK, response.Code)
+
+	acc := Account{AccountID: 2}
+	a.Store.GetAccount(&acc)
+	if !acc.EmailVerified {
+		t.Errorf("Expected the email to be verified. Got %+v", acc)
+	}
+	if held, _ := a.Store.GetOutboxMessages(OutboxHeld); len(held) != 0 {
+		t.Errorf("Expected held notifications to be released. Got %+v", held)
+	}
+
+	pending, _ := a.Store.GetOutboxMessages(OutboxPending)
+	if last := pending[len(pending)-1]; last.Kind != "transfer_received" {
+		t.Errorf("Expected the released notification to be pending. Got %+v", pending)
+	}
+
+	if page := getAuditPage(t, "?action="+AuditCustomerVerifyEmail); len(page.Entries) != 1 || page.Entries[0].Target != "customer:2" {
+		t.Errorf("Expected a customer.verify_email audit entry. Got %+v", page.Entries)
+	}
+
+	// Following the link again changes nothing.
+	checkResponseCode(t, http.StatusOK, followLink(lastVerificationLink(t, "michaeladityas@live.com")).Code)
+}
+
+func TestUnverifiedNotificationsSuppressed(t *testing.T) {
+	clearTable()
+	a.EmailVerification.Unverified = UnverifiedSuppress
+	addAccount(1)
+	addTransaction(false, "michaeladityas@live.com", 1)
+	openAccount(t, "michaeladityas@live.com")
+
+	transferToAccount2(t)
+	if held, _ := a.Store.GetOutboxMessages(OutboxHeld); len(held) != 0 {
+		t.Errorf("Expected no held notifications. Got %+v", held)
+	}
+
+	pending, _ := a.Store.GetOutboxMessages(OutboxPending)
+	for _, m := range pending {
+		if m.Kind == "transfer_received" {
+			t.Errorf("Expected the recipient's notification to be dropped. Got %+v", m)
+		}
+	}
+}
+
+func TestRejectVerificationLinks(t *testing.T) {
+	clearTable()
+	openAccount(t, "michaeladityas@live.com")
+	link := lastVerificationLink(t, "michaeladityas@live.com")
+
+	u, _ := url.Parse(link)
+	token := u.Query().Get("token")
+	for _, tampered := range []string{"", "garbage", token + "x", "x" + token} {
+		response := followLink("/account/verify-email?token=" + url.QueryEscape(tampered))
+		checkResponseCode(t, http.StatusBadRequest, response.Code)
+		checkErrorCode(t, response.Body.Bytes(), "token_invalid")
+	}
+
+	// Changing the address sends a new link and voids the old one.
+	req, _ := http.NewRequest("PATCH", "/account/1", bytes.NewBufferString(`{"email":"mike.sutiono@gmail.com"}`))
+	checkResponseCode(t, http.StatusOK, executeRequest(req).Code)
+
+	response := followLink(link)
+	checkResponseCode(t, http.StatusConflict, response.Code)
+	checkErrorCode(t, response.Body.Bytes(), "email_changed")
+
+	checkResponseCode(t, http.StatusOK, followLink(lastVerificationLink(t, "mike.sutiono@gmail.com")).Code)
+
+	// So does changing it after it was verified.
+	req, _ = http.NewRequest("PATCH", "/account/1", bytes.NewBufferString(`{"email":"michaeladityas@live.com"}`))
+	response = executeRequest(req)
+	var acc Account
+	json.Unmarshal(response.Body.Bytes(), &acc)
+	if acc.EmailVerified {
+		t.Errorf("Expected a changed email to be unverified. Got %+v", acc)
+	}
+
+	// Links stop working when they expire.
+	a.EmailVerification.TTL = time.Nanosecond
+	req, _ = http.NewRequest("POST", "/customer/1/verification-email", nil)
+	checkResponseCode(t, http.StatusAccepted, executeRequest(req).Code)
+
+	response = followLink(lastVerificationLink(t, "michaeladityas@live.com"))
+	checkResponseCode(t, http.StatusBadRequest, response.Code)
+	checkErrorCode(t, response.Body.Bytes(), "token_expired")
+}
+
+func TestVerificationEmailQueuedWithChange(t *testing.T) {
+	clearTable()
+	addAccount(1)
+
+	notify := func(c Customer) []Notification {
+		return []Notification{{Kind: "email_verification", Recipient: c.Email, Subject: "Verify", Body: fmt.Sprint("customer ", c.CustomerID)}}
+	}
+	queued := func() []string {
+		msgs, _ := a.Store.GetOutboxMessages(OutboxPending)
+		bodies := []string{}
+		for _, m := range msgs {
+			bodies = append(bodies, m.Recipient+" "+m.Body)
+		}
+		return bodies
+	}
+
+	// An account that cannot be opened queues nothing for its new owner.
+	acc := Account{IDCard: "3171093101900002", Name: "Michael", Email: "michaeladityas@live.com", JointHolders: []uint32{99}}
+	if err := a.Store.CreateAccount(&acc, notify, nil); !errors.Is(err, ErrCustomerNotFound) {
+		t.Fatalf("Expected ErrCustomerNotFound. Got %v", err)
+	}
+	if got := queued(); len(got) != 0 {
+		t.Errorf("Expected nothing to be queued. Got %v", got)
+	}
+
+	acc = Account{IDCard: "3171093101900002", Name: "Michael", Email: "michaeladityas@live.com"}
+	if err := a.Store.CreateAccount(&acc, notify, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only a changed address has to be verified again.
+	a.Store.UpdateAccount(&Account{AccountID: acc.AccountID, Name: "Michael Aditya", Email: acc.Email}, notify, nil)
+	a.Store.UpdateAccount(&Account{AccountID: acc.AccountID, Name: "Michael Aditya", Email: "mike@mail.com"}, notify, nil)
+
+	c := Customer{IDCard: "3171093101900003", Name: "Sutiono", Email: "sutiono@mail.com"}
+	a.Store.CreateCustomer(&c, notify, nil)
+
+	want := []string{
+		fmt.Sprint("michaeladityas@live.com customer ", acc.CustomerID),
+		fmt.Sprint("mike@mail.com customer ", acc.CustomerID),
+		fmt.Sprint("sutiono@mail.com customer ", c.CustomerID),
+	}
+	if got := queued(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v to be queued. Got %v", want, got)
+	}
+}
+
+func TestResendVerificationEmail(t *testing.T) {
+	clearTable()
+	openAccount(t, "michaeladityas@live.com")
+
+	resend := func(path, key string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", path, nil)
+		req.Header.Set("Idempotency-Key", key)
+		return executeRequest(req)
+	}
+	links := func() int {
+		msgs, _ := a.Store.GetOutboxMessages(OutboxPending)
+		n := 0
+		for _, m := range msgs {
+			if m.Kind == "email_verification" {
+				n++
+			}
+		}
+		return n
+	}
+
+	// A retried request sends one link.
+	checkResponseCode(t, http.StatusAccepted, resend("/customer/1/verification-email", "resend-1").Code)
+	checkResponseCode(t, http.StatusAccepted, resend("/customer/1/verification-email", "resend-1").Code)
+	if n := links(); n != 2 {
+		t.Errorf("Expected the registration link and one more. Got %d", n)
+	}
+	page := getAuditPage(t, "?action="+AuditCustomerResendVerification)
+	if len(page.Entries) != 1 || page.Entries[0].Target != "customer:1" {
+		t.Errorf("Expected one %s audit entry. Got %+v", AuditCustomerResendVerification, page.Entries)
+	}
+
+	checkResponseCode(t, http.StatusNotFound, resend("/customer/2/verification-email", "resend-2").Code)
+
+	checkResponseCode(t, http.StatusOK, followLink(lastVerificationLink(t, "michaeladityas@live.com")).Code)
+	response := resend("/customer/1/verification-email", "resend-3")
+	checkResponseCode(t, http.StatusConflict, response.Code)
+	checkErrorCode(t, response.Body.Bytes(), "email_verified")
+	if n := links(); n != 2 {
+		t.Errorf("Expected no link for a verified address. Got %d", n)
+	}
+}
+
+func TestResendVerificationEmailForbidden(t *testing.T) {
+	clearTable()
+	openAccount(t, "michaeladityas@live.com")
+
+	// Customers cannot resend links, not even for themselves: the route
+	// is keyed by customer, which authorize does not check ownership of.
+	for _, token := range []string{mintToken(RoleCustomer, "michael", 1), mintToken(RoleTeller, "teller-07", 0)} {
+		req, _ := http.NewRequest("POST", "/customer/1/verification-email", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		checkResponseCode(t, http.StatusForbidden, executeRequest(req).Code)
+	}
+
+	if page := getAuditPage(t, "?action="+AuditCustomerResendVerification); len(page.Entries) != 0 {
+		t.Errorf("Expected no resends. Got %+v", page.Entries)
+	}
+}